@@ -0,0 +1,242 @@
+// Batch verification of the Ed25519 signatures of a fulfillment tree
+package batch
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/ed25519"
+
+	"crypto-conditions/validation"
+)
+
+// Entry is an Ed25519 signature added to a Batch.
+type Entry struct {
+	PublicKey []byte
+	Message   []byte
+	Signature []byte
+}
+
+// Checks the signature on its own with the batch equation of a single
+// signature, [8](-sB + R + kA) = 0, so that it is decided as in any Batch.
+func (e *Entry) verify() bool {
+	A, R, s, k, ok := e.decode()
+	if !ok {
+		return false
+	}
+
+	check := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(k, A, edwards25519.NewScalar().Negate(s))
+	check.Add(check, R)
+	check.MultByCofactor(check)
+
+	return check.Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// Decodes the public key A, the R and s halves of the signature and the hash
+// k of R, A and the message. It fails if any of them is malformed. R must be
+// canonically encoded, as ed25519.Verify compares it as encoded, and s is
+// reduced, as ed25519.Verify takes any s below 2²⁵³.
+func (e *Entry) decode() (A, R *edwards25519.Point, s, k *edwards25519.Scalar, ok bool) {
+	if len(e.PublicKey) != ed25519.PublicKeySize || len(e.Signature) != ed25519.SignatureSize || e.Signature[63]&224 != 0 {
+		return nil, nil, nil, nil, false
+	}
+
+	A, err := new(edwards25519.Point).SetBytes(e.PublicKey)
+	if err != nil {
+		return nil, nil, nil, nil, false
+	}
+
+	R, err = new(edwards25519.Point).SetBytes(e.Signature[:32])
+	if err != nil || !bytes.Equal(R.Bytes(), e.Signature[:32]) {
+		return nil, nil, nil, nil, false
+	}
+
+	var wide [64]byte
+	copy(wide[:], e.Signature[32:])
+	s = edwards25519.NewScalar().SetUniformBytes(wide[:])
+
+	var digest [64]byte
+	h := sha512.New()
+	h.Write(e.Signature[:32])
+	h.Write(e.PublicKey)
+	h.Write(e.Message)
+	k = edwards25519.NewScalar().SetUniformBytes(h.Sum(digest[:0]))
+
+	return A, R, s, k, true
+}
+
+// Batch collects the Ed25519 signatures met while validating a fulfillment
+// tree, such as a threshold over a large validator set, to verify them
+// together once the rest of the tree is known to be valid. The zero value is
+// an empty Batch.
+//
+// The signatures are checked together with the batch equation
+//
+//	[8]((-Σ zᵢsᵢ)B + Σ zᵢRᵢ + Σ (zᵢkᵢ)Aᵢ) = 0
+//
+// for random 128-bit zᵢ, split in chunks over GOMAXPROCS goroutines. If a
+// chunk fails, every signature is verified one by one with the equation of a
+// single signature, [8](-sB + R + kA) = 0, to find the invalid ones, so that
+// whether a signature is valid doesn't depend on the others in the Batch.
+// Signatures that ed25519.Verify accepts always pass. As the equations are
+// multiplied by the cofactor, they also accept the rare signatures whose R
+// or A is off by a small-order point, which ed25519.Verify, and so the
+// Validate functions, reject; only their signer can make those, deliberately.
+type Batch struct {
+	entries []Entry
+	invalid []int
+}
+
+// Fewest signatures checked by one batch equation, below which splitting the
+// Batch further over goroutines saves little.
+const minChunk = 16
+
+// Add adds a signature to verify.
+func (b *Batch) Add(publicKey, message, signature []byte) {
+	b.entries = append(b.entries, Entry{PublicKey: publicKey, Message: message, Signature: signature})
+}
+
+// Len returns the number of signatures added.
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
+
+// Entries returns the signatures added, in order.
+func (b *Batch) Entries() []Entry {
+	return b.entries
+}
+
+// Verify checks every signature of the Batch, and returns
+// validation.ErrSignatureInvalid if any is invalid. Invalid then tells which.
+func (b *Batch) Verify() error {
+	b.invalid = nil
+
+	chunk := (len(b.entries) + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0)
+	if chunk < minChunk {
+		chunk = minChunk
+	}
+	chunks := (len(b.entries) + chunk - 1) / chunk
+
+	var failed int32
+	parallel(chunks, func(c int) bool {
+		end := (c + 1) * chunk
+		if end > len(b.entries) {
+			end = len(b.entries)
+		}
+		if !equation(b.entries[c*chunk : end]) {
+			atomic.StoreInt32(&failed, 1)
+			return false
+		}
+		return atomic.LoadInt32(&failed) == 0
+	})
+
+	if failed == 0 {
+		return nil
+	}
+
+	b.invalid = b.pinpoint()
+	if len(b.invalid) != 0 {
+		return validation.ErrSignatureInvalid
+	}
+
+	// Only the random zᵢ can fail a chunk of valid signatures
+	return nil
+}
+
+// Invalid returns the indexes in Entries of the invalid signatures found by
+// the last call to Verify.
+func (b *Batch) Invalid() []int {
+	return b.invalid
+}
+
+// Checks the batch equation for entries. It fails if any signature is
+// malformed, or can't be drawn a random zᵢ for.
+func equation(entries []Entry) bool {
+	scalars := make([]*edwards25519.Scalar, 0, 2*len(entries)+1)
+	points := make([]*edwards25519.Point, 0, 2*len(entries)+1)
+
+	// -Σ zᵢsᵢ, negated once summed
+	sum := edwards25519.NewScalar()
+	scalars = append(scalars, sum)
+	points = append(points, edwards25519.NewGeneratorPoint())
+
+	random := make([]byte, 16*len(entries))
+	if _, err := rand.Read(random); err != nil {
+		return false
+	}
+
+	var zBytes [32]byte
+	for i := range entries {
+		A, R, s, k, ok := entries[i].decode()
+		if !ok {
+			return false
+		}
+
+		// Below 2¹²⁸, so always canonical
+		copy(zBytes[:16], random[16*i:])
+		z, err := edwards25519.NewScalar().SetCanonicalBytes(zBytes[:])
+		if err != nil {
+			return false
+		}
+
+		sum.MultiplyAdd(z, s, sum)
+		scalars = append(scalars, z, edwards25519.NewScalar().Multiply(z, k))
+		points = append(points, R, A)
+	}
+
+	sum.Negate(sum)
+
+	check := new(edwards25519.Point).VarTimeMultiScalarMult(scalars, points)
+	check.MultByCofactor(check)
+
+	return check.Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// Verifies each signature again, none being skipped, to find all the invalid
+// ones.
+func (b *Batch) pinpoint() []int {
+	valid := make([]bool, len(b.entries))
+	parallel(len(b.entries), func(i int) bool {
+		valid[i] = b.entries[i].verify()
+		return true
+	})
+
+	invalid := []int{}
+	for i, ok := range valid {
+		if !ok {
+			invalid = append(invalid, i)
+		}
+	}
+
+	return invalid
+}
+
+// Calls fn with each index below n from GOMAXPROCS goroutines, until fn
+// returns false.
+func parallel(n int, fn func(i int) bool) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n || !fn(i) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"crypto-conditions"
+)
+
+func inspect(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("inspect", stderr)
+	asJSON := fs.Bool("json", false, "print the tree as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	n, err := CryptoConditions.Explain(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		e := json.NewEncoder(stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(n)
+	}
+
+	return n.WriteText(stdout)
+}
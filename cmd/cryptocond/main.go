@@ -0,0 +1,363 @@
+// Command cryptocond creates, inspects and verifies Crypto Conditions.
+//
+// Usage:
+//
+//	cryptocond preimage [-hex] <preimage>
+//	cryptocond ed25519 sign -key <hex> [-message <text> | -message-hex <hex>] [-message-id <hex>]
+//	cryptocond threshold build -threshold <n> [<weight>*]<cf:...|cc:...> ...
+//	cryptocond derive <cf:...>
+//	cryptocond verify [-message <text> | -message-hex <hex>] <cf:...> <cc:...|ni:...>
+//	cryptocond inspect [-json] <cf:...|cc:...|ni:...>
+//
+// Commands creating a fulfillment print it along with its condition in the
+// string and URI formats. Verify exits with status 1 if the fulfillment
+// doesn't satisfy the condition, and inspect prints the decoded tree of a
+// fulfillment or condition.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"crypto-conditions"
+	"crypto-conditions/ed25519sha256"
+	"crypto-conditions/registry"
+	"crypto-conditions/sha256"
+	"crypto-conditions/thresholdSha256"
+	"golang.org/x/crypto/ed25519"
+)
+
+const usage = `usage: cryptocond <command> [flags] [args]
+
+commands:
+  preimage [-hex] <preimage>              make a preimage fulfillment
+  ed25519 sign -key <hex> ...             make a signed Ed25519 fulfillment
+  threshold build -threshold <n> ...      make a threshold fulfillment
+  derive <cf:...>                         print the condition of a fulfillment
+  verify <cf:...> <cc:...|ni:...>         check a fulfillment against a condition
+  inspect [-json] <cf:...|cc:...|ni:...>  print the decoded tree
+
+Run cryptocond <command> -h for the flags of a command.
+`
+
+// Raised by commands given the wrong arguments, to print their usage
+var errUsage = errors.New("invalid arguments")
+
+type command func(args []string, stdout io.Writer, stderr io.Writer) error
+
+var commands = map[string]command{
+	"preimage":  preimage,
+	"ed25519":   subcommands("ed25519", map[string]command{"sign": ed25519Sign}),
+	"threshold": subcommands("threshold", map[string]command{"build": thresholdBuild}),
+	"derive":    derive,
+	"verify":    verify,
+	"inspect":   inspect,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Runs the command line and returns the exit status: 0 on success, 1 if a
+// fulfillment failed to verify and 2 on any other error.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "cryptocond: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	err := cmd(args[1:], stdout, stderr)
+	switch err {
+	case nil:
+		return 0
+	case flag.ErrHelp:
+		return 0
+	case errUsage:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	if _, ok := err.(invalidError); ok {
+		fmt.Fprintln(stdout, err)
+		return 1
+	}
+
+	fmt.Fprintln(stderr, "cryptocond:", err)
+	return 2
+}
+
+// Dispatches to the subcommands of a command, such as "ed25519 sign".
+func subcommands(name string, subs map[string]command) command {
+	return func(args []string, stdout io.Writer, stderr io.Writer) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+
+		sub, ok := subs[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown command %q", name+" "+args[0])
+		}
+
+		return sub(args[1:], stdout, stderr)
+	}
+}
+
+// Returns a flag set that reports its errors to the caller rather than
+// exiting, and prints its usage to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("cryptocond "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// Registers the -message and -message-hex flags, and returns a function
+// reading the message they give.
+func messageFlags(fs *flag.FlagSet) func() ([]byte, error) {
+	text := fs.String("message", "", "message, as text")
+	hexText := fs.String("message-hex", "", "message, in hex")
+
+	return func() ([]byte, error) {
+		if *text != "" && *hexText != "" {
+			return nil, errors.New("-message and -message-hex are exclusive")
+		}
+		if *hexText != "" {
+			return hex.DecodeString(*hexText)
+		}
+		return []byte(*text), nil
+	}
+}
+
+// Prints a fulfillment along with its condition.
+func printFulfillment(stdout io.Writer, ful CryptoConditions.Fulfillment) error {
+	cond, err := CryptoConditions.ConditionOf(ful)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, "fulfillment:", ful.Serialize())
+	printCondition(stdout, cond)
+	return nil
+}
+
+func printCondition(stdout io.Writer, cond CryptoConditions.Condition) {
+	fmt.Fprintln(stdout, "condition:  ", cond.Serialize())
+	fmt.Fprintln(stdout, "uri:        ", cond.URI())
+}
+
+func preimage(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("preimage", stderr)
+	isHex := fs.Bool("hex", false, "preimage is given in hex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	p := []byte(fs.Arg(0))
+	if *isHex {
+		var err error
+		if p, err = hex.DecodeString(fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	return printFulfillment(stdout, &Sha256.Fulfillment{Preimage: p})
+}
+
+// Signs the message as the FixedMessage of an Ed25519 fulfillment. The key is
+// either a 64-byte private key or the 32-byte seed it is derived from.
+func ed25519Sign(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("ed25519 sign", stderr)
+	key := fs.String("key", "", "private key or seed, in hex")
+	messageId := fs.String("message-id", "", "message id, in hex")
+	message := messageFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *key == "" {
+		return errUsage
+	}
+
+	privkey, err := hex.DecodeString(*key)
+	if err != nil {
+		return err
+	}
+	switch len(privkey) {
+	case ed25519.PrivateKeySize:
+	case 32:
+		_, privkey, err = ed25519.GenerateKey(bytes.NewReader(privkey))
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("key must be a 64-byte private key or a 32-byte seed")
+	}
+
+	id, err := hex.DecodeString(*messageId)
+	if err != nil {
+		return err
+	}
+
+	msg, err := message()
+	if err != nil {
+		return err
+	}
+
+	ful := &Ed25519Sha256.Fulfillment{
+		PublicKey:    privkey[32:],
+		MessageId:    id,
+		FixedMessage: msg,
+	}
+	ful.Sign(privkey)
+
+	return printFulfillment(stdout, ful)
+}
+
+// Parses a threshold argument: a fulfillment or condition string, optionally
+// prefixed by its weight and "*".
+func parseWeighted(arg string) (ThresholdSha256.WeightedString, error) {
+	ws := ThresholdSha256.WeightedString{Weight: 1}
+
+	if i := strings.Index(arg, "*"); i >= 0 {
+		w, err := strconv.ParseUint(arg[:i], 10, 32)
+		if err != nil {
+			return ws, fmt.Errorf("invalid weight %q", arg[:i])
+		}
+		ws.Weight = uint32(w)
+		arg = arg[i+1:]
+	}
+
+	ws.String = []byte(arg)
+	return ws, nil
+}
+
+// Builds the smallest threshold fulfillment out of the given fulfillments and
+// conditions, which can be of any type.
+func thresholdBuild(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("threshold build", stderr)
+	threshold := fs.Uint("threshold", 0, "weight the fulfillments must add up to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || *threshold == 0 {
+		return errUsage
+	}
+
+	fulfillments := ThresholdSha256.WeightedStrings{}
+	conditions := ThresholdSha256.WeightedStrings{}
+	for _, arg := range fs.Args() {
+		ws, err := parseWeighted(arg)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(string(ws.String), "cc:") {
+			if _, err := CryptoConditions.ParseCondition(string(ws.String)); err != nil {
+				return err
+			}
+			conditions = append(conditions, ws)
+		} else {
+			if _, err := registry.ParseFulfillmentUnverified(string(ws.String)); err != nil {
+				return err
+			}
+			fulfillments = append(fulfillments, ws)
+		}
+	}
+
+	ful, err := ThresholdSha256.BuildFulfillment(uint32(*threshold), fulfillments, conditions)
+	if err != nil {
+		return err
+	}
+
+	return printFulfillment(stdout, ful)
+}
+
+func derive(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("derive", stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	ful, err := registry.ParseFulfillmentUnverified(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cond, err := CryptoConditions.ConditionOf(ful)
+	if err != nil {
+		return err
+	}
+
+	printCondition(stdout, cond)
+	return nil
+}
+
+// Parses a condition in either the string or the URI format.
+func parseCondition(s string) (CryptoConditions.Condition, error) {
+	if strings.HasPrefix(s, "ni:") {
+		return CryptoConditions.ParseConditionURI(s)
+	}
+	return CryptoConditions.ParseCondition(s)
+}
+
+// Reports a fulfillment that doesn't satisfy its condition, as opposed to
+// arguments that don't parse.
+type invalidError struct {
+	err error
+}
+
+func (e invalidError) Error() string {
+	return "invalid: " + e.err.Error()
+}
+
+func verify(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("verify", stderr)
+	message := messageFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+
+	msg, err := message()
+	if err != nil {
+		return err
+	}
+
+	ful, err := registry.ParseFulfillmentUnverified(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cond, err := parseCondition(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	// Signatures are verified here, so that bad ones are reported as invalid
+	// rather than as fulfillments that don't parse
+	if err := registry.Validate(ful, cond, msg); err != nil {
+		return invalidError{err}
+	}
+
+	fmt.Fprintln(stdout, "valid")
+	return nil
+}
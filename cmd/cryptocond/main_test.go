@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"crypto-conditions/ed25519sha256"
+	"crypto-conditions/sha256"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestRun(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, 32)
+	_, privkey, err := ed25519.GenerateKey(bytes.NewReader(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preimageFul := &Sha256.Fulfillment{Preimage: []byte("secret")}
+	preimageCond := preimageFul.Condition()
+	otherCond := (&Sha256.Fulfillment{Preimage: []byte("other")}).Condition()
+
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:    privkey[32:],
+		FixedMessage: []byte("hello"),
+	}
+	edFul.Sign(privkey)
+	edCond := edFul.Condition()
+	forged := *edFul
+	forged.Signature = make([]byte, ed25519.SignatureSize)
+
+	for _, test := range []struct {
+		args   []string
+		status int
+		// Substrings of the output
+		stdout string
+		stderr string
+	}{
+		{nil, 2, "", "usage: cryptocond"},
+		{[]string{"nope"}, 2, "", `unknown command "nope"`},
+		{[]string{"ed25519", "nope"}, 2, "", `cryptocond: unknown command "ed25519 nope"`},
+		{[]string{"preimage", "-h"}, 0, "", "-hex"},
+		{[]string{"preimage"}, 2, "", "usage: cryptocond"},
+
+		{[]string{"preimage", "secret"}, 0, "fulfillment: " + preimageFul.Serialize() + "\ncondition:   " + preimageCond.Serialize() + "\nuri:         " + preimageCond.URI() + "\n", ""},
+		{[]string{"preimage", "-hex", "736563726574"}, 0, "fulfillment: " + preimageFul.Serialize() + "\n", ""},
+		{[]string{"ed25519", "sign", "-key", strings.Repeat("01", 32), "-message", "hello"}, 0, "fulfillment: " + edFul.Serialize() + "\n", ""},
+		{[]string{"threshold", "build", "-threshold", "1", "2*" + preimageFul.Serialize(), otherCond.Serialize()}, 0, "fulfillment: cf:1:4:", ""},
+		{[]string{"threshold", "build", "-threshold", "3", "2*" + preimageFul.Serialize()}, 2, "", "cryptocond: not enough fulfillments"},
+
+		{[]string{"derive", preimageFul.Serialize()}, 0, "condition:   " + preimageCond.Serialize() + "\n", ""},
+		{[]string{"derive", forged.Serialize()}, 0, "condition:   " + edCond.Serialize() + "\n", ""},
+
+		{[]string{"verify", preimageFul.Serialize(), preimageCond.Serialize()}, 0, "valid\n", ""},
+		{[]string{"verify", preimageFul.Serialize(), preimageCond.URI()}, 0, "valid\n", ""},
+		{[]string{"verify", edFul.Serialize(), edCond.Serialize()}, 0, "valid\n", ""},
+		{[]string{"verify", preimageFul.Serialize(), otherCond.Serialize()}, 1, "invalid: fulfillment doesn't match condition fingerprint\n", ""},
+		{[]string{"verify", forged.Serialize(), edCond.Serialize()}, 1, "invalid: signature not valid\n", ""},
+		{[]string{"verify", "cf:1:1:!", preimageCond.Serialize()}, 2, "", "cryptocond: "},
+		{[]string{"verify", preimageFul.Serialize()}, 2, "", "usage: cryptocond"},
+
+		{[]string{"inspect", preimageCond.URI()}, 0, "condition legacy-preimage-sha-256\n", ""},
+		{[]string{"inspect", edFul.Serialize()}, 0, "  signature valid: true\n", ""},
+		{[]string{"inspect", forged.Serialize()}, 0, "  signature valid: false\n", ""},
+		{[]string{"inspect", "-json", forged.Serialize()}, 0, `"signature valid": "false"`, ""},
+		{[]string{"inspect", "cf:1:1:!"}, 2, "", "cryptocond: "},
+	} {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, &stdout, &stderr)
+
+		if status != test.status {
+			t.Errorf("%q exited with %d, want %d\nstdout: %s\nstderr: %s", test.args, status, test.status, stdout.String(), stderr.String())
+		}
+		if !strings.Contains(stdout.String(), test.stdout) {
+			t.Errorf("%q printed %q, want %q", test.args, stdout.String(), test.stdout)
+		}
+		if !strings.Contains(stderr.String(), test.stderr) {
+			t.Errorf("%q printed %q to stderr, want %q", test.args, stderr.String(), test.stderr)
+		}
+		if test.stderr == "" && stderr.Len() != 0 {
+			t.Errorf("%q printed %q to stderr", test.args, stderr.String())
+		}
+	}
+}
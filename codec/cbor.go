@@ -0,0 +1,290 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"unicode/utf8"
+
+	"crypto-conditions/encoding"
+)
+
+// Fulfillments and conditions are CBOR arrays holding the DER tag of their
+// type followed by the fields of its schema, in order: byte strings, text
+// strings, unsigned integers (KindUint and KindBits), booleans, nested arrays
+// for fulfillments and conditions, and arrays of arrays of fields for
+// KindSequenceOf. Only definite lengths in their shortest form are accepted,
+// as in the deterministic encoding of RFC 8949, so that every fulfillment and
+// condition has a single CBOR encoding.
+
+// CBOR major types
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+)
+
+const (
+	cborFalse = 0xf4
+	cborTrue  = 0xf5
+)
+
+func encodeCBOR(c *choice) ([]byte, error) {
+	return appendCBORChoice(nil, c), nil
+}
+
+func decodeCBOR(b []byte, isCondition bool) (*choice, error) {
+	r := &cborReader{b: b}
+
+	c, err := r.choice(isCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.b) != 0 {
+		return nil, errors.New("trailing data after CBOR value")
+	}
+
+	return c, nil
+}
+
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major<<5|27), n)
+}
+
+func appendCBORChoice(b []byte, c *choice) []byte {
+	b = appendCBORHead(b, cborArray, uint64(len(c.fields)+1))
+	b = appendCBORHead(b, cborUint, uint64(c.typ.DERTag))
+	return appendCBORFields(b, c.fields, c.schema)
+}
+
+func appendCBORFields(b []byte, fields []interface{}, schema encoding.Schema) []byte {
+	for i, f := range schema {
+		switch v := fields[i].(type) {
+		case []byte:
+			b = append(appendCBORHead(b, cborBytes, uint64(len(v))), v...)
+		case string:
+			b = append(appendCBORHead(b, cborText, uint64(len(v))), v...)
+		case uint64:
+			b = appendCBORHead(b, cborUint, v)
+		case uint32:
+			b = appendCBORHead(b, cborUint, uint64(v))
+		case bool:
+			if v {
+				b = append(b, cborTrue)
+			} else {
+				b = append(b, cborFalse)
+			}
+		case *choice:
+			b = appendCBORChoice(b, v)
+		case [][]interface{}:
+			b = appendCBORHead(b, cborArray, uint64(len(v)))
+			for _, el := range v {
+				b = appendCBORHead(b, cborArray, uint64(len(el)))
+				b = appendCBORFields(b, el, f.Elem)
+			}
+		}
+	}
+
+	return b
+}
+
+var errCBORTruncated = errors.New("truncated CBOR value")
+
+type cborReader struct {
+	b []byte
+}
+
+// Reads the head of a data item of the given major type, and returns its
+// argument.
+func (r *cborReader) head(major byte) (uint64, error) {
+	if len(r.b) == 0 {
+		return 0, errCBORTruncated
+	}
+
+	if r.b[0]>>5 != major {
+		return 0, errors.New("unexpected CBOR major type")
+	}
+
+	info := r.b[0] & 0x1f
+	r.b = r.b[1:]
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, errors.New("unsupported CBOR length")
+	}
+
+	size := 1 << (info - 24)
+	if len(r.b) < size {
+		return 0, errCBORTruncated
+	}
+
+	var n, min uint64
+	switch size {
+	case 1:
+		n, min = uint64(r.b[0]), 24
+	case 2:
+		n, min = uint64(binary.BigEndian.Uint16(r.b)), math.MaxUint8+1
+	case 4:
+		n, min = uint64(binary.BigEndian.Uint32(r.b)), math.MaxUint16+1
+	case 8:
+		n, min = binary.BigEndian.Uint64(r.b), math.MaxUint32+1
+	}
+	r.b = r.b[size:]
+
+	if n < min {
+		return 0, errors.New("CBOR head not in its shortest form")
+	}
+
+	return n, nil
+}
+
+func (r *cborReader) bytes(major byte) ([]byte, error) {
+	n, err := r.head(major)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > uint64(len(r.b)) {
+		return nil, errCBORTruncated
+	}
+
+	b := append([]byte{}, r.b[:n]...)
+	r.b = r.b[n:]
+	return b, nil
+}
+
+func (r *cborReader) bool() (bool, error) {
+	if len(r.b) == 0 {
+		return false, errCBORTruncated
+	}
+
+	v := r.b[0]
+	if v != cborFalse && v != cborTrue {
+		return false, errors.New("expected a CBOR boolean")
+	}
+
+	r.b = r.b[1:]
+	return v == cborTrue, nil
+}
+
+func (r *cborReader) choice(isCondition bool) (*choice, error) {
+	n, err := r.head(cborArray)
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		return nil, errors.New("CBOR array has no condition type")
+	}
+
+	tag, err := r.head(cborUint)
+	if err != nil {
+		return nil, err
+	}
+	if tag > math.MaxInt32 {
+		return nil, errNotSupported
+	}
+
+	t, schema, err := typeOf(int(tag), isCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	if n-1 != uint64(len(schema)) {
+		return nil, errors.New("wrong number of CBOR fields for " + t.Name)
+	}
+
+	fields, err := r.fields(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &choice{typ: t, schema: schema, fields: fields}, nil
+}
+
+func (r *cborReader) fields(schema encoding.Schema) ([]interface{}, error) {
+	fields := make([]interface{}, len(schema))
+
+	for i, f := range schema {
+		var err error
+		switch f.Kind {
+		case encoding.KindBytes:
+			fields[i], err = r.bytes(cborBytes)
+
+		case encoding.KindString:
+			var b []byte
+			b, err = r.bytes(cborText)
+			if err == nil && !utf8.Valid(b) {
+				err = errors.New("invalid UTF-8 in " + f.Name)
+			}
+			fields[i] = string(b)
+
+		case encoding.KindUint:
+			fields[i], err = r.head(cborUint)
+
+		case encoding.KindBool:
+			fields[i], err = r.bool()
+
+		case encoding.KindBits:
+			var v uint64
+			v, err = r.head(cborUint)
+			if err == nil && v > math.MaxUint32 {
+				err = errors.New(f.Name + " out of range")
+			}
+			fields[i] = uint32(v)
+
+		case encoding.KindFulfillment, encoding.KindCondition:
+			fields[i], err = r.choice(f.Kind == encoding.KindCondition)
+
+		case encoding.KindSequenceOf:
+			fields[i], err = r.sequenceOf(f)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+func (r *cborReader) sequenceOf(f encoding.Field) ([][]interface{}, error) {
+	n, err := r.head(cborArray)
+	if err != nil {
+		return nil, err
+	}
+
+	elems := [][]interface{}{}
+	for i := uint64(0); i < n; i++ {
+		m, err := r.head(cborArray)
+		if err != nil {
+			return nil, err
+		}
+
+		if m != uint64(len(f.Elem)) {
+			return nil, errors.New("wrong number of CBOR fields in " + f.Name)
+		}
+
+		el, err := r.fields(f.Elem)
+		if err != nil {
+			return nil, err
+		}
+
+		elems = append(elems, el)
+	}
+
+	return elems, nil
+}
@@ -0,0 +1,253 @@
+// Codecs encoding fulfillments and conditions of any registered type to
+// bytes, in the Crypto Conditions string format, DER, JSON, Protocol Buffers
+// or CBOR. Every codec decodes to the same in-memory fulfillments and
+// conditions, hence the same fingerprints.
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/registry"
+)
+
+// Codec encodes fulfillments and conditions of any registered type, and
+// decodes them dispatching on their type.
+type Codec interface {
+	// Name of the codec, as given to ByName
+	Name() string
+
+	EncodeFulfillment(ful registry.Fulfillment) ([]byte, error)
+	DecodeFulfillment(b []byte) (registry.Fulfillment, error)
+	EncodeCondition(cond registry.Condition) ([]byte, error)
+	DecodeCondition(b []byte) (registry.Condition, error)
+}
+
+var (
+	// The Crypto Conditions string format, "cf:..." and "cc:..."
+	String Codec = stringCodec{}
+	// The DER binary format of the crypto-conditions spec
+	DER Codec = derCodec{}
+	// JSON objects with a type field, as marshaled by the condition types
+	JSON Codec = jsonCodec{}
+	// Protocol Buffers, as described by cryptoconditions.proto
+	Protobuf Codec = &transcoder{name: "protobuf", encode: encodeProtobuf, decode: decodeProtobuf}
+	// CBOR arrays mirroring the DER binary format, see cbor.go
+	CBOR Codec = &transcoder{name: "cbor", encode: encodeCBOR, decode: decodeCBOR}
+)
+
+// Codecs returns every codec.
+func Codecs() []Codec {
+	return []Codec{String, DER, JSON, Protobuf, CBOR}
+}
+
+// ByName returns the codec with the given name, such as "protobuf", or nil.
+func ByName(name string) Codec {
+	for _, c := range Codecs() {
+		if c.Name() == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Name() string { return "string" }
+
+func (stringCodec) EncodeFulfillment(ful registry.Fulfillment) ([]byte, error) {
+	if err := checkFulfillment(ful); err != nil {
+		return nil, err
+	}
+
+	return []byte(ful.Serialize()), nil
+}
+
+func (stringCodec) DecodeFulfillment(b []byte) (registry.Fulfillment, error) {
+	return registry.ParseFulfillment(string(b))
+}
+
+func (stringCodec) EncodeCondition(cond registry.Condition) ([]byte, error) {
+	if err := checkCondition(cond); err != nil {
+		return nil, err
+	}
+
+	return []byte(cond.Serialize()), nil
+}
+
+func (stringCodec) DecodeCondition(b []byte) (registry.Condition, error) {
+	return registry.ParseCondition(string(b))
+}
+
+type derCodec struct{}
+
+func (derCodec) Name() string { return "der" }
+
+func (derCodec) EncodeFulfillment(ful registry.Fulfillment) ([]byte, error) {
+	if err := checkFulfillment(ful); err != nil {
+		return nil, err
+	}
+
+	return ful.SerializeBinary()
+}
+
+func (derCodec) DecodeFulfillment(b []byte) (registry.Fulfillment, error) {
+	return registry.ParseFulfillmentBinary(b)
+}
+
+func (derCodec) EncodeCondition(cond registry.Condition) ([]byte, error) {
+	if err := checkCondition(cond); err != nil {
+		return nil, err
+	}
+
+	return cond.SerializeBinary()
+}
+
+func (derCodec) DecodeCondition(b []byte) (registry.Condition, error) {
+	return registry.ParseConditionBinary(b)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) EncodeFulfillment(ful registry.Fulfillment) ([]byte, error) {
+	if err := checkFulfillment(ful); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(ful)
+}
+
+func (jsonCodec) DecodeFulfillment(b []byte) (registry.Fulfillment, error) {
+	return registry.UnmarshalFulfillmentJSON(b)
+}
+
+func (jsonCodec) EncodeCondition(cond registry.Condition) ([]byte, error) {
+	if err := checkCondition(cond); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(cond)
+}
+
+func (jsonCodec) DecodeCondition(b []byte) (registry.Condition, error) {
+	return registry.UnmarshalConditionJSON(b)
+}
+
+// Codec transcoding the DER binary format, so that decoding goes through the
+// DER parsers of the condition types and checks the same things.
+type transcoder struct {
+	name   string
+	encode func(c *choice) ([]byte, error)
+	decode func(b []byte, isCondition bool) (*choice, error)
+}
+
+func (t *transcoder) Name() string { return t.name }
+
+func (t *transcoder) EncodeFulfillment(ful registry.Fulfillment) ([]byte, error) {
+	if err := checkFulfillment(ful); err != nil {
+		return nil, err
+	}
+
+	der, err := ful.SerializeBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := readDER(der, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.encode(c)
+}
+
+func (t *transcoder) DecodeFulfillment(b []byte) (registry.Fulfillment, error) {
+	c, err := t.decode(b, false)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := writeDER(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return registry.ParseFulfillmentBinary(der)
+}
+
+func (t *transcoder) EncodeCondition(cond registry.Condition) ([]byte, error) {
+	if err := checkCondition(cond); err != nil {
+		return nil, err
+	}
+
+	der, err := cond.SerializeBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := readDER(der, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.encode(c)
+}
+
+func (t *transcoder) DecodeCondition(b []byte) (registry.Condition, error) {
+	c, err := t.decode(b, true)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := writeDER(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return registry.ParseConditionBinary(der)
+}
+
+var errNotSupported = errors.New("unsupported condition type")
+
+// Checks that a Fulfillment is of a registered type, which the codecs can
+// decode back. Those of the rfc package aren't, and the DER tags they carry
+// are those of other types in the registry.
+func checkFulfillment(ful registry.Fulfillment) error {
+	if registry.TypeOf(ful) == nil {
+		return errNotSupported
+	}
+
+	return nil
+}
+
+// Checks that a Condition is of a registered type, as checkFulfillment does.
+func checkCondition(cond registry.Condition) error {
+	if registry.TypeOfCondition(cond) == nil {
+		return errNotSupported
+	}
+
+	return nil
+}
+
+// Returns the type with the given DER tag, and its schema for fulfillments
+// or conditions.
+func typeOf(tag int, isCondition bool) (*registry.Type, encoding.Schema, error) {
+	t := registry.ByDERTag(tag)
+	if t == nil {
+		return nil, nil, errNotSupported
+	}
+
+	schema := t.FulfillmentSchema
+	if isCondition {
+		schema = t.ConditionSchema
+	}
+	if schema == nil {
+		return nil, nil, errors.New("no schema for " + t.Name)
+	}
+
+	return t, schema, nil
+}
@@ -0,0 +1,338 @@
+package codec
+
+import (
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"unicode/utf8"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/registry"
+)
+
+// A fulfillment or condition read out of one format to be written in
+// another: its type and the values of the fields of its schema, in order.
+// Each value is a []byte, uint64, string, bool, uint32 (KindBits), *choice
+// (KindFulfillment and KindCondition) or [][]interface{} (KindSequenceOf,
+// the fields of each element), as the Kind of its field.
+type choice struct {
+	typ    *registry.Type
+	schema encoding.Schema
+	fields []interface{}
+}
+
+// Returns the value of a field that is missing from a format leaving out
+// zero values.
+func zero(f encoding.Field) interface{} {
+	switch f.Kind {
+	case encoding.KindBytes:
+		return []byte{}
+	case encoding.KindUint:
+		return uint64(0)
+	case encoding.KindString:
+		return ""
+	case encoding.KindBool:
+		return false
+	case encoding.KindBits:
+		return uint32(0)
+	case encoding.KindSequenceOf:
+		return [][]interface{}{}
+	}
+
+	// Fulfillments and conditions have no zero value
+	return nil
+}
+
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case []byte:
+		return len(v) == 0
+	case uint64:
+		return v == 0
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case uint32:
+		return v == 0
+	case [][]interface{}:
+		return len(v) == 0
+	}
+
+	return v == nil
+}
+
+// Reads the next DER value of b.
+func next(b []byte) (asn1.RawValue, []byte, error) {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &raw)
+	return raw, rest, err
+}
+
+// Reads a fulfillment or condition of any registered type out of its DER
+// encoding.
+func readDER(b []byte, isCondition bool) (*choice, error) {
+	raw, rest, err := next(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after DER value")
+	}
+
+	if raw.Class != asn1.ClassContextSpecific || !raw.IsCompound {
+		return nil, errors.New("DER value is not a choice")
+	}
+
+	t, schema, err := typeOf(raw.Tag, isCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := readSequence(raw.Bytes, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &choice{typ: t, schema: schema, fields: fields}, nil
+}
+
+// Reads the fields of a SEQUENCE out of its DER contents.
+func readSequence(b []byte, schema encoding.Schema) ([]interface{}, error) {
+	fields := make([]interface{}, len(schema))
+
+	for i, f := range schema {
+		if len(b) == 0 {
+			if !f.Optional {
+				return nil, errors.New("missing DER field " + f.Name)
+			}
+			fields[i] = zero(f)
+			continue
+		}
+
+		raw, rest, err := next(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Tag == encoding.Untagged {
+			fields[i], err = readDER(raw.FullBytes, f.Kind == encoding.KindCondition)
+			if err != nil {
+				return nil, err
+			}
+			b = rest
+			continue
+		}
+
+		if raw.Class != asn1.ClassContextSpecific || raw.Tag != f.Tag {
+			if !f.Optional {
+				return nil, errors.New("missing DER field " + f.Name)
+			}
+			fields[i] = zero(f)
+			continue
+		}
+
+		fields[i], err = readValue(raw, f)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("trailing data after DER value")
+	}
+
+	return fields, nil
+}
+
+// Reads the value of a tagged field.
+func readValue(raw asn1.RawValue, f encoding.Field) (interface{}, error) {
+	compound := f.Kind == encoding.KindFulfillment || f.Kind == encoding.KindCondition || f.Kind == encoding.KindSequenceOf
+	if raw.IsCompound != compound {
+		return nil, errors.New("unexpected DER field " + f.Name)
+	}
+
+	switch f.Kind {
+	case encoding.KindBytes:
+		return raw.Bytes, nil
+
+	case encoding.KindUint:
+		var n *big.Int
+		if err := readUniversal(asn1.TagInteger, raw.Bytes, &n); err != nil {
+			return nil, err
+		}
+		return encoding.GetInteger(n)
+
+	case encoding.KindString:
+		if !utf8.Valid(raw.Bytes) {
+			return nil, errors.New("invalid UTF-8 in DER field " + f.Name)
+		}
+		return string(raw.Bytes), nil
+
+	case encoding.KindBool:
+		var v bool
+		err := readUniversal(asn1.TagBoolean, raw.Bytes, &v)
+		return v, err
+
+	case encoding.KindBits:
+		var v asn1.BitString
+		if err := readUniversal(asn1.TagBitString, raw.Bytes, &v); err != nil {
+			return nil, err
+		}
+		return encoding.GetBitString(v)
+
+	case encoding.KindFulfillment, encoding.KindCondition:
+		return readDER(raw.Bytes, f.Kind == encoding.KindCondition)
+
+	case encoding.KindSequenceOf:
+		elems := [][]interface{}{}
+		for b := raw.Bytes; len(b) > 0; {
+			el, rest, err := next(b)
+			if err != nil {
+				return nil, err
+			}
+
+			if el.Class != asn1.ClassUniversal || el.Tag != asn1.TagSequence || !el.IsCompound {
+				return nil, errors.New("unexpected DER element of " + f.Name)
+			}
+
+			fields, err := readSequence(el.Bytes, f.Elem)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, fields)
+			b = rest
+		}
+		return elems, nil
+	}
+
+	return nil, errors.New("unknown kind of field " + f.Name)
+}
+
+// Decodes the contents of an implicitly tagged field as the universal type
+// it stands for.
+func readUniversal(tag int, contents []byte, val interface{}) error {
+	b, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: tag, Bytes: contents})
+	if err != nil {
+		return err
+	}
+
+	rest, err := asn1.Unmarshal(b, val)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data after DER value")
+	}
+
+	return nil
+}
+
+// Writes a fulfillment or condition in the DER binary format. The result
+// isn't checked to be canonical, which the DER parser of the type does.
+func writeDER(c *choice) ([]byte, error) {
+	contents, err := writeSequence(c.fields, c.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        c.typ.DERTag,
+		IsCompound: true,
+		Bytes:      contents,
+	})
+}
+
+// Writes the DER contents of a SEQUENCE.
+func writeSequence(fields []interface{}, schema encoding.Schema) ([]byte, error) {
+	var b []byte
+	for i, f := range schema {
+		if f.Optional && isZero(fields[i]) {
+			continue
+		}
+
+		v, err := writeValue(fields[i], f)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, v...)
+	}
+
+	return b, nil
+}
+
+// Writes a field as a tagged DER value.
+func writeValue(v interface{}, f encoding.Field) ([]byte, error) {
+	tagged := func(compound bool, contents []byte) ([]byte, error) {
+		return asn1.Marshal(asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        f.Tag,
+			IsCompound: compound,
+			Bytes:      contents,
+		})
+	}
+
+	universal := func(val interface{}) ([]byte, error) {
+		b, err := asn1.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, _, err := next(b)
+		if err != nil {
+			return nil, err
+		}
+		return tagged(false, raw.Bytes)
+	}
+
+	switch v := v.(type) {
+	case []byte:
+		return tagged(false, v)
+
+	case uint64:
+		return universal(encoding.MakeInteger(v))
+
+	case string:
+		return tagged(false, []byte(v))
+
+	case bool:
+		return universal(v)
+
+	case uint32:
+		return universal(encoding.MakeBitString(v))
+
+	case *choice:
+		b, err := writeDER(v)
+		if err != nil || f.Tag == encoding.Untagged {
+			return b, err
+		}
+		return tagged(true, b)
+
+	case [][]interface{}:
+		var contents []byte
+		for _, el := range v {
+			seq, err := writeSequence(el, f.Elem)
+			if err != nil {
+				return nil, err
+			}
+
+			b, err := asn1.Marshal(asn1.RawValue{
+				Class:      asn1.ClassUniversal,
+				Tag:        asn1.TagSequence,
+				IsCompound: true,
+				Bytes:      seq,
+			})
+			if err != nil {
+				return nil, err
+			}
+			contents = append(contents, b...)
+		}
+		return tagged(true, contents)
+	}
+
+	return nil, errors.New("missing field " + f.Name)
+}
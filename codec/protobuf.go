@@ -0,0 +1,235 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"unicode/utf8"
+
+	"crypto-conditions/encoding"
+)
+
+// Fulfillments and conditions are Protocol Buffers messages with a oneof
+// field per condition type, numbered after its DER tag plus one, holding a
+// message with the fields of its schema numbered from 1 in order. See
+// cryptoconditions.proto. As usual with Protocol Buffers, zero fields are left
+// out and unknown fields are skipped.
+
+// Protocol Buffers wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func encodeProtobuf(c *choice) ([]byte, error) {
+	return appendProtoChoice(nil, c), nil
+}
+
+func decodeProtobuf(b []byte, isCondition bool) (*choice, error) {
+	return parseProtoChoice(b, isCondition)
+}
+
+func appendProtoKey(b []byte, number int, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(number)<<3|uint64(wire))
+}
+
+func appendProtoVarint(b []byte, number int, v uint64) []byte {
+	b = appendProtoKey(b, number, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, number int, v []byte) []byte {
+	b = appendProtoKey(b, number, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendProtoChoice(b []byte, c *choice) []byte {
+	return appendProtoBytes(b, c.typ.DERTag+1, appendProtoFields(nil, c.fields, c.schema))
+}
+
+func appendProtoFields(b []byte, fields []interface{}, schema encoding.Schema) []byte {
+	for i, f := range schema {
+		number := i + 1
+
+		switch v := fields[i].(type) {
+		case []byte:
+			if len(v) > 0 {
+				b = appendProtoBytes(b, number, v)
+			}
+		case string:
+			if v != "" {
+				b = appendProtoBytes(b, number, []byte(v))
+			}
+		case uint64:
+			if v != 0 {
+				b = appendProtoVarint(b, number, v)
+			}
+		case uint32:
+			if v != 0 {
+				b = appendProtoVarint(b, number, uint64(v))
+			}
+		case bool:
+			if v {
+				b = appendProtoVarint(b, number, 1)
+			}
+		case *choice:
+			b = appendProtoBytes(b, number, appendProtoChoice(nil, v))
+		case [][]interface{}:
+			for _, el := range v {
+				b = appendProtoBytes(b, number, appendProtoFields(nil, el, f.Elem))
+			}
+		}
+	}
+
+	return b
+}
+
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// Calls fn with each field of a message: its number, its wire type and
+// either its varint value or its bytes.
+func eachProtoField(b []byte, fn func(number int, wire int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		b = b[n:]
+
+		if key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return errors.New("invalid protobuf field number")
+		}
+		number, wire := int(key>>3), int(key&7)
+
+		var v uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errProtoTruncated
+			}
+			b = b[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errProtoTruncated
+			}
+			b = b[size:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return errProtoTruncated
+			}
+			data = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			return errors.New("unsupported protobuf wire type")
+		}
+
+		if err := fn(number, wire, v, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Parses a Fulfillment or Condition message. Of several types set, the last
+// one wins, as with any oneof.
+func parseProtoChoice(b []byte, isCondition bool) (*choice, error) {
+	var c *choice
+	err := eachProtoField(b, func(number int, wire int, v uint64, data []byte) error {
+		if wire != wireBytes {
+			return errors.New("unexpected protobuf wire type")
+		}
+
+		t, schema, err := typeOf(number-1, isCondition)
+		if err != nil {
+			return err
+		}
+
+		fields, err := parseProtoFields(data, schema)
+		if err != nil {
+			return err
+		}
+
+		c = &choice{typ: t, schema: schema, fields: fields}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		return nil, errors.New("protobuf message has no condition type")
+	}
+
+	return c, nil
+}
+
+func parseProtoFields(b []byte, schema encoding.Schema) ([]interface{}, error) {
+	fields := make([]interface{}, len(schema))
+	for i, f := range schema {
+		fields[i] = zero(f)
+	}
+
+	err := eachProtoField(b, func(number int, wire int, v uint64, data []byte) error {
+		if number > len(schema) {
+			return nil
+		}
+		f := schema[number-1]
+
+		want := wireBytes
+		if f.Kind == encoding.KindUint || f.Kind == encoding.KindBool || f.Kind == encoding.KindBits {
+			want = wireVarint
+		}
+		if wire != want {
+			return errors.New("unexpected protobuf wire type for " + f.Name)
+		}
+
+		var err error
+		switch f.Kind {
+		case encoding.KindBytes:
+			fields[number-1] = append([]byte{}, data...)
+		case encoding.KindString:
+			if !utf8.Valid(data) {
+				return errors.New("invalid UTF-8 in " + f.Name)
+			}
+			fields[number-1] = string(data)
+		case encoding.KindUint:
+			fields[number-1] = v
+		case encoding.KindBool:
+			fields[number-1] = v != 0
+		case encoding.KindBits:
+			if v > math.MaxUint32 {
+				return errors.New(f.Name + " out of range")
+			}
+			fields[number-1] = uint32(v)
+		case encoding.KindFulfillment, encoding.KindCondition:
+			fields[number-1], err = parseProtoChoice(data, f.Kind == encoding.KindCondition)
+		case encoding.KindSequenceOf:
+			var el []interface{}
+			el, err = parseProtoFields(data, f.Elem)
+			fields[number-1] = append(fields[number-1].([][]interface{}), el)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, f := range schema {
+		if fields[i] == nil {
+			return nil, errors.New("missing protobuf field " + f.Name)
+		}
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,334 @@
+// Generates and parses ECDSA-P256-Sha256 Crypto Conditions
+package EcdsaP256Sha256
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Lengths of a compressed P-256 public key and of a signature, the r and s
+// values each padded to 32 bytes
+const (
+	PublicKeySize = 33
+	SignatureSize = 64
+)
+
+// Fulfillment holds a compressed P-256 public key and an ECDSA signature of
+// the SHA-256 hash of the message.
+type Fulfillment struct {
+	PublicKey []byte
+	Signature []byte
+}
+
+// Serializes to the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) Serialize() string {
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
+
+// Appends the Crypto Conditions Fulfillment string format to dst, without
+// allocating if dst has room for SerializedLength more bytes.
+func (ful *Fulfillment) AppendSerialize(dst []byte) []byte {
+	a := encoding.NewBase64Appender(append(dst, "cf:1:32:"...))
+	a.AppendVarbyte(ful.PublicKey)
+	a.AppendVarbyte(ful.Signature)
+	return a.Finish()
+}
+
+// Returns the length of the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) SerializedLength() int {
+	payload := encoding.VarbyteLength(uint64(len(ful.PublicKey))) +
+		encoding.VarbyteLength(uint64(len(ful.Signature)))
+
+	return len("cf:1:32:") + int(encoding.Base64Length(payload))
+}
+
+// Signs the message with a P-256 private key, setting the PublicKey to that of the key.
+func (ful *Fulfillment) Sign(privkey *ecdsa.PrivateKey, message []byte) error {
+	if privkey.Curve != elliptic.P256() {
+		return errors.New("key must be on the P-256 curve")
+	}
+
+	hash := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, privkey, hash[:])
+	if err != nil {
+		return err
+	}
+
+	signature := make([]byte, SignatureSize)
+	r.FillBytes(signature[:SignatureSize/2])
+	s.FillBytes(signature[SignatureSize/2:])
+
+	ful.PublicKey = elliptic.MarshalCompressed(elliptic.P256(), privkey.X, privkey.Y)
+	ful.Signature = signature
+	return nil
+}
+
+// Parses Fulfillment out of the Crypto Conditions string format, and checks
+// its public key and signature lengths. The signature can only be checked
+// against a message, when validating.
+func ParseFulfillment(s string) (*Fulfillment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cf" {
+		return nil, errors.New("fulfillments must start with \"cf\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "32" {
+		return nil, errors.New("not an EcdsaP256Sha256 condition")
+	}
+
+	b, err := base64.URLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.New("parsing error")
+	}
+
+	pubkey, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("parsing error")
+	}
+
+	ful := &Fulfillment{
+		PublicKey: pubkey,
+		Signature: signature,
+	}
+
+	if err := ful.check(); err != nil {
+		return nil, err
+	}
+
+	return ful, nil
+}
+
+// Checks the public key and signature lengths.
+func (ful *Fulfillment) check() error {
+	if len(ful.PublicKey) != PublicKeySize {
+		return errors.New("public key must be 33 bytes")
+	}
+
+	if len(ful.Signature) != SignatureSize {
+		return errors.New("signature must be 64 bytes")
+	}
+
+	return nil
+}
+
+// Checks the signature of the message, rejecting public keys that are not
+// points of the curve.
+func (ful *Fulfillment) verify(message []byte) bool {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), ful.PublicKey)
+	if x == nil || len(ful.Signature) != SignatureSize {
+		return false
+	}
+
+	pubkey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     x,
+		Y:     y,
+	}
+
+	r := new(big.Int).SetBytes(ful.Signature[:SignatureSize/2])
+	s := new(big.Int).SetBytes(ful.Signature[SignatureSize/2:])
+
+	hash := sha256.Sum256(message)
+	return ecdsa.Verify(pubkey, hash[:], r, s)
+}
+
+// Cost of every EcdsaP256Sha256 condition, that of Ed25519Sha256 conditions,
+// whose signatures take about as long to verify
+const FixedCost = 131072
+
+// Length of every EcdsaP256Sha256 fulfillment, the public key and signature
+// having fixed lengths
+var fulfillmentLength = uint64(len("cf:1:32:")) +
+	encoding.Base64Length(encoding.VarbyteLength(PublicKeySize)+encoding.VarbyteLength(SignatureSize))
+
+// Turns an in-memory Fulfillment to an in-memory Condition. The fingerprint
+// commits to the compressed PublicKey.
+func (ful *Fulfillment) Condition() Condition {
+	hash := sha256.Sum256(bytes.Join([][]byte{
+		encoding.MakeVarbyte(ful.PublicKey),
+	}, []byte{}))
+
+	return Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: fulfillmentLength,
+		Cost:                 FixedCost,
+	}
+}
+
+// Conditions parsed from the named-information URI format have no
+// MaxFulfillmentLength, which is then set to the largest uint64.
+type Condition struct {
+	Hash                 [32]byte
+	MaxFulfillmentLength uint64
+	Cost                 uint64
+}
+
+// Serializes to the Crypto Conditions string format.
+func (cond *Condition) Serialize() string {
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	return encoding.AppendCondition(dst, "32", cond.Hash[:], cond.MaxFulfillmentLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return encoding.ConditionLength("32", cond.MaxFulfillmentLength)
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "32" {
+		return nil, errors.New("not an EcdsaP256Sha256 condition")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max fulfillment length")
+	}
+
+	cond := &Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: length,
+		Cost:                 FixedCost,
+	}
+
+	return cond, nil
+}
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:        encoding.EcdsaP256Sha256Name,
+		Fingerprint: cond.Hash,
+		Cost:        cond.Cost,
+	}
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.EcdsaP256Sha256Name {
+		return nil, errors.New("not an EcdsaP256Sha256 condition")
+	}
+
+	if u.Cost != FixedCost {
+		return nil, errors.New("invalid cost")
+	}
+
+	cond := &Condition{
+		Hash:                 u.Fingerprint,
+		MaxFulfillmentLength: math.MaxUint64,
+		Cost:                 u.Cost,
+	}
+
+	return cond, nil
+}
+
+func FulfillmentToCondition(s string) (string, error) {
+	ful, err := ParseFulfillment(s)
+	if err != nil {
+		return "", err
+	}
+
+	cond := ful.Condition()
+
+	condString := cond.Serialize()
+	return condString, nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition: the public key
+// must hash to the Condition's fingerprint, the fulfillment must fit the
+// Condition's MaxFulfillmentLength and Cost, and the signature must be a
+// valid signature of the message.
+func (ful *Fulfillment) Validate(cond *Condition, message []byte) error {
+	derived := ful.Condition()
+	if derived.Hash != cond.Hash {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if uint64(ful.SerializedLength()) > cond.MaxFulfillmentLength {
+		return validation.ErrFulfillmentTooLong
+	}
+
+	if derived.Cost > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	if !ful.verify(message) {
+		return validation.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
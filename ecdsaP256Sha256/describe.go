@@ -0,0 +1,24 @@
+package EcdsaP256Sha256
+
+import (
+	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+)
+
+// Describes the Fulfillment and the fingerprint of its Condition.
+func (ful *Fulfillment) Describe() *explain.Node {
+	n := explain.Fulfillment(encoding.EcdsaP256Sha256Name)
+	n.Bytes("public key", ful.PublicKey)
+	n.Bytes("signature", ful.Signature)
+
+	cond := ful.Condition()
+	return n.Bytes("fingerprint", cond.Hash[:])
+}
+
+// Describes the Condition.
+func (cond *Condition) Describe() *explain.Node {
+	return explain.Condition(encoding.EcdsaP256Sha256Name).
+		Bytes("fingerprint", cond.Hash[:]).
+		Limit("max fulfillment length", cond.MaxFulfillmentLength).
+		Limit("cost", cond.Cost)
+}
@@ -0,0 +1,91 @@
+package EcdsaP256Sha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+)
+
+type jsonFulfillment struct {
+	Type      string             `json:"type"`
+	PublicKey encoding.JSONBytes `json:"publicKey"`
+	Signature encoding.JSONBytes `json:"signature"`
+}
+
+// Marshals to JSON as {"type", "publicKey", "signature"}.
+func (ful *Fulfillment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFulfillment{
+		Type:      encoding.EcdsaP256Sha256Name,
+		PublicKey: ful.PublicKey,
+		Signature: ful.Signature,
+	})
+}
+
+// Unmarshals from JSON, and checks its public key and signature lengths.
+func (ful *Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.EcdsaP256Sha256Name {
+		return errors.New("not an EcdsaP256Sha256 condition")
+	}
+
+	f := Fulfillment{
+		PublicKey: j.PublicKey,
+		Signature: j.Signature,
+	}
+	if err := f.check(); err != nil {
+		return err
+	}
+
+	*ful = f
+	return nil
+}
+
+type jsonCondition struct {
+	Type                 string             `json:"type"`
+	Fingerprint          encoding.JSONBytes `json:"fingerprint"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength"`
+	Cost                 uint64             `json:"cost"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxFulfillmentLength", "cost"}.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCondition{
+		Type:                 encoding.EcdsaP256Sha256Name,
+		Fingerprint:          cond.Hash[:],
+		MaxFulfillmentLength: cond.MaxFulfillmentLength,
+		Cost:                 cond.Cost,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.EcdsaP256Sha256Name {
+		return errors.New("not an EcdsaP256Sha256 condition")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+
+	if j.Cost != FixedCost {
+		return errors.New("invalid cost")
+	}
+	*cond = Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+		Cost:                 j.Cost,
+	}
+
+	return nil
+}
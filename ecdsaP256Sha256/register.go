@@ -0,0 +1,70 @@
+package EcdsaP256Sha256
+
+import (
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/registry"
+)
+
+func init() {
+	registry.Register(&registry.Type{
+		ID:             "32",
+		Name:           encoding.EcdsaP256Sha256Name,
+		DERTag:         derTag,
+		FeatureBitmask: features.Sha256 | features.EcdsaP256,
+
+		Fulfillment: &Fulfillment{},
+		Condition:   &Condition{},
+
+		ParseFulfillment: func(s string) (registry.Fulfillment, error) {
+			ful, err := ParseFulfillment(s)
+			if err != nil {
+				return nil, err
+			}
+			return ful, nil
+		},
+		ParseCondition: func(s string) (registry.Condition, error) {
+			cond, err := ParseCondition(s)
+			if err != nil {
+				return nil, err
+			}
+			return cond, nil
+		},
+		ParseFulfillmentBinary: func(b []byte) (registry.Fulfillment, error) {
+			ful, err := ParseFulfillmentBinary(b)
+			if err != nil {
+				return nil, err
+			}
+			return ful, nil
+		},
+		ParseConditionBinary: func(b []byte) (registry.Condition, error) {
+			cond, err := ParseConditionBinary(b)
+			if err != nil {
+				return nil, err
+			}
+			return cond, nil
+		},
+		ParseURI: func(s string) (registry.Condition, error) {
+			cond, err := ParseURI(s)
+			if err != nil {
+				return nil, err
+			}
+			return cond, nil
+		},
+
+		ConditionOf: func(ful registry.Fulfillment) registry.Condition {
+			cond := ful.(*Fulfillment).Condition()
+			return &cond
+		},
+		Validate: func(ful registry.Fulfillment, cond registry.Condition, message []byte) error {
+			return ful.(*Fulfillment).Validate(cond.(*Condition), message)
+		},
+		Limits: func(cond registry.Condition) (uint64, uint64) {
+			c := cond.(*Condition)
+			return c.MaxFulfillmentLength, c.Cost
+		},
+
+		FulfillmentSchema: fulfillmentSchema,
+		ConditionSchema:   conditionSchema,
+	})
+}
@@ -0,0 +1,128 @@
+package Ed25519Sha256
+
+import (
+	"errors"
+	"math/big"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Tag of Ed25519Sha256 conditions and fulfillments in the DER CHOICE
+const derTag = 4
+
+type derFulfillment struct {
+	PublicKey               []byte   `asn1:"tag:0"`
+	MessageId               []byte   `asn1:"tag:1"`
+	FixedMessage            []byte   `asn1:"tag:2"`
+	MaxDynamicMessageLength *big.Int `asn1:"tag:3"`
+	DynamicMessage          []byte   `asn1:"tag:4"`
+	Signature               []byte   `asn1:"tag:5"`
+}
+
+type derCondition struct {
+	Fingerprint             []byte   `asn1:"tag:0"`
+	Cost                    *big.Int `asn1:"tag:1"`
+	MaxDynamicMessageLength *big.Int `asn1:"tag:2"`
+}
+
+// Shape of derFulfillment
+var fulfillmentSchema = encoding.Schema{
+	{Name: "publicKey", Tag: 0, Kind: encoding.KindBytes},
+	{Name: "messageId", Tag: 1, Kind: encoding.KindBytes},
+	{Name: "fixedMessage", Tag: 2, Kind: encoding.KindBytes},
+	{Name: "maxDynamicMessageLength", Tag: 3, Kind: encoding.KindUint},
+	{Name: "dynamicMessage", Tag: 4, Kind: encoding.KindBytes},
+	{Name: "signature", Tag: 5, Kind: encoding.KindBytes},
+}
+
+// Shape of derCondition
+var conditionSchema = encoding.Schema{
+	{Name: "fingerprint", Tag: 0, Kind: encoding.KindBytes},
+	{Name: "cost", Tag: 1, Kind: encoding.KindUint},
+	{Name: "maxDynamicMessageLength", Tag: 2, Kind: encoding.KindUint},
+}
+
+// Serializes to the DER binary format.
+func (ful *Fulfillment) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(derTag, derFulfillment{
+		PublicKey:               ful.PublicKey,
+		MessageId:               ful.MessageId,
+		FixedMessage:            ful.FixedMessage,
+		MaxDynamicMessageLength: encoding.MakeInteger(ful.MaxDynamicMessageLength),
+		DynamicMessage:          ful.DynamicMessage,
+		Signature:               ful.Signature,
+	})
+}
+
+// Parses Fulfillment out of the DER binary format,
+// and checks it for validity, including the signature.
+func ParseFulfillmentBinary(b []byte) (*Fulfillment, error) {
+	var der derFulfillment
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	maxDynamicMessageLength, err := encoding.GetInteger(der.MaxDynamicMessageLength)
+	if err != nil {
+		return nil, err
+	}
+
+	ful := &Fulfillment{
+		PublicKey:               der.PublicKey,
+		MessageId:               der.MessageId,
+		FixedMessage:            der.FixedMessage,
+		MaxDynamicMessageLength: maxDynamicMessageLength,
+		DynamicMessage:          der.DynamicMessage,
+		Signature:               der.Signature,
+	}
+
+	if !ful.verify() {
+		return nil, validation.ErrSignatureInvalid
+	}
+
+	return ful, nil
+}
+
+// Serializes to the DER binary format.
+func (cond *Condition) SerializeBinary() ([]byte, error) {
+	hash := cond.Fingerprint()
+
+	return encoding.MakeChoice(derTag, derCondition{
+		Fingerprint:             hash[:],
+		Cost:                    encoding.MakeInteger(cond.Cost),
+		MaxDynamicMessageLength: encoding.MakeInteger(cond.MaxDynamicMessageLength),
+	})
+}
+
+// Parses Condition out of the DER binary format, and checks it for validity.
+func ParseConditionBinary(b []byte) (*Condition, error) {
+	var der derCondition
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	cond := &Condition{}
+
+	if len(der.Fingerprint) != len(cond.Hash) {
+		return nil, errors.New("fingerprint must be 32 bytes")
+	}
+	copy(cond.Hash[:], der.Fingerprint)
+
+	cost, err := encoding.GetInteger(der.Cost)
+	if err != nil {
+		return nil, err
+	}
+	if cost != FixedCost {
+		return nil, errors.New("invalid cost")
+	}
+	cond.Cost = cost
+
+	length, err := encoding.GetInteger(der.MaxDynamicMessageLength)
+	if err != nil {
+		return nil, err
+	}
+	cond.MaxDynamicMessageLength = length
+
+	return cond, nil
+}
@@ -0,0 +1,41 @@
+package Ed25519Sha256
+
+import (
+	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+)
+
+// Describes the Fulfillment, whether its signature is valid, and the
+// fingerprint of its Condition.
+func (ful *Fulfillment) Describe() *explain.Node {
+	cond := ful.Condition()
+	fingerprint := cond.Fingerprint()
+
+	return explain.Fulfillment(encoding.LegacyEd25519Sha256Name).
+		Bytes("public key", ful.PublicKey).
+		Bytes("message id", ful.MessageId).
+		Bytes("fixed message", ful.FixedMessage).
+		Field("max dynamic message length", ful.MaxDynamicMessageLength).
+		Bytes("dynamic message", ful.DynamicMessage).
+		Bytes("signature", ful.Signature).
+		Field("signature valid", ful.verify()).
+		Bytes("fingerprint", fingerprint[:])
+}
+
+// Describes the Condition. Only Conditions built in memory know the fields
+// their fingerprint commits to.
+func (cond *Condition) Describe() *explain.Node {
+	fingerprint := cond.Fingerprint()
+	n := explain.Condition(encoding.LegacyEd25519Sha256Name).
+		Bytes("fingerprint", fingerprint[:])
+
+	if cond.PublicKey != nil {
+		n.Bytes("public key", cond.PublicKey).
+			Bytes("message id", cond.MessageId).
+			Bytes("fixed message", cond.FixedMessage).
+			Field("max dynamic message length", cond.MaxDynamicMessageLength)
+	}
+
+	return n.Limit("max fulfillment length", cond.MaxFulfillmentLength()).
+		Limit("cost", cond.Cost)
+}
@@ -2,15 +2,17 @@
 package Ed25519Sha256
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
-	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
+	"crypto-conditions/batch"
 	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
 	"golang.org/x/crypto/ed25519"
 )
 
@@ -43,26 +45,58 @@ type Fulfillment struct {
 
 // Serializes to the Crypto Conditions Fulfillment string format.
 func (ful *Fulfillment) Serialize() string {
-	payload := base64.URLEncoding.EncodeToString(bytes.Join([][]byte{
-		encoding.MakeVarbyte(ful.PublicKey[:]),
-		encoding.MakeVarbyte(ful.MessageId),
-		encoding.MakeVarbyte(ful.FixedMessage),
-		encoding.MakeUvarint(ful.MaxDynamicMessageLength),
-		encoding.MakeVarbyte(ful.DynamicMessage),
-		encoding.MakeVarbyte(ful.Signature[:]),
-	}, []byte{}))
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
+
+// Appends the Crypto Conditions Fulfillment string format to dst, without
+// allocating if dst has room for SerializedLength more bytes.
+func (ful *Fulfillment) AppendSerialize(dst []byte) []byte {
+	a := encoding.NewBase64Appender(append(dst, "cf:1:8:"...))
+	a.AppendVarbyte(ful.PublicKey)
+	a.AppendVarbyte(ful.MessageId)
+	a.AppendVarbyte(ful.FixedMessage)
+	a.AppendUvarint(ful.MaxDynamicMessageLength)
+	a.AppendVarbyte(ful.DynamicMessage)
+	a.AppendVarbyte(ful.Signature)
+	return a.Finish()
+}
+
+// Returns the length of the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) SerializedLength() int {
+	payload := encoding.VarbyteLength(uint64(len(ful.PublicKey))) +
+		encoding.VarbyteLength(uint64(len(ful.MessageId))) +
+		encoding.VarbyteLength(uint64(len(ful.FixedMessage))) +
+		encoding.UvarintLength(ful.MaxDynamicMessageLength) +
+		encoding.VarbyteLength(uint64(len(ful.DynamicMessage))) +
+		encoding.VarbyteLength(uint64(len(ful.Signature)))
 
-	return "cf:1:8:" + payload
+	return len("cf:1:8:") + int(encoding.Base64Length(payload))
 }
 
 // Signs an in-memory Fulfillment
 func (ful *Fulfillment) Sign(privkey []byte) {
-	ful.Signature = ed25519.Sign(privkey, append(ful.FixedMessage, ful.DynamicMessage...))
+	ful.Signature = ed25519.Sign(privkey, ful.message())
 }
 
 // Parses Fulfillment out of the Crypto Conditions string format,
 // and checks it for validity, including the signature.
 func ParseFulfillment(s string) (*Fulfillment, error) {
+	ful, err := parseFulfillment(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check signature
+	if !ful.verify() {
+		return nil, validation.ErrSignatureInvalid
+	}
+
+	return ful, nil
+}
+
+// Parses Fulfillment out of the Crypto Conditions string format, leaving the
+// signature unverified.
+func parseFulfillment(s string) (*Fulfillment, error) {
 	parts := strings.Split(s, ":")
 	if len(parts) != 4 {
 		return nil, errors.New("parsing error")
@@ -98,12 +132,10 @@ func ParseFulfillment(s string) (*Fulfillment, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("foo", len(b))
 	maxDynamicMessageLength, b, err := encoding.GetUvarint(b)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("foo", maxDynamicMessageLength, len(b))
 	dynamicMessage, b, err := encoding.GetVarbyte(b)
 	if err != nil {
 		return nil, err
@@ -115,11 +147,6 @@ func ParseFulfillment(s string) (*Fulfillment, error) {
 	}
 	//signature := sliceTo64Byte(sig)
 	signature := sig
-	// Check signature
-	fullMessage := append(fixedMessage, dynamicMessage...)
-	if !ed25519.Verify(pubkey, fullMessage, signature) {
-		return nil, errors.New("signature not valid")
-	}
 
 	ful := &Fulfillment{
 		PublicKey:               pubkey,
@@ -133,13 +160,29 @@ func ParseFulfillment(s string) (*Fulfillment, error) {
 	return ful, nil
 }
 
+// Returns the signed message. It is copied so that appending the DynamicMessage
+// never writes into the FixedMessage's backing array.
+func (ful *Fulfillment) message() []byte {
+	return append(append([]byte{}, ful.FixedMessage...), ful.DynamicMessage...)
+}
+
+// Checks the signature, rejecting malformed public keys rather than letting
+// ed25519.Verify panic on them.
+func (ful *Fulfillment) verify() bool {
+	if len(ful.PublicKey) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(ful.PublicKey, ful.message(), ful.Signature)
+}
+
 // Turns an in-memory Fulfillment to an in-memory Condition. DynamicMessage and Signature
 // are discarded if present.
 func (ful *Fulfillment) Condition() Condition {
 	var length uint64
 
 	if ful.MaxDynamicMessageLength == 0 {
-		length = uint64(len(ful.Serialize()))
+		length = uint64(ful.SerializedLength())
 	} else {
 		length = ful.MaxDynamicMessageLength
 	}
@@ -149,25 +192,119 @@ func (ful *Fulfillment) Condition() Condition {
 		MessageId:               ful.MessageId,
 		FixedMessage:            ful.FixedMessage,
 		MaxDynamicMessageLength: length,
+		Cost:                    FixedCost,
 	}
 }
 
+// Cost of every Ed25519Sha256 condition, as for Ed25519 signatures in the
+// crypto-conditions spec
+const FixedCost = 131072
+
+// A Condition parsed from the string format only knows its Hash. Conditions
+// built in memory leave Hash unset and carry the PublicKey, MessageId and
+// FixedMessage it is computed from instead. Conditions parsed from the
+// named-information URI format have no MaxDynamicMessageLength, which is
+// then set to the largest uint64.
 type Condition struct {
 	PublicKey               []byte
 	MessageId               []byte
 	FixedMessage            []byte
 	MaxDynamicMessageLength uint64
+	Hash                    [32]byte
+	Cost                    uint64
+}
+
+// Returns the hash the Condition commits to. The public key, message id and
+// fixed message are streamed through the hash rather than concatenated.
+func (cond *Condition) Fingerprint() [32]byte {
+	if cond.PublicKey == nil {
+		return cond.Hash
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	h := sha256.New()
+	for _, b := range [][]byte{cond.PublicKey, cond.MessageId, cond.FixedMessage} {
+		h.Write(encoding.AppendUvarint(prefix[:0], uint64(len(b))))
+		h.Write(b)
+	}
+
+	var hash [32]byte
+	h.Sum(hash[:0])
+	return hash
+}
+
+// Returns an upper bound on the length of serialized fulfillments of the Condition.
+// A Condition parsed from the string format doesn't know its MessageId and
+// FixedMessage, which may be of any length, so its fulfillments are unbounded.
+func (cond *Condition) MaxFulfillmentLength() uint64 {
+	if cond.PublicKey == nil {
+		return math.MaxUint64
+	}
+
+	fixedLength := uint64(len(cond.MessageId) + len(cond.FixedMessage))
+	payload := encoding.VarbyteLength(ed25519.PublicKeySize) +
+		// one length prefix each for the MessageId and the FixedMessage
+		2*uint64(len(encoding.MakeUvarint(fixedLength))) + fixedLength +
+		uint64(len(encoding.MakeUvarint(cond.MaxDynamicMessageLength))) +
+		encoding.VarbyteLength(cond.MaxDynamicMessageLength) +
+		encoding.VarbyteLength(ed25519.SignatureSize)
+
+	return uint64(len("cf:1:8:")) + encoding.Base64Length(payload)
 }
 
 // Serializes to the Crypto Conditions string format.
 func (cond *Condition) Serialize() string {
-	hash := sha256.Sum256(bytes.Join([][]byte{
-		encoding.MakeVarbyte(cond.PublicKey[:]),
-		encoding.MakeVarbyte(cond.MessageId),
-		encoding.MakeVarbyte(cond.FixedMessage),
-	}, []byte{}))
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	hash := cond.Fingerprint()
+	return encoding.AppendCondition(dst, "8", hash[:], cond.MaxDynamicMessageLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return encoding.ConditionLength("8", cond.MaxDynamicMessageLength)
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "8" {
+		return nil, errors.New("not an Ed25519Sha256 condition")
+	}
 
-	return "cc:1:8:" + base64.URLEncoding.EncodeToString(hash[:]) + ":" + strconv.FormatUint(cond.MaxDynamicMessageLength, 10)
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max dynamic message length")
+	}
+
+	cond := &Condition{
+		MaxDynamicMessageLength: length,
+		Hash:                    hash,
+		Cost:                    FixedCost,
+	}
+
+	return cond, nil
 }
 
 func FulfillmentToCondition(s string) (string, error) {
@@ -181,3 +318,101 @@ func FulfillmentToCondition(s string) (string, error) {
 	condString := cond.Serialize()
 	return condString, nil
 }
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:        encoding.LegacyEd25519Sha256Name,
+		Fingerprint: cond.Fingerprint(),
+		Cost:        cond.Cost,
+	}
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.LegacyEd25519Sha256Name {
+		return nil, errors.New("not an Ed25519Sha256 condition")
+	}
+
+	if u.Cost != FixedCost {
+		return nil, errors.New("invalid cost")
+	}
+
+	cond := &Condition{
+		MaxDynamicMessageLength: math.MaxUint64,
+		Hash:                    u.Fingerprint,
+		Cost:                    u.Cost,
+	}
+
+	return cond, nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition: the public key,
+// message id and fixed message must hash to the Condition's fingerprint, the
+// dynamic message must not exceed its MaxDynamicMessageLength, the Condition's
+// Cost must cover the FixedCost and the signature must be valid. The message
+// is not used, as Ed25519Sha256 fulfillments carry the signed message
+// themselves.
+func (ful *Fulfillment) Validate(cond *Condition, message []byte) error {
+	if err := ful.validate(cond); err != nil {
+		return err
+	}
+
+	if !ful.verify() {
+		return validation.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition as Validate
+// does, but adds the signature to b instead of verifying it. The Fulfillment
+// is only valid once b.Verify succeeds too.
+func (ful *Fulfillment) ValidateBatch(cond *Condition, message []byte, b *batch.Batch) error {
+	if err := ful.validate(cond); err != nil {
+		return err
+	}
+
+	b.Add(ful.PublicKey, ful.message(), ful.Signature)
+	return nil
+}
+
+// Checks everything Validate does but the signature.
+func (ful *Fulfillment) validate(cond *Condition) error {
+	derived := ful.Condition()
+	if derived.Fingerprint() != cond.Fingerprint() {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if uint64(len(ful.DynamicMessage)) > cond.MaxDynamicMessageLength {
+		return validation.ErrMessageTooLong
+	}
+
+	if derived.Cost > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	return nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
@@ -0,0 +1,133 @@
+package Ed25519Sha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+)
+
+type jsonFulfillment struct {
+	Type                    string             `json:"type"`
+	PublicKey               encoding.JSONBytes `json:"publicKey"`
+	MessageId               encoding.JSONBytes `json:"messageId"`
+	FixedMessage            encoding.JSONBytes `json:"fixedMessage"`
+	MaxDynamicMessageLength uint64             `json:"maxDynamicMessageLength"`
+	DynamicMessage          encoding.JSONBytes `json:"dynamicMessage"`
+	Signature               encoding.JSONBytes `json:"signature"`
+}
+
+// Marshals to JSON as {"type", "publicKey", "messageId", "fixedMessage",
+// "maxDynamicMessageLength", "dynamicMessage", "signature"}.
+func (ful *Fulfillment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFulfillment{
+		Type:                    encoding.LegacyEd25519Sha256Name,
+		PublicKey:               ful.PublicKey,
+		MessageId:               ful.MessageId,
+		FixedMessage:            ful.FixedMessage,
+		MaxDynamicMessageLength: ful.MaxDynamicMessageLength,
+		DynamicMessage:          ful.DynamicMessage,
+		Signature:               ful.Signature,
+	})
+}
+
+// Unmarshals from JSON. The signature is checked when validating.
+func (ful *Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyEd25519Sha256Name {
+		return errors.New("not an Ed25519Sha256 condition")
+	}
+
+	*ful = Fulfillment{
+		PublicKey:               j.PublicKey,
+		MessageId:               j.MessageId,
+		FixedMessage:            j.FixedMessage,
+		MaxDynamicMessageLength: j.MaxDynamicMessageLength,
+		DynamicMessage:          j.DynamicMessage,
+		Signature:               j.Signature,
+	}
+
+	return nil
+}
+
+// The PublicKey, MessageId and FixedMessage are only present for Conditions
+// built in memory.
+type jsonCondition struct {
+	Type                    string             `json:"type"`
+	Fingerprint             encoding.JSONBytes `json:"fingerprint"`
+	PublicKey               encoding.JSONBytes `json:"publicKey,omitempty"`
+	MessageId               encoding.JSONBytes `json:"messageId,omitempty"`
+	FixedMessage            encoding.JSONBytes `json:"fixedMessage,omitempty"`
+	MaxDynamicMessageLength uint64             `json:"maxDynamicMessageLength"`
+	Cost                    uint64             `json:"cost"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxDynamicMessageLength",
+// "cost"}, along with the "publicKey", "messageId" and "fixedMessage" of
+// Conditions built in memory.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	hash := cond.Fingerprint()
+
+	j := jsonCondition{
+		Type:                    encoding.LegacyEd25519Sha256Name,
+		Fingerprint:             hash[:],
+		MaxDynamicMessageLength: cond.MaxDynamicMessageLength,
+		Cost:                    cond.Cost,
+	}
+	if cond.PublicKey != nil {
+		j.PublicKey = cond.PublicKey
+		j.MessageId = cond.MessageId
+		j.FixedMessage = cond.FixedMessage
+	}
+
+	return json.Marshal(j)
+}
+
+// Unmarshals from JSON, and checks it for validity. If the public key is
+// present, the fingerprint must be that of the public key, message id and
+// fixed message.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyEd25519Sha256Name {
+		return errors.New("not an Ed25519Sha256 condition")
+	}
+
+	if j.Cost != FixedCost {
+		return errors.New("invalid cost")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+
+	c := Condition{
+		MaxDynamicMessageLength: j.MaxDynamicMessageLength,
+		Cost:                    j.Cost,
+	}
+
+	if j.PublicKey == nil {
+		if j.MessageId != nil || j.FixedMessage != nil {
+			return errors.New("message id and fixed message need a public key")
+		}
+		c.Hash = hash
+	} else {
+		c.PublicKey = j.PublicKey
+		c.MessageId = j.MessageId
+		c.FixedMessage = j.FixedMessage
+		if c.Fingerprint() != hash {
+			return errors.New("fingerprint doesn't match public key")
+		}
+	}
+
+	*cond = c
+	return nil
+}
@@ -0,0 +1,112 @@
+package encoding
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+)
+
+// The Append functions serialize into a buffer given by the caller, which
+// they grow as append does. With a buffer of the length computed beforehand,
+// they don't allocate, so that buffers can be reused across fulfillments.
+
+// UvarintLength returns the length of n as a Uvarint.
+func UvarintLength(n uint64) uint64 {
+	length := uint64(1)
+	for ; n >= 0x80; n >>= 7 {
+		length++
+	}
+	return length
+}
+
+// DecimalLength returns the length of n in decimal.
+func DecimalLength(n uint64) uint64 {
+	length := uint64(1)
+	for ; n >= 10; n /= 10 {
+		length++
+	}
+	return length
+}
+
+// AppendUvarint appends n as a Uvarint, as MakeUvarint.
+func AppendUvarint(dst []byte, n uint64) []byte {
+	return binary.AppendUvarint(dst, n)
+}
+
+// AppendVarbyte appends buf prefixed with its length, as MakeVarbyte.
+func AppendVarbyte(dst []byte, buf []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(buf)))
+	return append(dst, buf...)
+}
+
+// Base64Appender appends the padded base64url encoding of a payload to a
+// buffer, as the Crypto Conditions string format encodes it, one field at a
+// time without holding the payload in memory.
+type Base64Appender struct {
+	dst     []byte
+	pending [3]byte
+	n       int
+}
+
+// NewBase64Appender returns a Base64Appender appending to dst.
+func NewBase64Appender(dst []byte) Base64Appender {
+	return Base64Appender{dst: dst}
+}
+
+// Append appends the encoding of b. Bytes that don't make a full base64
+// quantum yet are held until the next call.
+func (a *Base64Appender) Append(b []byte) {
+	if a.n > 0 {
+		for a.n < len(a.pending) && len(b) > 0 {
+			a.pending[a.n] = b[0]
+			a.n++
+			b = b[1:]
+		}
+		if a.n < len(a.pending) {
+			return
+		}
+
+		a.dst = base64.URLEncoding.AppendEncode(a.dst, a.pending[:])
+		a.n = 0
+	}
+
+	full := len(b) / 3 * 3
+	a.dst = base64.URLEncoding.AppendEncode(a.dst, b[:full])
+	a.n = copy(a.pending[:], b[full:])
+}
+
+// AppendUvarint appends the encoding of n as a Uvarint.
+func (a *Base64Appender) AppendUvarint(n uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	a.Append(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+// AppendVarbyte appends the encoding of b prefixed with its length.
+func (a *Base64Appender) AppendVarbyte(b []byte) {
+	a.AppendUvarint(uint64(len(b)))
+	a.Append(b)
+}
+
+// Finish pads the encoding and returns the buffer. The Base64Appender must
+// not be used afterwards.
+func (a *Base64Appender) Finish() []byte {
+	return base64.URLEncoding.AppendEncode(a.dst, a.pending[:a.n])
+}
+
+// AppendCondition appends a condition in the Crypto Conditions string
+// format: "cc:1:", its type field, and its fingerprint and max fulfillment
+// length.
+func AppendCondition(dst []byte, typeID string, fingerprint []byte, maxFulfillmentLength uint64) []byte {
+	dst = append(dst, "cc:1:"...)
+	dst = append(dst, typeID...)
+	dst = append(dst, ':')
+	dst = base64.URLEncoding.AppendEncode(dst, fingerprint)
+	dst = append(dst, ':')
+	return strconv.AppendUint(dst, maxFulfillmentLength, 10)
+}
+
+// ConditionLength returns the length of a condition appended by
+// AppendCondition, with a fingerprint of 32 bytes.
+func ConditionLength(typeID string, maxFulfillmentLength uint64) int {
+	return len("cc:1:") + len(typeID) + 1 + int(Base64Length(32)) + 1 + int(DecimalLength(maxFulfillmentLength))
+}
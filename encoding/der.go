@@ -0,0 +1,165 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"reflect"
+)
+
+// Conditions and fulfillments are DER encoded as a CHOICE of one SEQUENCE per
+// condition type, told apart by a context-specific tag. Fields inside the
+// SEQUENCE are implicitly tagged [0], [1], ... in order, as in the ASN.1
+// module of the crypto-conditions spec.
+
+// MakeChoice DER encodes val, a struct describing a SEQUENCE, and tags it as
+// the alternative tag of a CHOICE
+func MakeChoice(tag int, val interface{}) ([]byte, error) {
+	seq, err := asn1.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(seq, &raw); err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      raw.Bytes,
+	})
+}
+
+// GetChoiceTag returns the tag of the CHOICE alternative DER encoded in b
+func GetChoiceTag(b []byte) (int, error) {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &raw)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rest) != 0 {
+		return 0, errors.New("trailing data after DER value")
+	}
+
+	if raw.Class != asn1.ClassContextSpecific || !raw.IsCompound {
+		return 0, errors.New("DER value is not a choice")
+	}
+
+	return raw.Tag, nil
+}
+
+// GetChoice decodes the CHOICE alternative DER encoded in b into val, a
+// pointer to a struct describing a SEQUENCE. The alternative must have the
+// given tag and be canonically encoded.
+func GetChoice(b []byte, tag int, val interface{}) error {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) != 0 {
+		return errors.New("trailing data after DER value")
+	}
+
+	if raw.Class != asn1.ClassContextSpecific || !raw.IsCompound || raw.Tag != tag {
+		return errors.New("unexpected DER choice")
+	}
+
+	seq, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      raw.Bytes,
+	})
+	if err != nil {
+		return err
+	}
+
+	rest, err = asn1.Unmarshal(seq, val)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) != 0 {
+		return errors.New("trailing data after DER value")
+	}
+
+	// encoding/asn1 skips unknown trailing fields and accepts some BER. DER
+	// being canonical, re-encoding must give back the same bytes.
+	canonical, err := asn1.Marshal(reflect.ValueOf(val).Elem().Interface())
+	if err != nil || !bytes.Equal(canonical, seq) {
+		return errors.New("not a canonical DER value")
+	}
+
+	return nil
+}
+
+// MakeInteger converts n for DER encoding. encoding/asn1 has no unsigned
+// integers, so uint64 fields are carried in a big.Int.
+func MakeInteger(n uint64) *big.Int {
+	return new(big.Int).SetUint64(n)
+}
+
+// GetInteger is the inverse of MakeInteger. It rejects negative numbers and
+// numbers that don't fit the uint64.
+func GetInteger(n *big.Int) (uint64, error) {
+	if n == nil || !n.IsUint64() {
+		return 0, errors.New("DER integer out of range")
+	}
+
+	return n.Uint64(), nil
+}
+
+// MakeBitString converts a set of named bits, bit 0 first, for DER encoding.
+// DER drops the trailing zero bits of named bits.
+func MakeBitString(bits uint32) asn1.BitString {
+	if bits == 0 {
+		return asn1.BitString{}
+	}
+
+	length := 0
+	for i := 0; i < 32; i++ {
+		if bits&(1<<uint(i)) != 0 {
+			length = i + 1
+		}
+	}
+
+	b := asn1.BitString{
+		Bytes:     make([]byte, (length+7)/8),
+		BitLength: length,
+	}
+	for i := 0; i < length; i++ {
+		if bits&(1<<uint(i)) != 0 {
+			b.Bytes[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+
+	return b
+}
+
+// GetBitString is the inverse of MakeBitString. It rejects bit strings with
+// trailing zero bits or more than 32 bits.
+func GetBitString(b asn1.BitString) (uint32, error) {
+	if b.BitLength > 32 {
+		return 0, errors.New("DER bit string out of range")
+	}
+
+	if b.BitLength > 0 && b.At(b.BitLength-1) == 0 {
+		return 0, errors.New("not a canonical DER bit string")
+	}
+
+	var bits uint32
+	for i := 0; i < b.BitLength; i++ {
+		if b.At(i) != 0 {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
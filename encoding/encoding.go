@@ -3,8 +3,10 @@ package encoding
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
 	"errors"
+	"math"
 )
 
 // Regex for validating fulfillments
@@ -13,6 +15,25 @@ import (
 // expression.
 const FULFILLMENT_REGEX = "/^cf:([1-9a-f][0-9a-f]{0,3}|0):[a-zA-Z0-9_-]*$/"
 
+// ParseFingerprint decodes the base64url fingerprint field of a condition
+// string and checks that it holds a Sha256 hash
+func ParseFingerprint(s string) ([32]byte, error) {
+	var hash [32]byte
+
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return hash, errors.New("invalid fingerprint encoding")
+	}
+
+	if len(b) != len(hash) {
+		return hash, errors.New("fingerprint must be 32 bytes")
+	}
+
+	copy(hash[:], b)
+
+	return hash, nil
+}
+
 // MakeUvarint returns a byte slice containing a uvarint
 func MakeUvarint(n uint64) []byte {
 	uvi := make([]byte, 10)
@@ -22,10 +43,31 @@ func MakeUvarint(n uint64) []byte {
 
 // MakeVarbyte prefixes a byte slice with its length
 func MakeVarbyte(buf []byte) []byte {
-	length := len(buf)
-	b := bytes.Join([][]byte{MakeUvarint(uint64(length)), buf}, []byte{})
+	return AppendVarbyte(make([]byte, 0, VarbyteLength(uint64(len(buf)))), buf)
+}
 
-	return b
+// VarbyteLength returns the length of a Varbyte holding n bytes, saturating
+// at the largest uint64, which stands for an unbounded length
+func VarbyteLength(n uint64) uint64 {
+	return AddCost(UvarintLength(n), n)
+}
+
+// AddCost adds two costs, saturating at the largest uint64, which stands for
+// an unbounded cost
+func AddCost(a, b uint64) uint64 {
+	if a+b < a {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// Base64Length returns the length of n bytes once base64 encoded with padding,
+// saturating at the largest uint64, which stands for an unbounded length
+func Base64Length(n uint64) uint64 {
+	if n > math.MaxUint64/4*3-2 {
+		return math.MaxUint64
+	}
+	return (n + 2) / 3 * 4
 }
 
 func GetUvarint(b []byte) (uint64, []byte, error) {
@@ -45,7 +87,7 @@ func GetVarbyte(b []byte) ([]byte, []byte, error) {
 		return []byte{}, []byte{}, errors.New("error parsing Uvarint")
 	}
 
-	if !(uint64(len(b)) > length) {
+	if uint64(len(b[offset:])) < length {
 		return nil, nil, errors.New("error parsing Varbyte")
 	}
 	vb, b := b[offset:][:length], b[offset:][length:]
@@ -77,3 +119,19 @@ func ParseVarray(b []byte) [][]byte {
 
 	return arr
 }
+
+// GetVarray is ParseVarray for untrusted input: it returns an error
+// rather than panicking when a Varbyte runs past the end of the slice
+func GetVarray(b []byte) ([][]byte, error) {
+	arr := [][]byte{}
+	for len(b) > 0 {
+		vb, rest, err := GetVarbyte(b)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, vb)
+		b = rest
+	}
+
+	return arr, nil
+}
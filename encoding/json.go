@@ -0,0 +1,60 @@
+package encoding
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Conditions and fulfillments marshal to JSON objects whose type field names
+// their type as in the named-information URI format, so that they can be
+// unmarshaled without knowing it in advance.
+
+// JSONBytes marshals to JSON as an unpadded base64url string, as in the JSON
+// form of five-bells-condition. The empty string unmarshals to nil.
+type JSONBytes []byte
+
+func (b JSONBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *JSONBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return errors.New("invalid base64url encoding")
+	}
+
+	*b = nil
+	if len(decoded) > 0 {
+		*b = decoded
+	}
+	return nil
+}
+
+// Fingerprint returns the bytes as a fingerprint, which must be 32 bytes.
+func (b JSONBytes) Fingerprint() ([32]byte, error) {
+	var hash [32]byte
+	if len(b) != len(hash) {
+		return hash, errors.New("fingerprint must be 32 bytes")
+	}
+	copy(hash[:], b)
+
+	return hash, nil
+}
+
+// JSONType reads the type field every condition and fulfillment has in JSON.
+func JSONType(data []byte) (string, error) {
+	var v struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", err
+	}
+
+	return v.Type, nil
+}
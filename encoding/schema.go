@@ -0,0 +1,46 @@
+package encoding
+
+// Kind of a field of a DER SEQUENCE, as far as codecs transcoding the DER
+// binary format need to know
+type Kind int
+
+const (
+	// OCTET STRING
+	KindBytes Kind = iota
+	// Non-negative INTEGER fitting a uint64
+	KindUint
+	// UTF8String
+	KindString
+	// BOOLEAN
+	KindBool
+	// BIT STRING of named bits, as made by MakeBitString
+	KindBits
+	// Fulfillment of any registered type: the CHOICE of its DER encoding
+	KindFulfillment
+	// Condition of any registered type
+	KindCondition
+	// SEQUENCE OF SEQUENCEs, whose fields are described by Elem
+	KindSequenceOf
+)
+
+// Untagged is the Tag of fields that are not tagged, such as a CHOICE
+// directly inside a SEQUENCE.
+const Untagged = -1
+
+// Field describes a field of a DER SEQUENCE.
+type Field struct {
+	// Name of the field, in lowerCamelCase
+	Name string
+	// Context-specific tag of the field, or Untagged
+	Tag  int
+	Kind Kind
+	// Optional fields are left out of the DER encoding when zero
+	Optional bool
+	// Fields of the elements of a KindSequenceOf field
+	Elem Schema
+}
+
+// Schema describes the fields of the SEQUENCE a condition type DER encodes a
+// fulfillment or condition as, so that it can be transcoded to and from other
+// binary formats.
+type Schema []Field
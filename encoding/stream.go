@@ -0,0 +1,190 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrTooLong is returned by a Reader reading past its limit.
+var ErrTooLong = errors.New("length limit exceeded")
+
+// Writer writes Uvarints, Varbytes and Varrays to an io.Writer as they are
+// given, without joining them in memory first. The first error is kept:
+// later writes do nothing and return it again, so that a sequence of writes
+// can be checked once with Err.
+type Writer struct {
+	w   io.Writer
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first error met by the Writer.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) write(b []byte) error {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+	return w.err
+}
+
+// WriteUvarint writes n as a Uvarint, as MakeUvarint.
+func (w *Writer) WriteUvarint(n uint64) error {
+	i := binary.PutUvarint(w.buf[:], n)
+	return w.write(w.buf[:i])
+}
+
+// WriteVarbyte writes b prefixed with its length, as MakeVarbyte.
+func (w *Writer) WriteVarbyte(b []byte) error {
+	w.WriteUvarint(uint64(len(b)))
+	return w.write(b)
+}
+
+// WriteVarray writes items as a Varbyte holding their Varray, which is how
+// fulfillments hold Varrays: MakeVarbyte(MakeVarray(items)).
+func (w *Writer) WriteVarray(items [][]byte) error {
+	var length uint64
+	for _, item := range items {
+		length += VarbyteLength(uint64(len(item)))
+	}
+
+	w.WriteUvarint(length)
+	for _, item := range items {
+		w.WriteVarbyte(item)
+	}
+
+	return w.err
+}
+
+// Reader reads Uvarints, Varbytes and Varrays from an io.Reader one field at
+// a time, so that nested fields can be read from a network connection as
+// they arrive. A Reader reads no more than its limit, so that a length
+// prefix can't make it allocate more than that, and reads nothing past the
+// fields asked for.
+type Reader struct {
+	src *source
+	n   uint64
+}
+
+// The io.Reader shared by a Reader and the Readers of its Varbytes
+type source struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+// NewReader returns a Reader reading at most limit bytes from r.
+func NewReader(r io.Reader, limit uint64) *Reader {
+	return &Reader{src: &source{r: r}, n: limit}
+}
+
+// Remaining returns how many bytes the Reader may still read. Readers of
+// Varbytes are done once it is zero.
+func (r *Reader) Remaining() uint64 {
+	return r.n
+}
+
+// ReadByte reads a single byte, making Reader an io.ByteReader.
+func (r *Reader) ReadByte() (byte, error) {
+	if r.n == 0 {
+		return 0, ErrTooLong
+	}
+
+	var c byte
+	var err error
+	if br, ok := r.src.r.(io.ByteReader); ok {
+		c, err = br.ReadByte()
+	} else {
+		_, err = io.ReadFull(r.src.r, r.src.buf[:])
+		c = r.src.buf[0]
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	r.n--
+	return c, nil
+}
+
+// ReadUvarint reads a Uvarint, as GetUvarint.
+func (r *Reader) ReadUvarint() (uint64, error) {
+	return binary.ReadUvarint(r)
+}
+
+// VarbyteReader reads the length of a Varbyte and returns a Reader of its
+// contents, which must be read before r is read further. The contents count
+// against the limit of r whether read or not.
+func (r *Reader) VarbyteReader() (*Reader, error) {
+	length, err := r.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	if length > r.n {
+		return nil, ErrTooLong
+	}
+	r.n -= length
+
+	return &Reader{src: r.src, n: length}, nil
+}
+
+// ReadVarbyte reads a Varbyte, as GetVarbyte.
+func (r *Reader) ReadVarbyte() ([]byte, error) {
+	vr, err := r.VarbyteReader()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, vr.n)
+	if _, err := io.ReadFull(r.src.r, b); err != nil {
+		return nil, unexpected(err)
+	}
+
+	return b, nil
+}
+
+// ReadVarray reads a Varbyte holding a Varray, as WriteVarray writes it.
+func (r *Reader) ReadVarray() ([][]byte, error) {
+	vr, err := r.VarbyteReader()
+	if err != nil {
+		return nil, err
+	}
+
+	items := [][]byte{}
+	for vr.n > 0 {
+		item, err := vr.ReadVarbyte()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Skip discards what the Reader may still read, such as the rest of a
+// Varbyte.
+func (r *Reader) Skip() error {
+	if _, err := io.CopyN(io.Discard, r.src.r, int64(r.n)); err != nil {
+		return unexpected(err)
+	}
+
+	r.n = 0
+	return nil
+}
+
+// A field cut short by the end of the stream is an unexpected EOF, not the
+// end of the stream.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,213 @@
+// Human-readable descriptions of fulfillments and conditions, for debugging
+// the ones that fail to validate
+package explain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"crypto-conditions/registry"
+)
+
+// Node describes a fulfillment or a condition: its kind, the name of its
+// type, its fields in a fixed order and, for compound types, its
+// subfulfillments and subconditions. It renders as indented text with Text,
+// and as JSON.
+type Node struct {
+	Kind     string  `json:"kind"`
+	Type     string  `json:"type"`
+	Fields   Fields  `json:"fields,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Kinds of Nodes
+const (
+	KindFulfillment = "fulfillment"
+	KindCondition   = "condition"
+	// A subfulfillment or subcondition that doesn't parse
+	KindInvalid = "invalid"
+)
+
+// Field is a named value, formatted for humans: byte strings in hex,
+// unknown limits as "unknown".
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Fields marshal to a JSON object that keeps their order.
+type Fields []Field
+
+// Describer is implemented by the fulfillments and conditions of the types
+// that describe themselves.
+type Describer interface {
+	Describe() *Node
+}
+
+// Fulfillment returns an empty Node for a fulfillment of the named type.
+func Fulfillment(typ string) *Node {
+	return &Node{Kind: KindFulfillment, Type: typ}
+}
+
+// Condition returns an empty Node for a condition of the named type.
+func Condition(typ string) *Node {
+	return &Node{Kind: KindCondition, Type: typ}
+}
+
+// Field appends a field, formatted with fmt.
+func (n *Node) Field(name string, value interface{}) *Node {
+	n.Fields = append(n.Fields, Field{Name: name, Value: fmt.Sprint(value)})
+	return n
+}
+
+// Bytes appends a field holding a byte string, in hex.
+func (n *Node) Bytes(name string, b []byte) *Node {
+	return n.Field(name, hex.EncodeToString(b))
+}
+
+// Limit appends a field holding a MaxFulfillmentLength or Cost, the largest
+// uint64 standing for an unknown limit.
+func (n *Node) Limit(name string, limit uint64) *Node {
+	if limit == math.MaxUint64 {
+		return n.Field(name, "unknown")
+	}
+	return n.Field(name, limit)
+}
+
+// Child appends a subfulfillment or subcondition.
+func (n *Node) Child(child *Node) *Node {
+	n.Children = append(n.Children, child)
+	return n
+}
+
+// Of describes an in-memory fulfillment or condition of any registered type.
+// Types that don't implement Describer are described by their type and
+// serialized form.
+func Of(v interface{ Serialize() string }) *Node {
+	if d, ok := v.(Describer); ok {
+		return d.Describe()
+	}
+
+	n := &Node{Kind: KindInvalid}
+	if ful, ok := v.(registry.Fulfillment); ok {
+		if t := registry.TypeOf(ful); t != nil {
+			n = Fulfillment(t.Name)
+		}
+	}
+	if cond, ok := v.(registry.Condition); ok {
+		if t := registry.TypeOfCondition(cond); t != nil {
+			n = Condition(t.Name)
+		}
+	}
+
+	return n.Field("serialized", v.Serialize())
+}
+
+// String describes a fulfillment ("cf:...") or condition ("cc:...") of any
+// registered type in the Crypto Conditions string format. Signatures are left
+// unverified, for the types that can tell to describe them as a field. Strings
+// that don't parse give a Node of KindInvalid holding the error, so that
+// compound types can describe invalid children.
+func String(s []byte) *Node {
+	invalid := func(err error) *Node {
+		n := &Node{Kind: KindInvalid}
+		return n.Field("error", err).Field("serialized", string(s))
+	}
+
+	if bytes.HasPrefix(s, []byte("cc:")) {
+		cond, err := registry.ParseCondition(string(s))
+		if err != nil {
+			return invalid(err)
+		}
+		return Of(cond)
+	}
+
+	ful, err := registry.ParseFulfillmentUnverified(string(s))
+	if err != nil {
+		return invalid(err)
+	}
+	return Of(ful)
+}
+
+// Weighted describes a subfulfillment or subcondition of a threshold, with
+// its weight as first field.
+func Weighted(weight uint32, s []byte) *Node {
+	n := String(s)
+	n.Fields = append(Fields{{Name: "weight", Value: fmt.Sprint(weight)}}, n.Fields...)
+	return n
+}
+
+// WriteText writes the Node as indented text, one field per line, children
+// indented under their parent.
+func (n *Node) WriteText(w io.Writer) error {
+	return n.writeText(w, 0)
+}
+
+func (n *Node) writeText(w io.Writer, depth int) error {
+	indent := strings.Repeat("  ", depth)
+
+	header := n.Kind
+	if n.Type != "" {
+		header += " " + n.Type
+	}
+	if _, err := fmt.Fprintf(w, "%s%s\n", indent, header); err != nil {
+		return err
+	}
+
+	for _, f := range n.Fields {
+		line := indent + "  " + f.Name + ":"
+		if f.Value != "" {
+			line += " " + f.Value
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range n.Children {
+		if err := c.writeText(w, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Text returns the Node as indented text.
+func (n *Node) Text() string {
+	var b strings.Builder
+	n.WriteText(&b)
+	return b.String()
+}
+
+// MarshalJSON writes the Fields as a JSON object, in order.
+func (fs Fields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,46 @@
+// Feature suites a verifier needs to support to verify a condition
+package features
+
+import "strings"
+
+// Bitmask is a set of feature suites, as in the FeatureBitmask of conditions.
+type Bitmask byte
+
+// Feature suites of the condition types, as in the crypto-conditions spec.
+// Every condition type needs Sha256 for its fingerprint. EcdsaP256 and
+// Timeout are not in the spec, and take the bits above those it defines.
+const (
+	Sha256    Bitmask = 0x01
+	Preimage  Bitmask = 0x02
+	Prefix    Bitmask = 0x04
+	Threshold Bitmask = 0x08
+	RsaPss    Bitmask = 0x10
+	Ed25519   Bitmask = 0x20
+	EcdsaP256 Bitmask = 0x40
+	Timeout   Bitmask = 0x80
+)
+
+// All the feature suites of the built-in condition types
+const All = Sha256 | Preimage | Prefix | Threshold | RsaPss | Ed25519 | EcdsaP256 | Timeout
+
+var names = []string{"SHA-256", "PREIMAGE", "PREFIX", "THRESHOLD", "RSA-PSS", "ED25519", "ECDSA-P256", "TIMEOUT"}
+
+// Unsupported returns the suites of b that are not in supported.
+func (b Bitmask) Unsupported(supported Bitmask) Bitmask {
+	return b &^ supported
+}
+
+// String lists the names of the suites, e.g. "SHA-256, THRESHOLD".
+func (b Bitmask) String() string {
+	s := []string{}
+	for i, name := range names {
+		if b&(1<<uint(i)) != 0 {
+			s = append(s, name)
+		}
+	}
+	if b&^All != 0 {
+		s = append(s, "UNKNOWN")
+	}
+
+	return strings.Join(s, ", ")
+}
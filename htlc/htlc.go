@@ -0,0 +1,198 @@
+// Builds hash-timelock conditions out of the existing condition types
+package htlc
+
+import (
+	"time"
+
+	"crypto-conditions/ed25519sha256"
+	"crypto-conditions/encoding"
+	"crypto-conditions/sha256"
+	"crypto-conditions/thresholdSha256"
+	"crypto-conditions/timeoutSha256"
+	"crypto-conditions/validation"
+)
+
+// HTLC describes a hash-timelock: before the Deadline, the recipient can
+// claim with the preimage of the Hash and a signature; from the Deadline on,
+// the sender can get a refund with a signature. The Hash is the Condition of
+// the preimage as given by Sha256.Fulfillment.Condition, and the keys are
+// Ed25519 public keys. The ID tells apart HTLCs over the same Hash and keys,
+// such as a nonce or the identifier of the swap, so that a signature for one
+// of them is no good for another.
+//
+// The condition is a ThresholdSha256 of 1 out of a claim path and a refund
+// path. The claim path is a ThresholdSha256 of 3 out of the preimage, the
+// recipient's signature and a TimeoutSha256 valid before the Deadline. The
+// refund path is a ThresholdSha256 of 2 out of the sender's signature and a
+// TimeoutSha256 valid from the Deadline on.
+type HTLC struct {
+	Hash         Sha256.Condition
+	RecipientKey []byte
+	SenderKey    []byte
+	Deadline     time.Time
+	ID           []byte
+}
+
+// Returns the message the recipient signs to claim.
+func (h *HTLC) ClaimMessage() []byte {
+	return h.message("claim:")
+}
+
+// Returns the message the sender signs to get a refund.
+func (h *HTLC) RefundMessage() []byte {
+	return h.message("refund:")
+}
+
+// Returns the label followed by the Hash, the Deadline as the timeouts
+// serialize it, and the ID, each as a varbyte.
+func (h *HTLC) message(label string) []byte {
+	message := encoding.AppendVarbyte([]byte(label), h.Hash.Hash[:])
+	message = encoding.AppendVarbyte(message, []byte(h.Deadline.UTC().Format(time.RFC3339Nano)))
+	return encoding.AppendVarbyte(message, h.ID)
+}
+
+// Returns a signature of the message as its FixedMessage. The dynamic message
+// is left empty, but the MaxDynamicMessageLength is set to the length of the
+// message, as Ed25519Sha256 treats 0 as unset.
+func signature(pubkey []byte, message []byte, sig []byte) *Ed25519Sha256.Fulfillment {
+	return &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey,
+		FixedMessage:            message,
+		MaxDynamicMessageLength: uint64(len(message)),
+		Signature:               sig,
+	}
+}
+
+func (h *HTLC) claimSignature(sig []byte) *Ed25519Sha256.Fulfillment {
+	return signature(h.RecipientKey, h.ClaimMessage(), sig)
+}
+
+func (h *HTLC) refundSignature(sig []byte) *Ed25519Sha256.Fulfillment {
+	return signature(h.SenderKey, h.RefundMessage(), sig)
+}
+
+func (h *HTLC) beforeDeadline() *TimeoutSha256.Fulfillment {
+	return &TimeoutSha256.Fulfillment{Expiry: h.Deadline, Before: true}
+}
+
+func (h *HTLC) afterDeadline() *TimeoutSha256.Fulfillment {
+	return &TimeoutSha256.Fulfillment{Expiry: h.Deadline}
+}
+
+func conditionString(cond interface{ Serialize() string }) []byte {
+	return []byte(cond.Serialize())
+}
+
+// Returns a path of the given leaves, each of which is either fulfilled or
+// only known by its condition. All of them are needed.
+func path(fulfillments ThresholdSha256.WeightedStrings, conditions ThresholdSha256.WeightedStrings) *ThresholdSha256.ThresholdSha256Fulfillment {
+	return &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       uint32(len(fulfillments) + len(conditions)),
+		SubFulfillments: fulfillments,
+		SubConditions:   conditions,
+	}
+}
+
+func weighted(s []byte) ThresholdSha256.WeightedString {
+	return ThresholdSha256.WeightedString{Weight: 1, String: s}
+}
+
+// Returns the claim path with none of its leaves fulfilled.
+func (h *HTLC) claimCondition() []byte {
+	sigCond := h.claimSignature(nil).Condition()
+	timeoutCond := h.beforeDeadline().Condition()
+
+	claim := path(ThresholdSha256.WeightedStrings{}, ThresholdSha256.WeightedStrings{
+		weighted(conditionString(&h.Hash)),
+		weighted(conditionString(&sigCond)),
+		weighted(conditionString(&timeoutCond)),
+	})
+	cond := claim.Condition()
+	return conditionString(&cond)
+}
+
+// Returns the refund path with none of its leaves fulfilled.
+func (h *HTLC) refundCondition() []byte {
+	sigCond := h.refundSignature(nil).Condition()
+	timeoutCond := h.afterDeadline().Condition()
+
+	refund := path(ThresholdSha256.WeightedStrings{}, ThresholdSha256.WeightedStrings{
+		weighted(conditionString(&sigCond)),
+		weighted(conditionString(&timeoutCond)),
+	})
+	cond := refund.Condition()
+	return conditionString(&cond)
+}
+
+// Returns the root of the tree given its fulfilled path and the condition of
+// the other one.
+func root(fulfilled *ThresholdSha256.ThresholdSha256Fulfillment, other []byte) *ThresholdSha256.ThresholdSha256Fulfillment {
+	return &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			weighted([]byte(fulfilled.Serialize())),
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			weighted(other),
+		},
+	}
+}
+
+// Returns the Condition of the HTLC.
+func (h *HTLC) Condition() ThresholdSha256.Condition {
+	tree := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			weighted(h.claimCondition()),
+			weighted(h.refundCondition()),
+		},
+	}
+
+	return tree.Condition()
+}
+
+// Builds the fulfillment of the claim path out of the preimage and the
+// recipient's signature of the ClaimMessage. It is valid until the Deadline.
+func (h *HTLC) Claim(preimage []byte, sig []byte) (*ThresholdSha256.ThresholdSha256Fulfillment, error) {
+	preimageFul := &Sha256.Fulfillment{Preimage: preimage}
+	if err := preimageFul.Validate(&h.Hash, nil); err != nil {
+		return nil, err
+	}
+
+	sigFul := h.claimSignature(sig)
+	sigCond := sigFul.Condition()
+	if err := sigFul.Validate(&sigCond, nil); err != nil {
+		return nil, err
+	}
+
+	claim := path(ThresholdSha256.WeightedStrings{
+		weighted([]byte(preimageFul.Serialize())),
+		weighted([]byte(sigFul.Serialize())),
+		weighted([]byte(h.beforeDeadline().Serialize())),
+	}, ThresholdSha256.WeightedStrings{})
+
+	return root(claim, h.refundCondition()), nil
+}
+
+// Builds the fulfillment of the refund path out of the sender's signature of
+// the RefundMessage. It fails with validation.ErrNotYetValid if now is before
+// the Deadline.
+func (h *HTLC) Refund(sig []byte, now time.Time) (*ThresholdSha256.ThresholdSha256Fulfillment, error) {
+	if now.Before(h.Deadline) {
+		return nil, validation.ErrNotYetValid
+	}
+
+	sigFul := h.refundSignature(sig)
+	sigCond := sigFul.Condition()
+	if err := sigFul.Validate(&sigCond, nil); err != nil {
+		return nil, err
+	}
+
+	refund := path(ThresholdSha256.WeightedStrings{
+		weighted([]byte(sigFul.Serialize())),
+		weighted([]byte(h.afterDeadline().Serialize())),
+	}, ThresholdSha256.WeightedStrings{})
+
+	return root(refund, h.claimCondition()), nil
+}
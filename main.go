@@ -1,2 +1,243 @@
 // Generates and parses Crypto Conditions
 package CryptoConditions
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/explain"
+	"crypto-conditions/features"
+	"crypto-conditions/registry"
+	"crypto-conditions/validation"
+
+	// Register the built-in condition types
+	_ "crypto-conditions/ecdsaP256Sha256"
+	_ "crypto-conditions/ed25519sha256"
+	_ "crypto-conditions/prefixSha256"
+	_ "crypto-conditions/rsaSha256"
+	_ "crypto-conditions/sha256"
+	_ "crypto-conditions/thresholdSha256"
+	_ "crypto-conditions/timeoutSha256"
+)
+
+// Fulfillment is implemented by the in-memory fulfillment of every registered
+// condition type, such as *Sha256.Fulfillment or
+// *ThresholdSha256.ThresholdSha256Fulfillment.
+type Fulfillment = registry.Fulfillment
+
+// Condition is implemented by the in-memory condition of every registered
+// condition type, such as *Sha256.Condition or *ThresholdSha256.Condition.
+type Condition = registry.Condition
+
+// Parses a Fulfillment of any registered type out of the Crypto Conditions
+// string format, dispatching on its type field.
+func ParseFulfillment(s string) (Fulfillment, error) {
+	return registry.ParseFulfillment(s)
+}
+
+// Parses a Condition of any registered type out of the Crypto Conditions
+// string format, dispatching on its type field.
+func ParseCondition(s string) (Condition, error) {
+	return registry.ParseCondition(s)
+}
+
+// Parses a Fulfillment of any registered type out of the DER binary format,
+// dispatching on its CHOICE tag.
+func ParseFulfillmentBinary(b []byte) (Fulfillment, error) {
+	return registry.ParseFulfillmentBinary(b)
+}
+
+// Parses a Condition of any registered type out of the DER binary format,
+// dispatching on its CHOICE tag.
+func ParseConditionBinary(b []byte) (Condition, error) {
+	return registry.ParseConditionBinary(b)
+}
+
+// Parses a Condition of any registered type out of the named-information URI
+// format, dispatching on its fpt parameter.
+func ParseConditionURI(s string) (Condition, error) {
+	return registry.ParseConditionURI(s)
+}
+
+// Unmarshals a Fulfillment of any registered type out of JSON, dispatching on
+// its type field.
+func UnmarshalFulfillmentJSON(b []byte) (Fulfillment, error) {
+	return registry.UnmarshalFulfillmentJSON(b)
+}
+
+// Unmarshals a Condition of any registered type out of JSON, dispatching on
+// its type field.
+func UnmarshalConditionJSON(b []byte) (Condition, error) {
+	return registry.UnmarshalConditionJSON(b)
+}
+
+// Turns an in-memory Fulfillment of any registered type into its Condition.
+func ConditionOf(ful Fulfillment) (Condition, error) {
+	return registry.ConditionOf(ful)
+}
+
+// Parses a fulfillment of any registered type and returns its serialized
+// condition.
+func FulfillmentToCondition(s string) (string, error) {
+	ful, err := ParseFulfillment(s)
+	if err != nil {
+		return "", err
+	}
+
+	cond, err := ConditionOf(ful)
+	if err != nil {
+		return "", err
+	}
+
+	return cond.Serialize(), nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto
+// Conditions string format. The errors in the validation package tell which
+// check failed.
+func Validate(fulfillment string, condition string, message []byte) error {
+	return ValidateAt(fulfillment, condition, message, time.Now())
+}
+
+// Checks that a fulfillment satisfies a condition as Validate does, but at the
+// time now, against which the timeouts of timeout fulfillments, at any depth,
+// are checked.
+func ValidateAt(fulfillment string, condition string, message []byte, now time.Time) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return registry.ValidateAt(ful, cond, message, now)
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto
+// Conditions string format, verifying the Ed25519 signatures of the whole
+// fulfillment tree together once everything else is checked. They are added
+// to b, whose Invalid method tells which signatures failed when
+// validation.ErrSignatureInvalid is returned.
+func ValidateBatch(fulfillment string, condition string, message []byte, b *batch.Batch) error {
+	ful, err := registry.ParseFulfillmentUnverified(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return validateBatch(ful, cond, message, time.Now(), b)
+}
+
+func validateBatch(ful Fulfillment, cond Condition, message []byte, now time.Time, b *batch.Batch) error {
+	if err := registry.ValidateBatch(ful, cond, message, now, b); err != nil {
+		return err
+	}
+
+	return b.Verify()
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto
+// Conditions string format, validating the subfulfillments of threshold
+// fulfillments, at any depth, concurrently on up to workers goroutines. A
+// threshold stops validating its subfulfillments once the valid ones reach
+// its threshold, so unlike Validate, it doesn't require those beyond it to be
+// valid. It stops too once the threshold can't be reached anymore, and
+// returns ctx.Err() once ctx is done.
+func ValidateContext(ctx context.Context, fulfillment string, condition string, message []byte, workers int) error {
+	ful, err := registry.ParseFulfillmentUnverified(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return registry.ValidateContext(ctx, ful, cond, message, time.Now(), registry.NewPool(workers))
+}
+
+// Verifier validates fulfillments on a node that only supports some feature
+// suites, such as features.All. Fulfillments needing others, in any of their
+// subconditions, are rejected with validation.ErrUnsupportedFeature before any
+// signature is verified. The suites are read from the fulfillment, which
+// holds the conditions of its unfulfilled subconditions too.
+type Verifier struct {
+	Supported features.Bitmask
+	// Verify the Ed25519 signatures of a fulfillment tree together, as
+	// ValidateBatch does
+	Batch bool
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto
+// Conditions string format, and needs no feature suites the Verifier doesn't
+// support.
+func (v *Verifier) Validate(fulfillment string, condition string, message []byte) error {
+	return v.ValidateAt(fulfillment, condition, message, time.Now())
+}
+
+// Checks that a fulfillment satisfies a condition as Validate does, but at the
+// time now, as the package-level ValidateAt does.
+func (v *Verifier) ValidateAt(fulfillment string, condition string, message []byte, now time.Time) error {
+	// Signatures are only verified once the feature suites are checked
+	ful, err := registry.ParseFulfillmentUnverified(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	suites, err := registry.Features(ful)
+	if err != nil {
+		return err
+	}
+
+	if suites.Unsupported(v.Supported) != 0 {
+		return validation.ErrUnsupportedFeature
+	}
+
+	if v.Batch {
+		return validateBatch(ful, cond, message, now, &batch.Batch{})
+	}
+
+	return registry.ValidateAt(ful, cond, message, now)
+}
+
+// Explains a fulfillment ("cf:...") or condition ("cc:..." or "ni:...") of any
+// registered type as a tree, renderable as indented text or JSON. Fulfillments
+// with invalid signatures are explained too, their signatures described as
+// invalid.
+func Explain(s string) (*explain.Node, error) {
+	if strings.HasPrefix(s, "cf:") {
+		ful, err := registry.ParseFulfillmentUnverified(s)
+		if err != nil {
+			return nil, err
+		}
+		return explain.Of(ful), nil
+	}
+
+	var cond Condition
+	var err error
+	if strings.HasPrefix(s, "ni:") {
+		cond, err = ParseConditionURI(s)
+	} else {
+		cond, err = ParseCondition(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return explain.Of(cond), nil
+}
@@ -0,0 +1,473 @@
+// Generates and parses Prefix-Sha256 Crypto Conditions
+package PrefixSha256
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/registry"
+	"crypto-conditions/validation"
+)
+
+// Fulfillment is fulfilled when its Subfulfillment is valid for the message
+// with the Prefix prepended. The Subfulfillment holds the string form
+// ("cf:...") of a fulfillment of any registered type whose validity depends on
+// the message, and messages longer than MaxMessageLength are rejected.
+// Subfulfillments of types that ignore the message, such as Sha256,
+// Ed25519Sha256 and TimeoutSha256, are rejected too, as the Prefix couldn't
+// bind them.
+type Fulfillment struct {
+	Prefix           []byte
+	MaxMessageLength uint64
+	Subfulfillment   []byte
+}
+
+// Cost added to that of the subcondition, as in the crypto-conditions spec
+const subconditionCost = 1024
+
+// Serializes to the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) Serialize() string {
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
+
+// Appends the Crypto Conditions Fulfillment string format to dst, without
+// allocating if dst has room for SerializedLength more bytes.
+func (ful *Fulfillment) AppendSerialize(dst []byte) []byte {
+	a := encoding.NewBase64Appender(append(dst, "cf:1:2:"...))
+	a.AppendVarbyte(ful.Prefix)
+	a.AppendUvarint(ful.MaxMessageLength)
+	a.AppendVarbyte(ful.Subfulfillment)
+	return a.Finish()
+}
+
+// Returns the length of the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) SerializedLength() int {
+	payload := encoding.VarbyteLength(uint64(len(ful.Prefix))) +
+		encoding.UvarintLength(ful.MaxMessageLength) +
+		encoding.VarbyteLength(uint64(len(ful.Subfulfillment)))
+
+	return len("cf:1:2:") + int(encoding.Base64Length(payload))
+}
+
+// Parses Fulfillment out of the Crypto Conditions string format. The
+// Subfulfillment is only checked when validating.
+func ParseFulfillment(s string) (*Fulfillment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cf" {
+		return nil, errors.New("fulfillments must start with \"cf\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "2" {
+		return nil, errors.New("not a PrefixSha256 condition")
+	}
+
+	b, err := base64.URLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.New("parsing error")
+	}
+
+	prefix, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMessageLength, b, err := encoding.GetUvarint(b)
+	if err != nil {
+		return nil, err
+	}
+
+	subfulfillment, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("parsing error")
+	}
+
+	ful := &Fulfillment{
+		Prefix:           prefix,
+		MaxMessageLength: maxMessageLength,
+		Subfulfillment:   subfulfillment,
+	}
+
+	return ful, nil
+}
+
+// Returns the message the Subfulfillment is validated against. It is copied
+// so that appending the message never writes into the Prefix's backing array.
+func (ful *Fulfillment) message(message []byte) []byte {
+	return append(append([]byte{}, ful.Prefix...), message...)
+}
+
+// Turns an in-memory Fulfillment to an in-memory Condition. The fingerprint
+// commits to the Prefix, the MaxMessageLength and the condition of the
+// Subfulfillment, and the Cost adds the lengths of the Prefix and of the
+// longest message to that of the subcondition.
+func (ful *Fulfillment) Condition() Condition {
+	sub, subLength, err := conditionOf(ful.Subfulfillment)
+	if err != nil {
+		// An invalid Subfulfillment, or one that ignores the message, is
+		// committed to as it is, so that the resulting Condition matches no
+		// valid fulfillment and validating it tells why.
+		sub = ful.Subfulfillment
+		subLength = uint64(len(sub))
+	}
+	_, subCost := parseSubcondition(sub)
+
+	hash := sha256.Sum256(bytes.Join([][]byte{
+		encoding.MakeVarbyte(ful.Prefix),
+		encoding.MakeUvarint(ful.MaxMessageLength),
+		encoding.MakeVarbyte(sub),
+	}, []byte{}))
+
+	payload := encoding.VarbyteLength(uint64(len(ful.Prefix))) +
+		uint64(len(encoding.MakeUvarint(ful.MaxMessageLength)))
+	payload = encoding.AddCost(payload, encoding.VarbyteLength(subLength))
+
+	cost := encoding.AddCost(subCost, uint64(len(ful.Prefix)))
+	cost = encoding.AddCost(cost, ful.MaxMessageLength)
+	cost = encoding.AddCost(cost, subconditionCost)
+
+	return Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: encoding.AddCost(uint64(len("cf:1:2:")), encoding.Base64Length(payload)),
+		Cost:                 cost,
+		subtypes:             subtypesOf(ful.Subfulfillment) &^ ownType,
+	}
+}
+
+// Returns the feature suites the Fulfillment needs, those of the
+// Subfulfillment included.
+func (ful *Fulfillment) Features() features.Bitmask {
+	suites := features.Sha256 | features.Prefix
+
+	sub, err := registry.ParseFulfillmentUnverified(string(ful.Subfulfillment))
+	if err != nil {
+		return suites
+	}
+
+	subSuites, _ := registry.Features(sub)
+	return suites | subSuites
+}
+
+// The Cost of a prefix condition depends on its subcondition and can't be read
+// from the Crypto Conditions string format, so conditions parsed from it have
+// the largest uint64 as their Cost, which stands for an unbounded cost.
+// Conditions parsed from the named-information URI format likewise have no
+// MaxFulfillmentLength. Nor does the string format have room for the
+// Subtypes, which only Conditions derived from a fulfillment or parsed from the
+// other formats know.
+type Condition struct {
+	Hash                 [32]byte
+	MaxFulfillmentLength uint64
+	Cost                 uint64
+	subtypes             registry.TypeSet
+}
+
+// Returns the type of the subcondition and its own subtypes, except
+// PrefixSha256 itself.
+func (cond *Condition) Subtypes() registry.TypeSet {
+	return cond.subtypes
+}
+
+// Set of PrefixSha256 itself, which is left out of its Subtypes
+const ownType registry.TypeSet = 1 << derTag
+
+// Serializes to the Crypto Conditions string format.
+func (cond *Condition) Serialize() string {
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	return encoding.AppendCondition(dst, "2", cond.Hash[:], cond.MaxFulfillmentLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return encoding.ConditionLength("2", cond.MaxFulfillmentLength)
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "2" {
+		return nil, errors.New("not a PrefixSha256 condition")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max fulfillment length")
+	}
+
+	cond := &Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: length,
+		Cost:                 math.MaxUint64,
+	}
+
+	return cond, nil
+}
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:        encoding.LegacyPrefixSha256Name,
+		Fingerprint: cond.Hash,
+		Cost:        cond.Cost,
+		Subtypes:    cond.subtypes.Names(),
+	}
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for
+// validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.LegacyPrefixSha256Name {
+		return nil, errors.New("not a PrefixSha256 condition")
+	}
+
+	subtypes, err := registry.TypeSetOf(u.Subtypes)
+	if err != nil {
+		return nil, err
+	}
+	if subtypes&ownType != 0 {
+		return nil, errors.New("subtypes of a PrefixSha256 condition can't include it")
+	}
+
+	cond := &Condition{
+		Hash:                 u.Fingerprint,
+		MaxFulfillmentLength: math.MaxUint64,
+		Cost:                 u.Cost,
+		subtypes:             subtypes,
+	}
+
+	return cond, nil
+}
+
+// Parses a subfulfillment of any registered type, given in the Crypto
+// Conditions string format, and derives its condition. Signatures are left
+// unverified. Subfulfillments of types that ignore the message are rejected
+// with validation.ErrMessageIgnored.
+func parseSubfulfillment(fulfillment []byte) (registry.Fulfillment, registry.Condition, error) {
+	ful, err := registry.ParseFulfillmentUnverified(string(fulfillment))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if registry.TypeOf(ful).IgnoresMessage {
+		return nil, nil, validation.ErrMessageIgnored
+	}
+
+	cond, err := registry.ConditionOf(ful)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ful, cond, nil
+}
+
+// Derives the condition string of a subfulfillment of any registered type,
+// given in the Crypto Conditions string format, and its MaxFulfillmentLength.
+// The length is read from the in-memory condition, as the string format
+// doesn't bound the message id and fixed message of Ed25519Sha256 conditions.
+func conditionOf(fulfillment []byte) ([]byte, uint64, error) {
+	_, cond, err := parseSubfulfillment(fulfillment)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	length, _ := registry.TypeOfCondition(cond).Limits(cond)
+	return []byte(cond.Serialize()), length, nil
+}
+
+// Reads the MaxFulfillmentLength and Cost out of a subcondition of any
+// registered type, given in the Crypto Conditions string format. A
+// subcondition that doesn't parse has neither, and can never be fulfilled.
+func parseSubcondition(condition []byte) (uint64, uint64) {
+	cond, err := registry.ParseCondition(string(condition))
+	if err != nil {
+		return 0, 0
+	}
+
+	return registry.TypeOfCondition(cond).Limits(cond)
+}
+
+// Returns the type of a subfulfillment of any registered type, given in the
+// Crypto Conditions string format, together with its own subtypes. A
+// subfulfillment that doesn't parse has none.
+func subtypesOf(fulfillment []byte) registry.TypeSet {
+	ful, err := registry.ParseFulfillmentUnverified(string(fulfillment))
+	if err != nil {
+		return 0
+	}
+
+	cond, err := registry.ConditionOf(ful)
+	if err != nil {
+		return 0
+	}
+
+	return registry.TypeOf(ful).Set() | registry.SubtypesOf(cond)
+}
+
+// Checks that a subfulfillment of any registered type, given in the Crypto
+// Conditions string format, is valid on its own at the time now. With a
+// Batch, its Ed25519 signatures are added to it rather than verified.
+// Signatures are verified by its validation rather than while parsing.
+func validateSubfulfillment(fulfillment []byte, message []byte, now time.Time, b *batch.Batch) error {
+	ful, cond, err := parseSubfulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	if b == nil {
+		return registry.ValidateAt(ful, cond, message, now)
+	}
+
+	return registry.ValidateBatch(ful, cond, message, now, b)
+}
+
+// Checks that a subfulfillment of any registered type, given in the Crypto
+// Conditions string format, is valid on its own at the time now, passing ctx
+// and pool on to it.
+func validateSubfulfillmentContext(ctx context.Context, fulfillment []byte, message []byte, now time.Time, pool *registry.Pool) error {
+	ful, cond, err := parseSubfulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	return registry.ValidateContext(ctx, ful, cond, message, now, pool)
+}
+
+func FulfillmentToCondition(s string) (string, error) {
+	ful, err := ParseFulfillment(s)
+	if err != nil {
+		return "", err
+	}
+
+	cond := ful.Condition()
+
+	condString := cond.Serialize()
+	return condString, nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition: it must match
+// the Condition's fingerprint, MaxFulfillmentLength and Cost, the message must
+// not exceed the MaxMessageLength, and the Subfulfillment must be valid for the
+// message with the Prefix prepended, at the current time.
+func (ful *Fulfillment) Validate(cond *Condition, message []byte) error {
+	return ful.validate(cond, message, time.Now(), nil)
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition as Validate
+// does, but at the time now, which is passed on to the Subfulfillment.
+func (ful *Fulfillment) ValidateAt(cond *Condition, message []byte, now time.Time) error {
+	return ful.validate(cond, message, now, nil)
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition as ValidateAt
+// does, but adds the Ed25519 signatures of the Subfulfillment to b instead of
+// verifying them. The Fulfillment is only valid once b.Verify succeeds too.
+func (ful *Fulfillment) ValidateBatch(cond *Condition, message []byte, now time.Time, b *batch.Batch) error {
+	return ful.validate(cond, message, now, b)
+}
+
+func (ful *Fulfillment) validate(cond *Condition, message []byte, now time.Time, b *batch.Batch) error {
+	if err := ful.check(cond, message); err != nil {
+		return err
+	}
+
+	return validateSubfulfillment(ful.Subfulfillment, ful.message(message), now, b)
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition as ValidateAt
+// does, passing ctx and pool on to the Subfulfillment, so that compound
+// subfulfillments validate theirs concurrently. It returns ctx.Err() once ctx
+// is done.
+func (ful *Fulfillment) ValidateContext(ctx context.Context, cond *Condition, message []byte, now time.Time, pool *registry.Pool) error {
+	if err := ful.check(cond, message); err != nil {
+		return err
+	}
+
+	return validateSubfulfillmentContext(ctx, ful.Subfulfillment, ful.message(message), now, pool)
+}
+
+// Checks everything Validate does but the Subfulfillment.
+func (ful *Fulfillment) check(cond *Condition, message []byte) error {
+	derived := ful.Condition()
+	if derived.Hash != cond.Hash {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if uint64(ful.SerializedLength()) > cond.MaxFulfillmentLength {
+		return validation.ErrFulfillmentTooLong
+	}
+
+	if derived.Cost > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	if uint64(len(message)) > ful.MaxMessageLength {
+		return validation.ErrMessageTooLong
+	}
+
+	return nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
@@ -0,0 +1,166 @@
+package PrefixSha256
+
+import (
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/registry"
+)
+
+// Tag of PrefixSha256 conditions and fulfillments in the DER CHOICE
+const derTag = 1
+
+// The Subfulfillment is itself a CHOICE, so it is explicitly tagged [2]
+// around the DER CHOICE of the child, which can be of any type. encoding/asn1
+// leaves the explicit tag on RawValues, so it is written and checked by hand.
+type derFulfillment struct {
+	Prefix           []byte   `asn1:"tag:0"`
+	MaxMessageLength *big.Int `asn1:"tag:1"`
+	Subfulfillment   asn1.RawValue
+}
+
+const derSubfulfillmentTag = 2
+
+// The Subtypes are left out when unknown.
+type derCondition struct {
+	Fingerprint          []byte         `asn1:"tag:0"`
+	Cost                 *big.Int       `asn1:"tag:1"`
+	MaxFulfillmentLength *big.Int       `asn1:"tag:2"`
+	Subtypes             asn1.BitString `asn1:"optional,tag:3"`
+}
+
+// Shape of derFulfillment
+var fulfillmentSchema = encoding.Schema{
+	{Name: "prefix", Tag: 0, Kind: encoding.KindBytes},
+	{Name: "maxMessageLength", Tag: 1, Kind: encoding.KindUint},
+	{Name: "subfulfillment", Tag: derSubfulfillmentTag, Kind: encoding.KindFulfillment},
+}
+
+// Shape of derCondition
+var conditionSchema = encoding.Schema{
+	{Name: "fingerprint", Tag: 0, Kind: encoding.KindBytes},
+	{Name: "cost", Tag: 1, Kind: encoding.KindUint},
+	{Name: "maxFulfillmentLength", Tag: 2, Kind: encoding.KindUint},
+	{Name: "subtypes", Tag: 3, Kind: encoding.KindBits, Optional: true},
+}
+
+// Converts a subfulfillment of any registered type from the Crypto Conditions
+// string format to the DER binary format.
+func stringToBinary(s []byte) ([]byte, error) {
+	ful, err := registry.ParseFulfillmentUnverified(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return ful.SerializeBinary()
+}
+
+// Converts a subfulfillment of any registered type from the DER binary format
+// to the Crypto Conditions string format.
+func binaryToString(b []byte) ([]byte, error) {
+	ful, err := registry.ParseFulfillmentBinary(b)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(ful.Serialize()), nil
+}
+
+// Serializes to the DER binary format. The Subfulfillment is converted to the
+// DER binary format as well, and fails to serialize if it can't be parsed.
+func (ful *Fulfillment) SerializeBinary() ([]byte, error) {
+	sub, err := stringToBinary(ful.Subfulfillment)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoding.MakeChoice(derTag, derFulfillment{
+		Prefix:           ful.Prefix,
+		MaxMessageLength: encoding.MakeInteger(ful.MaxMessageLength),
+		Subfulfillment: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        derSubfulfillmentTag,
+			IsCompound: true,
+			Bytes:      sub,
+		},
+	})
+}
+
+// Parses Fulfillment out of the DER binary format.
+func ParseFulfillmentBinary(b []byte) (*Fulfillment, error) {
+	var der derFulfillment
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	maxMessageLength, err := encoding.GetInteger(der.MaxMessageLength)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := der.Subfulfillment
+	if raw.Class != asn1.ClassContextSpecific || raw.Tag != derSubfulfillmentTag || !raw.IsCompound {
+		return nil, errors.New("unexpected DER subfulfillment")
+	}
+
+	sub, err := binaryToString(raw.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ful := &Fulfillment{
+		Prefix:           der.Prefix,
+		MaxMessageLength: maxMessageLength,
+		Subfulfillment:   sub,
+	}
+
+	return ful, nil
+}
+
+// Serializes to the DER binary format.
+func (cond *Condition) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(derTag, derCondition{
+		Fingerprint:          cond.Hash[:],
+		Cost:                 encoding.MakeInteger(cond.Cost),
+		MaxFulfillmentLength: encoding.MakeInteger(cond.MaxFulfillmentLength),
+		Subtypes:             encoding.MakeBitString(uint32(cond.subtypes)),
+	})
+}
+
+// Parses Condition out of the DER binary format, and checks it for validity.
+func ParseConditionBinary(b []byte) (*Condition, error) {
+	var der derCondition
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	cond := &Condition{}
+
+	if len(der.Fingerprint) != len(cond.Hash) {
+		return nil, errors.New("fingerprint must be 32 bytes")
+	}
+	copy(cond.Hash[:], der.Fingerprint)
+
+	cost, err := encoding.GetInteger(der.Cost)
+	if err != nil {
+		return nil, err
+	}
+	cond.Cost = cost
+
+	length, err := encoding.GetInteger(der.MaxFulfillmentLength)
+	if err != nil {
+		return nil, err
+	}
+	cond.MaxFulfillmentLength = length
+
+	subtypes, err := encoding.GetBitString(der.Subtypes)
+	if err != nil {
+		return nil, err
+	}
+	if registry.TypeSet(subtypes)&ownType != 0 {
+		return nil, errors.New("subtypes of a PrefixSha256 condition can't include it")
+	}
+	cond.subtypes = registry.TypeSet(subtypes)
+
+	return cond, nil
+}
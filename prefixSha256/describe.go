@@ -0,0 +1,29 @@
+package PrefixSha256
+
+import (
+	"strings"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+)
+
+// Describes the Fulfillment, the fingerprint of its Condition and the
+// Subfulfillment.
+func (ful *Fulfillment) Describe() *explain.Node {
+	cond := ful.Condition()
+
+	return explain.Fulfillment(encoding.LegacyPrefixSha256Name).
+		Bytes("prefix", ful.Prefix).
+		Field("max message length", ful.MaxMessageLength).
+		Bytes("fingerprint", cond.Hash[:]).
+		Child(explain.String(ful.Subfulfillment))
+}
+
+// Describes the Condition.
+func (cond *Condition) Describe() *explain.Node {
+	return explain.Condition(encoding.LegacyPrefixSha256Name).
+		Bytes("fingerprint", cond.Hash[:]).
+		Limit("max fulfillment length", cond.MaxFulfillmentLength).
+		Limit("cost", cond.Cost).
+		Field("subtypes", strings.Join(cond.subtypes.Names(), ", "))
+}
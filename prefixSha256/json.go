@@ -0,0 +1,117 @@
+package PrefixSha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/registry"
+)
+
+type jsonFulfillment struct {
+	Type             string             `json:"type"`
+	Prefix           encoding.JSONBytes `json:"prefix"`
+	MaxMessageLength uint64             `json:"maxMessageLength"`
+	Subfulfillment   json.RawMessage    `json:"subfulfillment"`
+}
+
+// Marshals to JSON as {"type", "prefix", "maxMessageLength",
+// "subfulfillment"}, the Subfulfillment as the JSON object of its own type.
+func (ful *Fulfillment) MarshalJSON() ([]byte, error) {
+	sub, err := registry.ParseFulfillmentUnverified(string(ful.Subfulfillment))
+	if err != nil {
+		return nil, err
+	}
+
+	subJSON, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonFulfillment{
+		Type:             encoding.LegacyPrefixSha256Name,
+		Prefix:           ful.Prefix,
+		MaxMessageLength: ful.MaxMessageLength,
+		Subfulfillment:   subJSON,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity. The subfulfillment can
+// be of any registered type.
+func (ful *Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyPrefixSha256Name {
+		return errors.New("not a PrefixSha256 condition")
+	}
+
+	sub, err := registry.UnmarshalFulfillmentJSON(j.Subfulfillment)
+	if err != nil {
+		return err
+	}
+
+	*ful = Fulfillment{
+		Prefix:           j.Prefix,
+		MaxMessageLength: j.MaxMessageLength,
+		Subfulfillment:   []byte(sub.Serialize()),
+	}
+
+	return nil
+}
+
+type jsonCondition struct {
+	Type                 string             `json:"type"`
+	Fingerprint          encoding.JSONBytes `json:"fingerprint"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength"`
+	Cost                 uint64             `json:"cost"`
+	Subtypes             []string           `json:"subtypes,omitempty"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxFulfillmentLength", "cost"},
+// with the names of the Subtypes if known.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCondition{
+		Type:                 encoding.LegacyPrefixSha256Name,
+		Fingerprint:          cond.Hash[:],
+		MaxFulfillmentLength: cond.MaxFulfillmentLength,
+		Cost:                 cond.Cost,
+		Subtypes:             cond.subtypes.Names(),
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyPrefixSha256Name {
+		return errors.New("not a PrefixSha256 condition")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+
+	subtypes, err := registry.TypeSetOf(j.Subtypes)
+	if err != nil {
+		return err
+	}
+	if subtypes&ownType != 0 {
+		return errors.New("subtypes of a PrefixSha256 condition can't include it")
+	}
+
+	*cond = Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+		Cost:                 j.Cost,
+		subtypes:             subtypes,
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package PrefixSha256
+
+import (
+	"context"
+	"time"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/registry"
+
+	// Register the built-in types subconditions can be of
+	_ "crypto-conditions/ecdsaP256Sha256"
+	_ "crypto-conditions/ed25519sha256"
+	_ "crypto-conditions/rsaSha256"
+	_ "crypto-conditions/sha256"
+	_ "crypto-conditions/thresholdSha256"
+	_ "crypto-conditions/timeoutSha256"
+)
+
+func init() {
+	registry.Register(&registry.Type{
+		ID:             "2",
+		Name:           encoding.LegacyPrefixSha256Name,
+		DERTag:         derTag,
+		Compound:       true,
+		FeatureBitmask: features.Sha256 | features.Prefix,
+
+		Fulfillment: &Fulfillment{},
+		Condition:   &Condition{},
+
+		ParseFulfillment: func(s string) (registry.Fulfillment, error) {
+			ful, err := ParseFulfillment(s)
+			if err != nil {
+				return nil, err
+			}
+			return ful, nil
+		},
+		ParseCondition: func(s string) (registry.Condition, error) {
+			cond, err := ParseCondition(s)
+			if err != nil {
+				return nil, err
+			}
+			return cond, nil
+		},
+		ParseFulfillmentBinary: func(b []byte) (registry.Fulfillment, error) {
+			ful, err := ParseFulfillmentBinary(b)
+			if err != nil {
+				return nil, err
+			}
+			return ful, nil
+		},
+		ParseConditionBinary: func(b []byte) (registry.Condition, error) {
+			cond, err := ParseConditionBinary(b)
+			if err != nil {
+				return nil, err
+			}
+			return cond, nil
+		},
+		ParseURI: func(s string) (registry.Condition, error) {
+			cond, err := ParseURI(s)
+			if err != nil {
+				return nil, err
+			}
+			return cond, nil
+		},
+
+		ConditionOf: func(ful registry.Fulfillment) registry.Condition {
+			cond := ful.(*Fulfillment).Condition()
+			return &cond
+		},
+		Validate: func(ful registry.Fulfillment, cond registry.Condition, message []byte) error {
+			return ful.(*Fulfillment).Validate(cond.(*Condition), message)
+		},
+		ValidateAt: func(ful registry.Fulfillment, cond registry.Condition, message []byte, now time.Time) error {
+			return ful.(*Fulfillment).ValidateAt(cond.(*Condition), message, now)
+		},
+		ValidateBatch: func(ful registry.Fulfillment, cond registry.Condition, message []byte, now time.Time, b *batch.Batch) error {
+			return ful.(*Fulfillment).ValidateBatch(cond.(*Condition), message, now, b)
+		},
+		ValidateContext: func(ctx context.Context, ful registry.Fulfillment, cond registry.Condition, message []byte, now time.Time, pool *registry.Pool) error {
+			return ful.(*Fulfillment).ValidateContext(ctx, cond.(*Condition), message, now, pool)
+		},
+		Limits: func(cond registry.Condition) (uint64, uint64) {
+			c := cond.(*Condition)
+			return c.MaxFulfillmentLength, c.Cost
+		},
+		Features: func(ful registry.Fulfillment) features.Bitmask {
+			return ful.(*Fulfillment).Features()
+		},
+
+		FulfillmentSchema: fulfillmentSchema,
+		ConditionSchema:   conditionSchema,
+	})
+}
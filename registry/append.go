@@ -0,0 +1,29 @@
+package registry
+
+// Appender is implemented by fulfillments and conditions that can serialize
+// to the Crypto Conditions string format into a buffer given by the caller.
+// Every type of this repository implements it.
+type Appender interface {
+	AppendSerialize(dst []byte) []byte
+	SerializedLength() int
+}
+
+// AppendSerialize appends the string format of a Fulfillment or a Condition to
+// dst, falling back to Serialize for types that don't implement Appender.
+func AppendSerialize(dst []byte, v interface{ Serialize() string }) []byte {
+	if a, ok := v.(Appender); ok {
+		return a.AppendSerialize(dst)
+	}
+
+	return append(dst, v.Serialize()...)
+}
+
+// SerializedLength returns the length of the string format of a Fulfillment or
+// a Condition, serializing it if its type doesn't implement Appender.
+func SerializedLength(v interface{ Serialize() string }) int {
+	if a, ok := v.(Appender); ok {
+		return a.SerializedLength()
+	}
+
+	return len(v.Serialize())
+}
@@ -0,0 +1,42 @@
+package registry
+
+import "sync"
+
+// Pool bounds the goroutines on which compound types validate their
+// subfulfillments concurrently, across a whole fulfillment tree. A nil Pool
+// runs everything on the calling goroutine.
+type Pool struct {
+	sem chan struct{}
+}
+
+// NewPool returns a Pool of workers goroutines, the calling one included.
+func NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Pool{sem: make(chan struct{}, workers-1)}
+}
+
+// Go runs fn on a new goroutine if the Pool has one to spare, and on the
+// calling goroutine otherwise, so that compound fulfillments nested in one
+// another never wait for a goroutine. Callers wait for fn with wg.
+func (p *Pool) Go(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+
+	if p != nil {
+		select {
+		case p.sem <- struct{}{}:
+			go func() {
+				defer wg.Done()
+				defer func() { <-p.sem }()
+				fn()
+			}()
+			return
+		default:
+		}
+	}
+
+	defer wg.Done()
+	fn()
+}
@@ -0,0 +1,484 @@
+// Registry of condition types. Every condition type registers itself here, so
+// that the generic parsers and compound conditions can handle types they
+// don't import, including condition types defined outside this repository.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/validation"
+)
+
+// Fulfillment is implemented by the in-memory fulfillment of every condition type.
+type Fulfillment interface {
+	Serialize() string
+	SerializeBinary() ([]byte, error)
+}
+
+// Condition is implemented by the in-memory condition of every condition type.
+type Condition interface {
+	Serialize() string
+	SerializeBinary() ([]byte, error)
+	URI() string
+}
+
+// Type describes a condition type: how it is identified in each format, and
+// the functions the generic parsers and compound conditions need. The
+// functions taking a Fulfillment or a Condition are only ever passed ones of
+// the type.
+type Type struct {
+	// Type field of the Crypto Conditions string format, e.g. "1"
+	ID string
+	// Name in the fpt parameter of named-information URIs
+	Name string
+	// Tag of the type in the DER CHOICE, from 0 to 31 so that TypeSets can
+	// hold it
+	DERTag int
+	// Compound types contain conditions of other types
+	Compound bool
+	// Fulfillments of the type are valid whatever the message, such as
+	// preimages, or signatures of a message they carry themselves. Prefixes
+	// can't bind them, and reject them.
+	IgnoresMessage bool
+	// Feature suites a condition of the type needs to be verified, not
+	// counting those of its subconditions
+	FeatureBitmask features.Bitmask
+
+	// Values of the in-memory Fulfillment and Condition of the type, e.g.
+	// &Sha256.Fulfillment{}, by which Fulfillments and Conditions of the
+	// type are told apart. They must be pointers, to which new values are
+	// unmarshaled.
+	Fulfillment Fulfillment
+	Condition   Condition
+
+	ParseFulfillment       func(s string) (Fulfillment, error)
+	ParseCondition         func(s string) (Condition, error)
+	ParseFulfillmentBinary func(b []byte) (Fulfillment, error)
+	ParseConditionBinary   func(b []byte) (Condition, error)
+	ParseURI               func(s string) (Condition, error)
+
+	// Parses like ParseFulfillment, but leaves signatures unverified, as
+	// deriving a Condition doesn't need them. Only types verifying
+	// signatures while parsing need it.
+	ParseFulfillmentUnverified func(s string) (Fulfillment, error)
+
+	// Derives the Condition of a Fulfillment
+	ConditionOf func(ful Fulfillment) Condition
+	// Checks that a Fulfillment satisfies a Condition
+	Validate func(ful Fulfillment, cond Condition, message []byte) error
+	// Checks like Validate, at the time now. Types whose validity depends
+	// on the time need it, and compound types so as to pass the time on to
+	// their subfulfillments. Other types are checked by Validate.
+	ValidateAt func(ful Fulfillment, cond Condition, message []byte, now time.Time) error
+	// Checks like ValidateAt, but adds the Ed25519 signatures to verify to
+	// a Batch. Ed25519 types need it, and compound types so as to pass the
+	// Batch on to their subfulfillments. Other types are checked by
+	// ValidateAt.
+	ValidateBatch func(ful Fulfillment, cond Condition, message []byte, now time.Time, b *batch.Batch) error
+	// Checks like ValidateAt, stopping early once ctx is done. Compound
+	// types need it, to validate their subfulfillments on the goroutines of
+	// pool. Other types are checked by ValidateAt.
+	ValidateContext func(ctx context.Context, ful Fulfillment, cond Condition, message []byte, now time.Time, pool *Pool) error
+	// Returns the MaxFulfillmentLength and Cost of a Condition
+	Limits func(cond Condition) (maxFulfillmentLength uint64, cost uint64)
+	// Returns the feature suites a Fulfillment needs, subconditions
+	// included. Only compound types need it, the others always need their
+	// FeatureBitmask.
+	Features func(ful Fulfillment) features.Bitmask
+
+	// Shapes of the DER encodings of Fulfillments and Conditions of the type,
+	// which the codecs other than DER transcode. Types without them can only
+	// use the string, DER and JSON formats.
+	FulfillmentSchema encoding.Schema
+	ConditionSchema   encoding.Schema
+}
+
+var (
+	mu              sync.RWMutex
+	byID            = map[string]*Type{}
+	byName          = map[string]*Type{}
+	byDERTag        = map[int]*Type{}
+	byFulfillment   = map[reflect.Type]*Type{}
+	byCondition     = map[reflect.Type]*Type{}
+	errNotSupported = errors.New("unsupported condition type")
+)
+
+// Register adds a condition type. It is meant to be called from the init
+// function of the package implementing the type, and panics if the type is
+// incomplete or clashes with a registered one.
+func Register(t *Type) {
+	if t.ID == "" || t.Name == "" || t.Fulfillment == nil || t.Condition == nil ||
+		t.ParseFulfillment == nil || t.ParseCondition == nil ||
+		t.ParseFulfillmentBinary == nil || t.ParseConditionBinary == nil ||
+		t.ParseURI == nil || t.ConditionOf == nil || t.Validate == nil || t.Limits == nil {
+		panic("registry: incomplete condition type " + t.Name)
+	}
+
+	if t.DERTag < 0 || t.DERTag > 31 {
+		panic("registry: DER tag of " + t.Name + " out of range")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := byID[t.ID]; ok {
+		panic("registry: type ID " + t.ID + " registered twice")
+	}
+	if _, ok := byName[t.Name]; ok {
+		panic("registry: type name " + t.Name + " registered twice")
+	}
+	if _, ok := byDERTag[t.DERTag]; ok {
+		panic("registry: DER tag of " + t.Name + " registered twice")
+	}
+
+	ful := reflect.TypeOf(t.Fulfillment)
+	cond := reflect.TypeOf(t.Condition)
+	if ful.Kind() != reflect.Ptr || cond.Kind() != reflect.Ptr {
+		panic("registry: fulfillment and condition of " + t.Name + " must be pointers")
+	}
+	if _, ok := byFulfillment[ful]; ok {
+		panic("registry: fulfillment of " + t.Name + " registered twice")
+	}
+	if _, ok := byCondition[cond]; ok {
+		panic("registry: condition of " + t.Name + " registered twice")
+	}
+
+	encoding.RegisterTypeName(t.Name, t.Compound)
+
+	byID[t.ID] = t
+	byName[t.Name] = t
+	byDERTag[t.DERTag] = t
+	byFulfillment[ful] = t
+	byCondition[cond] = t
+}
+
+// Types returns the registered types in the order of their DER tags.
+func Types() []*Type {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	types := make([]*Type, 0, len(byDERTag))
+	for _, t := range byDERTag {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].DERTag < types[j].DERTag })
+
+	return types
+}
+
+// ByID returns the type with the given type field of the Crypto Conditions
+// string format, or nil.
+func ByID(id string) *Type {
+	mu.RLock()
+	defer mu.RUnlock()
+	return byID[id]
+}
+
+// ByName returns the type with the given name in named-information URIs, or nil.
+func ByName(name string) *Type {
+	mu.RLock()
+	defer mu.RUnlock()
+	return byName[name]
+}
+
+// ByDERTag returns the type with the given tag in the DER CHOICE, or nil.
+func ByDERTag(tag int) *Type {
+	mu.RLock()
+	defer mu.RUnlock()
+	return byDERTag[tag]
+}
+
+// TypeOf returns the type of an in-memory Fulfillment, or nil.
+func TypeOf(ful Fulfillment) *Type {
+	mu.RLock()
+	defer mu.RUnlock()
+	return byFulfillment[reflect.TypeOf(ful)]
+}
+
+// TypeOfCondition returns the type of an in-memory Condition, or nil.
+func TypeOfCondition(cond Condition) *Type {
+	mu.RLock()
+	defer mu.RUnlock()
+	return byCondition[reflect.TypeOf(cond)]
+}
+
+// NewFulfillment returns a pointer to a new zero Fulfillment of the type.
+func (t *Type) NewFulfillment() Fulfillment {
+	return reflect.New(reflect.TypeOf(t.Fulfillment).Elem()).Interface().(Fulfillment)
+}
+
+// NewCondition returns a pointer to a new zero Condition of the type.
+func (t *Type) NewCondition() Condition {
+	return reflect.New(reflect.TypeOf(t.Condition).Elem()).Interface().(Condition)
+}
+
+// Splits a Crypto Conditions string into its parts and checks the prefix and
+// protocol version shared by every condition type.
+func splitString(s string, prefix string) ([]string, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 4 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != prefix {
+		return nil, errors.New("must start with \"" + prefix + "\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	return parts, nil
+}
+
+// Parses a Fulfillment of any registered type out of the Crypto Conditions
+// string format, dispatching on its type field.
+func ParseFulfillment(s string) (Fulfillment, error) {
+	parts, err := splitString(s, "cf")
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByID(parts[2])
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	return t.ParseFulfillment(s)
+}
+
+// ParseFulfillmentUnverified parses like ParseFulfillment, but leaves the
+// signatures of the types that check them while parsing unverified. It is
+// for deriving conditions and feature suites, which don't depend on them, and
+// for ValidateBatch, which verifies them.
+func ParseFulfillmentUnverified(s string) (Fulfillment, error) {
+	parts, err := splitString(s, "cf")
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByID(parts[2])
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	if t.ParseFulfillmentUnverified == nil {
+		return t.ParseFulfillment(s)
+	}
+
+	return t.ParseFulfillmentUnverified(s)
+}
+
+// Parses a Condition of any registered type out of the Crypto Conditions
+// string format, dispatching on its type field.
+func ParseCondition(s string) (Condition, error) {
+	parts, err := splitString(s, "cc")
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByID(parts[2])
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	return t.ParseCondition(s)
+}
+
+// Parses a Fulfillment of any registered type out of the DER binary format,
+// dispatching on its CHOICE tag.
+func ParseFulfillmentBinary(b []byte) (Fulfillment, error) {
+	tag, err := encoding.GetChoiceTag(b)
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByDERTag(tag)
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	return t.ParseFulfillmentBinary(b)
+}
+
+// Parses a Condition of any registered type out of the DER binary format,
+// dispatching on its CHOICE tag.
+func ParseConditionBinary(b []byte) (Condition, error) {
+	tag, err := encoding.GetChoiceTag(b)
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByDERTag(tag)
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	return t.ParseConditionBinary(b)
+}
+
+// Parses a Condition of any registered type out of the named-information URI
+// format, dispatching on its fpt parameter.
+func ParseConditionURI(s string) (Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByName(u.Type)
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	return t.ParseURI(s)
+}
+
+// Turns an in-memory Fulfillment of any registered type into its Condition.
+func ConditionOf(ful Fulfillment) (Condition, error) {
+	t := TypeOf(ful)
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	return t.ConditionOf(ful), nil
+}
+
+// Returns the feature suites an in-memory Fulfillment of any registered type
+// needs to be verified, those of its subconditions included.
+func Features(ful Fulfillment) (features.Bitmask, error) {
+	t := TypeOf(ful)
+	if t == nil {
+		return 0, errNotSupported
+	}
+
+	if t.Features == nil {
+		return t.FeatureBitmask, nil
+	}
+
+	return t.Features(ful), nil
+}
+
+// Checks that an in-memory Fulfillment of any registered type satisfies the
+// Condition, which must be of the same type, at the current time.
+func Validate(ful Fulfillment, cond Condition, message []byte) error {
+	return ValidateAt(ful, cond, message, time.Now())
+}
+
+// ValidateAt checks like Validate, at the time now. The whole fulfillment
+// tree is validated at that same time.
+func ValidateAt(ful Fulfillment, cond Condition, message []byte, now time.Time) error {
+	t := TypeOf(ful)
+	if t == nil {
+		return errNotSupported
+	}
+
+	if TypeOfCondition(cond) != t {
+		return validation.ErrTypeMismatch
+	}
+
+	return t.validateAt(ful, cond, message, now)
+}
+
+func (t *Type) validateAt(ful Fulfillment, cond Condition, message []byte, now time.Time) error {
+	if t.ValidateAt == nil {
+		return t.Validate(ful, cond, message)
+	}
+
+	return t.ValidateAt(ful, cond, message, now)
+}
+
+// ValidateBatch checks like ValidateAt, but adds the Ed25519 signatures of
+// the whole fulfillment tree to b instead of verifying them one by one. The
+// Fulfillment is only valid once b.Verify succeeds too.
+func ValidateBatch(ful Fulfillment, cond Condition, message []byte, now time.Time, b *batch.Batch) error {
+	t := TypeOf(ful)
+	if t == nil {
+		return errNotSupported
+	}
+
+	if TypeOfCondition(cond) != t {
+		return validation.ErrTypeMismatch
+	}
+
+	if t.ValidateBatch == nil {
+		return t.validateAt(ful, cond, message, now)
+	}
+
+	return t.ValidateBatch(ful, cond, message, now, b)
+}
+
+// ValidateContext checks like ValidateAt, but compound types validate their
+// subfulfillments concurrently on the goroutines of pool, and stop as soon as
+// the outcome is decided. It returns ctx.Err() once ctx is done.
+func ValidateContext(ctx context.Context, ful Fulfillment, cond Condition, message []byte, now time.Time, pool *Pool) error {
+	t := TypeOf(ful)
+	if t == nil {
+		return errNotSupported
+	}
+
+	if TypeOfCondition(cond) != t {
+		return validation.ErrTypeMismatch
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if t.ValidateContext == nil {
+		return t.validateAt(ful, cond, message, now)
+	}
+
+	return t.ValidateContext(ctx, ful, cond, message, now, pool)
+}
+
+// Unmarshals a Fulfillment of any registered type out of JSON, dispatching on
+// its type field. Types that marshal to JSON must include that field.
+func UnmarshalFulfillmentJSON(b []byte) (Fulfillment, error) {
+	name, err := encoding.JSONType(b)
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByName(name)
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	ful := t.NewFulfillment()
+	if err := json.Unmarshal(b, ful); err != nil {
+		return nil, err
+	}
+
+	return ful, nil
+}
+
+// Unmarshals a Condition of any registered type out of JSON, dispatching on
+// its type field.
+func UnmarshalConditionJSON(b []byte) (Condition, error) {
+	name, err := encoding.JSONType(b)
+	if err != nil {
+		return nil, err
+	}
+
+	t := ByName(name)
+	if t == nil {
+		return nil, errNotSupported
+	}
+
+	cond := t.NewCondition()
+	if err := json.Unmarshal(b, cond); err != nil {
+		return nil, err
+	}
+
+	return cond, nil
+}
@@ -0,0 +1,57 @@
+package registry
+
+import "errors"
+
+// TypeSet is a set of condition types, each the bit of its DER tag, such as
+// the subtypes of a compound condition: the types of its subconditions and of
+// theirs, but not its own.
+type TypeSet uint32
+
+// Set returns the set of the type alone.
+func (t *Type) Set() TypeSet {
+	return 1 << uint(t.DERTag)
+}
+
+// Has reports whether the type is in the set.
+func (s TypeSet) Has(t *Type) bool {
+	return s&t.Set() != 0
+}
+
+// Names returns the names of the types in the set, in the order of their DER
+// tags. Types that aren't registered are left out.
+func (s TypeSet) Names() []string {
+	names := []string{}
+	for _, t := range Types() {
+		if s.Has(t) {
+			names = append(names, t.Name)
+		}
+	}
+
+	return names
+}
+
+// TypeSetOf returns the set of the named types, as listed in the subtypes
+// parameter of named-information URIs.
+func TypeSetOf(names []string) (TypeSet, error) {
+	var s TypeSet
+	for _, name := range names {
+		t := ByName(name)
+		if t == nil {
+			return 0, errors.New("unknown subtype " + name)
+		}
+		s |= t.Set()
+	}
+
+	return s, nil
+}
+
+// SubtypesOf returns the subtypes of a Condition of a compound type, or the
+// empty set for other types. Compound types implement Subtypes() on their
+// Condition.
+func SubtypesOf(cond Condition) TypeSet {
+	if c, ok := cond.(interface{ Subtypes() TypeSet }); ok {
+		return c.Subtypes()
+	}
+
+	return 0
+}
@@ -0,0 +1,193 @@
+package Rfc
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"math/big"
+
+	"crypto-conditions/encoding"
+)
+
+// Conditions of the simple types, SimpleSha256Condition in the spec
+type derCondition struct {
+	Fingerprint []byte   `asn1:"tag:0"`
+	Cost        *big.Int `asn1:"tag:1"`
+}
+
+// Conditions of the compound types, CompoundSha256Condition in the spec. The
+// Subtypes are always present, if empty.
+type derCompoundCondition struct {
+	Fingerprint []byte         `asn1:"tag:0"`
+	Cost        *big.Int       `asn1:"tag:1"`
+	Subtypes    asn1.BitString `asn1:"tag:2"`
+}
+
+// DER encodes val, a struct describing a SEQUENCE of the spec's ASN.1 module.
+// encoding/asn1 only fails on Go values it can't encode, which the structs of
+// this package aren't.
+func marshal(val interface{}) []byte {
+	b, err := asn1.Marshal(val)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// DER encodes val as marshal does, tagged as the alternative tag of a CHOICE.
+func choice(tag int, val interface{}) []byte {
+	b, err := encoding.MakeChoice(tag, val)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// A child Fulfillment or Condition is itself a CHOICE, so it is explicitly
+// tagged where the spec gives it a field of its own. encoding/asn1 leaves the
+// explicit tag on RawValues, so it is written and checked by hand.
+func explicit(tag int, b []byte) asn1.RawValue {
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      b,
+	}
+}
+
+// Unwraps the child explicitly tagged tag.
+func getExplicit(raw asn1.RawValue, tag int) ([]byte, error) {
+	if raw.Class != asn1.ClassContextSpecific || raw.Tag != tag || !raw.IsCompound {
+		return nil, errors.New("unexpected DER child")
+	}
+	return raw.Bytes, nil
+}
+
+// DER encodes a condition of any of the spec's types. Those of compound types
+// carry their subtypes.
+func makeCondition(cond Condition) []byte {
+	fingerprint := cond.fingerprint()
+
+	if cond.tag() == prefixTag || cond.tag() == thresholdTag {
+		return choice(cond.tag(), derCompoundCondition{
+			Fingerprint: fingerprint[:],
+			Cost:        encoding.MakeInteger(cond.cost()),
+			Subtypes:    encoding.MakeBitString(uint32(cond.Subtypes())),
+		})
+	}
+
+	return choice(cond.tag(), derCondition{
+		Fingerprint: fingerprint[:],
+		Cost:        encoding.MakeInteger(cond.cost()),
+	})
+}
+
+// Parses a condition of the type of the given tag out of the DER binary
+// format, returning its fingerprint, cost and subtypes.
+func getCondition(b []byte, tag int) ([32]byte, uint64, TypeSet, error) {
+	var fingerprint [32]byte
+	var der derCompoundCondition
+
+	if tag == prefixTag || tag == thresholdTag {
+		if err := encoding.GetChoice(b, tag, &der); err != nil {
+			return fingerprint, 0, 0, err
+		}
+	} else {
+		var simple derCondition
+		if err := encoding.GetChoice(b, tag, &simple); err != nil {
+			return fingerprint, 0, 0, err
+		}
+		der.Fingerprint, der.Cost = simple.Fingerprint, simple.Cost
+	}
+
+	if len(der.Fingerprint) != len(fingerprint) {
+		return fingerprint, 0, 0, errors.New("fingerprint must be 32 bytes")
+	}
+	copy(fingerprint[:], der.Fingerprint)
+
+	cost, err := encoding.GetInteger(der.Cost)
+	if err != nil {
+		return fingerprint, 0, 0, err
+	}
+
+	subtypes, err := encoding.GetBitString(der.Subtypes)
+	if err != nil {
+		return fingerprint, 0, 0, err
+	}
+	if err := checkSubtypes(tag, TypeSet(subtypes)); err != nil {
+		return fingerprint, 0, 0, err
+	}
+
+	return fingerprint, cost, TypeSet(subtypes), nil
+}
+
+// ParseFulfillmentBinary parses a fulfillment of any of the spec's types out
+// of the DER binary format, dispatching on its CHOICE tag.
+func ParseFulfillmentBinary(b []byte) (Fulfillment, error) {
+	tag, err := encoding.GetChoiceTag(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var ful Fulfillment
+	switch tag {
+	case preimageTag:
+		ful, err = ParsePreimageFulfillmentBinary(b)
+	case prefixTag:
+		ful, err = ParsePrefixFulfillmentBinary(b)
+	case thresholdTag:
+		ful, err = ParseThresholdFulfillmentBinary(b)
+	case rsaTag:
+		ful, err = ParseRsaFulfillmentBinary(b)
+	case ed25519Tag:
+		ful, err = ParseEd25519FulfillmentBinary(b)
+	default:
+		return nil, errors.New("not a fulfillment of the crypto-conditions spec")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ful, nil
+}
+
+// ParseConditionBinary parses a condition of any of the spec's types out of
+// the DER binary format, dispatching on its CHOICE tag.
+func ParseConditionBinary(b []byte) (Condition, error) {
+	tag, err := encoding.GetChoiceTag(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var cond Condition
+	switch tag {
+	case preimageTag:
+		cond, err = ParsePreimageConditionBinary(b)
+	case prefixTag:
+		cond, err = ParsePrefixConditionBinary(b)
+	case thresholdTag:
+		cond, err = ParseThresholdConditionBinary(b)
+	case rsaTag:
+		cond, err = ParseRsaConditionBinary(b)
+	case ed25519Tag:
+		cond, err = ParseEd25519ConditionBinary(b)
+	default:
+		return nil, errors.New("not a condition of the crypto-conditions spec")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cond, nil
+}
+
+// ParseFulfillment parses a fulfillment of any of the spec's types out of its
+// DER binary format, base64url encoded as Serialize encodes it.
+func ParseFulfillment(s string) (Fulfillment, error) {
+	b, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid fulfillment encoding")
+	}
+
+	return ParseFulfillmentBinary(b)
+}
@@ -0,0 +1,158 @@
+package Rfc
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Cost of every Ed25519Condition, as in the spec
+const ed25519Cost = 131072
+
+// Ed25519Fulfillment holds an Ed25519 public key and a signature of the
+// message.
+type Ed25519Fulfillment struct {
+	PublicKey []byte
+	Signature []byte
+}
+
+type derEd25519Fulfillment struct {
+	PublicKey []byte `asn1:"tag:0"`
+	Signature []byte `asn1:"tag:1"`
+}
+
+// Ed25519Sha256FingerprintContents in the spec
+type derEd25519Fingerprint struct {
+	PublicKey []byte `asn1:"tag:0"`
+}
+
+// Ed25519Condition commits to an Ed25519 public key.
+type Ed25519Condition struct {
+	Fingerprint [32]byte
+	Cost        uint64
+}
+
+// Serializes to the DER binary format, base64url encoded.
+func (ful *Ed25519Fulfillment) Serialize() string {
+	return serialize(ful)
+}
+
+// Serializes to the DER binary format.
+func (ful *Ed25519Fulfillment) SerializeBinary() ([]byte, error) {
+	return choice(ed25519Tag, derEd25519Fulfillment{PublicKey: ful.PublicKey, Signature: ful.Signature}), nil
+}
+
+// Parses Ed25519Fulfillment out of the DER binary format, and checks its
+// public key and signature lengths. The signature can only be checked against
+// a message, when validating.
+func ParseEd25519FulfillmentBinary(b []byte) (*Ed25519Fulfillment, error) {
+	var der derEd25519Fulfillment
+	if err := encoding.GetChoice(b, ed25519Tag, &der); err != nil {
+		return nil, err
+	}
+
+	if len(der.PublicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("public key must be 32 bytes")
+	}
+
+	if len(der.Signature) != ed25519.SignatureSize {
+		return nil, errors.New("signature must be 64 bytes")
+	}
+
+	return &Ed25519Fulfillment{PublicKey: der.PublicKey, Signature: der.Signature}, nil
+}
+
+// Signs the message with an Ed25519 private key, setting the PublicKey to
+// that of the key.
+func (ful *Ed25519Fulfillment) Sign(privkey ed25519.PrivateKey, message []byte) {
+	ful.PublicKey = []byte(privkey.Public().(ed25519.PublicKey))
+	ful.Signature = ed25519.Sign(privkey, message)
+}
+
+// Turns an in-memory Ed25519Fulfillment to an in-memory Ed25519Condition.
+func (ful *Ed25519Fulfillment) Condition() Ed25519Condition {
+	return Ed25519Condition{
+		Fingerprint: digest(derEd25519Fingerprint{PublicKey: ful.PublicKey}),
+		Cost:        ed25519Cost,
+	}
+}
+
+func (ful *Ed25519Fulfillment) condition() Condition {
+	cond := ful.Condition()
+	return &cond
+}
+
+// The signature must be valid for the message. It is added to b instead if b
+// isn't nil.
+func (ful *Ed25519Fulfillment) verify(message []byte, b *batch.Batch) error {
+	if b != nil {
+		b.Add(ful.PublicKey, message, ful.Signature)
+		return nil
+	}
+
+	if len(ful.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(ful.PublicKey, message, ful.Signature) {
+		return validation.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Checks that an in-memory Ed25519Fulfillment satisfies the Ed25519Condition:
+// the signature must be valid for the message.
+func (ful *Ed25519Fulfillment) Validate(cond *Ed25519Condition, message []byte) error {
+	return validate(ful, cond, message, nil)
+}
+
+// Checks as Validate does, but adds the signature to b instead of verifying
+// it. The Ed25519Fulfillment is only valid once b.Verify succeeds too.
+func (ful *Ed25519Fulfillment) ValidateBatch(cond *Ed25519Condition, message []byte, b *batch.Batch) error {
+	return validate(ful, cond, message, b)
+}
+
+func (cond *Ed25519Condition) tag() int              { return ed25519Tag }
+func (cond *Ed25519Condition) fingerprint() [32]byte { return cond.Fingerprint }
+func (cond *Ed25519Condition) cost() uint64          { return cond.Cost }
+
+// An Ed25519Condition has no subconditions, hence no subtypes.
+func (cond *Ed25519Condition) Subtypes() TypeSet {
+	return 0
+}
+
+// Serializes to the named-information URI format.
+func (cond *Ed25519Condition) Serialize() string {
+	return cond.URI()
+}
+
+// Serializes to the named-information URI format.
+func (cond *Ed25519Condition) URI() string {
+	return uri(cond)
+}
+
+// Serializes to the DER binary format.
+func (cond *Ed25519Condition) SerializeBinary() ([]byte, error) {
+	return makeCondition(cond), nil
+}
+
+// Parses Ed25519Condition out of the DER binary format.
+func ParseEd25519ConditionBinary(b []byte) (*Ed25519Condition, error) {
+	fingerprint, cost, _, err := getCondition(b, ed25519Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519Condition{Fingerprint: fingerprint, Cost: cost}, nil
+}
+
+// Parses Ed25519Condition out of the named-information URI format.
+func ParseEd25519URI(s string) (*Ed25519Condition, error) {
+	fingerprint, cost, _, err := parseURI(s, ed25519Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519Condition{Fingerprint: fingerprint, Cost: cost}, nil
+}
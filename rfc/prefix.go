@@ -0,0 +1,188 @@
+package Rfc
+
+import (
+	"encoding/asn1"
+	"math/big"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// PrefixFulfillment prepends the Prefix to the message its Subfulfillment is
+// validated against, messages being no longer than MaxMessageLength.
+type PrefixFulfillment struct {
+	Prefix           []byte
+	MaxMessageLength uint64
+	Subfulfillment   Fulfillment
+}
+
+// Explicit tag of the Subfulfillment and of the subcondition in the
+// fingerprint contents
+const derSubfulfillmentTag = 2
+
+type derPrefixFulfillment struct {
+	Prefix           []byte   `asn1:"tag:0"`
+	MaxMessageLength *big.Int `asn1:"tag:1"`
+	Subfulfillment   asn1.RawValue
+}
+
+// PrefixSha256FingerprintContents in the spec
+type derPrefixFingerprint struct {
+	Prefix           []byte   `asn1:"tag:0"`
+	MaxMessageLength *big.Int `asn1:"tag:1"`
+	Subcondition     asn1.RawValue
+}
+
+// PrefixCondition commits to the prefix, the max message length and the
+// condition of the subfulfillment.
+type PrefixCondition struct {
+	Fingerprint [32]byte
+	Cost        uint64
+	subtypes    TypeSet
+}
+
+// Serializes to the DER binary format, base64url encoded.
+func (ful *PrefixFulfillment) Serialize() string {
+	return serialize(ful)
+}
+
+// Serializes to the DER binary format.
+func (ful *PrefixFulfillment) SerializeBinary() ([]byte, error) {
+	sub, err := ful.Subfulfillment.SerializeBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return choice(prefixTag, derPrefixFulfillment{
+		Prefix:           ful.Prefix,
+		MaxMessageLength: encoding.MakeInteger(ful.MaxMessageLength),
+		Subfulfillment:   explicit(derSubfulfillmentTag, sub),
+	}), nil
+}
+
+// Parses PrefixFulfillment out of the DER binary format.
+func ParsePrefixFulfillmentBinary(b []byte) (*PrefixFulfillment, error) {
+	var der derPrefixFulfillment
+	if err := encoding.GetChoice(b, prefixTag, &der); err != nil {
+		return nil, err
+	}
+
+	maxMessageLength, err := encoding.GetInteger(der.MaxMessageLength)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := getExplicit(der.Subfulfillment, derSubfulfillmentTag)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := ParseFulfillmentBinary(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ful := &PrefixFulfillment{
+		Prefix:           der.Prefix,
+		MaxMessageLength: maxMessageLength,
+		Subfulfillment:   sub,
+	}
+
+	return ful, nil
+}
+
+// Turns an in-memory PrefixFulfillment to an in-memory PrefixCondition. The
+// cost is that of the subcondition, plus the lengths of the prefix and of the
+// longest message, plus 1024.
+func (ful *PrefixFulfillment) Condition() PrefixCondition {
+	sub := ful.Subfulfillment.condition()
+
+	cost := encoding.AddCost(sub.cost(), uint64(len(ful.Prefix)))
+	cost = encoding.AddCost(cost, ful.MaxMessageLength)
+	cost = encoding.AddCost(cost, subconditionCost)
+
+	return PrefixCondition{
+		Fingerprint: digest(derPrefixFingerprint{
+			Prefix:           ful.Prefix,
+			MaxMessageLength: encoding.MakeInteger(ful.MaxMessageLength),
+			Subcondition:     explicit(derSubfulfillmentTag, makeCondition(sub)),
+		}),
+		Cost:     cost,
+		subtypes: subtypesOf(prefixTag, []Condition{sub}),
+	}
+}
+
+func (ful *PrefixFulfillment) condition() Condition {
+	cond := ful.Condition()
+	return &cond
+}
+
+// The message must not exceed MaxMessageLength, and the Subfulfillment must
+// hold for it prefixed.
+func (ful *PrefixFulfillment) verify(message []byte, b *batch.Batch) error {
+	if uint64(len(message)) > ful.MaxMessageLength {
+		return validation.ErrMessageTooLong
+	}
+
+	prefixed := append(append([]byte{}, ful.Prefix...), message...)
+	return ful.Subfulfillment.verify(prefixed, b)
+}
+
+// Checks that an in-memory PrefixFulfillment satisfies the PrefixCondition:
+// the message must not exceed MaxMessageLength, and the Subfulfillment must
+// be valid for the message with the Prefix prepended.
+func (ful *PrefixFulfillment) Validate(cond *PrefixCondition, message []byte) error {
+	return validate(ful, cond, message, nil)
+}
+
+// Checks as Validate does, but adds the Ed25519 signatures to b instead of
+// verifying them. The PrefixFulfillment is only valid once b.Verify succeeds
+// too.
+func (ful *PrefixFulfillment) ValidateBatch(cond *PrefixCondition, message []byte, b *batch.Batch) error {
+	return validate(ful, cond, message, b)
+}
+
+func (cond *PrefixCondition) tag() int              { return prefixTag }
+func (cond *PrefixCondition) fingerprint() [32]byte { return cond.Fingerprint }
+func (cond *PrefixCondition) cost() uint64          { return cond.Cost }
+
+// Returns the types of the conditions below the PrefixCondition, less its own.
+func (cond *PrefixCondition) Subtypes() TypeSet {
+	return cond.subtypes
+}
+
+// Serializes to the named-information URI format.
+func (cond *PrefixCondition) Serialize() string {
+	return cond.URI()
+}
+
+// Serializes to the named-information URI format.
+func (cond *PrefixCondition) URI() string {
+	return uri(cond)
+}
+
+// Serializes to the DER binary format.
+func (cond *PrefixCondition) SerializeBinary() ([]byte, error) {
+	return makeCondition(cond), nil
+}
+
+// Parses PrefixCondition out of the DER binary format.
+func ParsePrefixConditionBinary(b []byte) (*PrefixCondition, error) {
+	fingerprint, cost, subtypes, err := getCondition(b, prefixTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrefixCondition{Fingerprint: fingerprint, Cost: cost, subtypes: subtypes}, nil
+}
+
+// Parses PrefixCondition out of the named-information URI format.
+func ParsePrefixURI(s string) (*PrefixCondition, error) {
+	fingerprint, cost, subtypes, err := parseURI(s, prefixTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrefixCondition{Fingerprint: fingerprint, Cost: cost, subtypes: subtypes}, nil
+}
@@ -0,0 +1,112 @@
+package Rfc
+
+import (
+	"crypto/sha256"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+)
+
+// PreimageFulfillment reveals the preimage of a SHA-256 digest.
+type PreimageFulfillment struct {
+	Preimage []byte
+}
+
+type derPreimageFulfillment struct {
+	Preimage []byte `asn1:"tag:0"`
+}
+
+// PreimageCondition commits to the SHA-256 digest of a preimage.
+type PreimageCondition struct {
+	Fingerprint [32]byte
+	Cost        uint64
+}
+
+// Serializes to the DER binary format, base64url encoded.
+func (ful *PreimageFulfillment) Serialize() string {
+	return serialize(ful)
+}
+
+// Serializes to the DER binary format.
+func (ful *PreimageFulfillment) SerializeBinary() ([]byte, error) {
+	return choice(preimageTag, derPreimageFulfillment{Preimage: ful.Preimage}), nil
+}
+
+// Parses PreimageFulfillment out of the DER binary format.
+func ParsePreimageFulfillmentBinary(b []byte) (*PreimageFulfillment, error) {
+	var der derPreimageFulfillment
+	if err := encoding.GetChoice(b, preimageTag, &der); err != nil {
+		return nil, err
+	}
+
+	return &PreimageFulfillment{Preimage: der.Preimage}, nil
+}
+
+// Turns an in-memory PreimageFulfillment to an in-memory PreimageCondition.
+// The cost is the length of the preimage.
+func (ful *PreimageFulfillment) Condition() PreimageCondition {
+	return PreimageCondition{
+		Fingerprint: sha256.Sum256(ful.Preimage),
+		Cost:        uint64(len(ful.Preimage)),
+	}
+}
+
+func (ful *PreimageFulfillment) condition() Condition {
+	cond := ful.Condition()
+	return &cond
+}
+
+// A preimage has nothing to check beyond its fingerprint.
+func (ful *PreimageFulfillment) verify(message []byte, b *batch.Batch) error {
+	return nil
+}
+
+// Checks that an in-memory PreimageFulfillment satisfies the
+// PreimageCondition. The message is not used.
+func (ful *PreimageFulfillment) Validate(cond *PreimageCondition, message []byte) error {
+	return validate(ful, cond, message, nil)
+}
+
+func (cond *PreimageCondition) tag() int              { return preimageTag }
+func (cond *PreimageCondition) fingerprint() [32]byte { return cond.Fingerprint }
+func (cond *PreimageCondition) cost() uint64          { return cond.Cost }
+
+// A PreimageCondition has no subconditions, hence no subtypes.
+func (cond *PreimageCondition) Subtypes() TypeSet {
+	return 0
+}
+
+// Serializes to the named-information URI format.
+func (cond *PreimageCondition) Serialize() string {
+	return cond.URI()
+}
+
+// Serializes to the named-information URI format.
+func (cond *PreimageCondition) URI() string {
+	return uri(cond)
+}
+
+// Serializes to the DER binary format.
+func (cond *PreimageCondition) SerializeBinary() ([]byte, error) {
+	return makeCondition(cond), nil
+}
+
+// Parses PreimageCondition out of the DER binary format.
+func ParsePreimageConditionBinary(b []byte) (*PreimageCondition, error) {
+	fingerprint, cost, _, err := getCondition(b, preimageTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreimageCondition{Fingerprint: fingerprint, Cost: cost}, nil
+}
+
+// Parses PreimageCondition out of the named-information URI format.
+func ParsePreimageURI(s string) (*PreimageCondition, error) {
+	fingerprint, cost, _, err := parseURI(s, preimageTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreimageCondition{Fingerprint: fingerprint, Cost: cost}, nil
+}
@@ -0,0 +1,335 @@
+// Generates and parses the condition types of the crypto-conditions spec, as
+// its ASN.1 module encodes them. Unlike the types of the Crypto Conditions
+// string format, they carry no MaxFulfillmentLength, fingerprint the DER
+// fingerprint contents of the spec, and only take one another as children.
+// They have no "cf:" and "cc:" forms: fulfillments serialize to their DER
+// binary format, base64url encoded, and conditions to named-information URIs.
+//
+// The spec's DER CHOICE tags its types 0 to 4, as the string-format types
+// are tagged in the registry, with other fields. So that neither binary
+// format changes, the spec's types aren't registered: they are parsed and
+// validated with the functions of this package, not the generic ones, and
+// the codecs reject them.
+package Rfc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math"
+	"sort"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/validation"
+)
+
+// Tags of the types in the Fulfillment and Condition CHOICEs of the spec
+const (
+	preimageTag  = 0
+	prefixTag    = 1
+	thresholdTag = 2
+	rsaTag       = 3
+	ed25519Tag   = 4
+)
+
+// TypeSet is a set of the spec's types, each the bit of its tag, such as the
+// subtypes of a compound condition: the types of its subconditions and of
+// theirs, but not its own.
+type TypeSet uint32
+
+// The types of the spec, the only ones subtypes may list
+const specTypes TypeSet = 1<<preimageTag | 1<<prefixTag | 1<<thresholdTag | 1<<rsaTag | 1<<ed25519Tag
+
+// Names of the types in the fpt and subtypes parameters, by tag
+var typeNames = [...]string{
+	preimageTag:  encoding.PreimageSha256Name,
+	prefixTag:    encoding.PrefixSha256Name,
+	thresholdTag: encoding.ThresholdSha256Name,
+	rsaTag:       encoding.RsaSha256Name,
+	ed25519Tag:   encoding.Ed25519Sha256Name,
+}
+
+// Feature suites each type needs, by tag
+var typeFeatures = [...]features.Bitmask{
+	preimageTag:  features.Sha256 | features.Preimage,
+	prefixTag:    features.Sha256 | features.Prefix,
+	thresholdTag: features.Sha256 | features.Threshold,
+	rsaTag:       features.Sha256 | features.RsaPss,
+	ed25519Tag:   features.Sha256 | features.Ed25519,
+}
+
+// Cost the spec adds for each subcondition of a compound condition
+const subconditionCost = 1024
+
+// Fulfillment is implemented by the fulfillments of the spec's types, which
+// compound fulfillments take as children.
+type Fulfillment interface {
+	Serialize() string
+	SerializeBinary() ([]byte, error)
+	// Derives the Condition
+	condition() Condition
+	// Checks what doesn't depend on the Condition, such as signatures, which
+	// are added to b instead of verified if it isn't nil
+	verify(message []byte, b *batch.Batch) error
+}
+
+// Condition is implemented by the conditions of the spec's types, which
+// compound fulfillments take as children.
+type Condition interface {
+	Serialize() string
+	SerializeBinary() ([]byte, error)
+	URI() string
+	// Types of the conditions below, less its own. Only those of compound
+	// types have any.
+	Subtypes() TypeSet
+	tag() int
+	fingerprint() [32]byte
+	cost() uint64
+}
+
+// Checks that ful satisfies cond, which must be of the same type.
+func validate(ful Fulfillment, cond Condition, message []byte, b *batch.Batch) error {
+	derived := ful.condition()
+	if derived.fingerprint() != cond.fingerprint() {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if derived.cost() > cond.cost() {
+		return validation.ErrCostExceeded
+	}
+
+	return ful.verify(message, b)
+}
+
+// Names returns the names of the types in the set, in the order of their tags.
+func (s TypeSet) Names() []string {
+	names := []string{}
+	for tag, name := range typeNames {
+		if s&(1<<uint(tag)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Returns the set of the named types, as listed in the subtypes parameter of
+// named-information URIs.
+func typeSetOf(names []string) (TypeSet, error) {
+	var s TypeSet
+	for _, name := range names {
+		tag := -1
+		for t, n := range typeNames {
+			if n == name {
+				tag = t
+			}
+		}
+		if tag < 0 {
+			return 0, errors.New("subtypes must be types of the crypto-conditions spec")
+		}
+		s |= 1 << uint(tag)
+	}
+
+	return s, nil
+}
+
+// Features returns the feature suites a fulfillment needs to be verified,
+// those of its subconditions included.
+func Features(ful Fulfillment) features.Bitmask {
+	return featuresOf(ful.condition())
+}
+
+// Returns the feature suites a condition needs, those of its subtypes
+// included.
+func featuresOf(cond Condition) features.Bitmask {
+	suites := typeFeatures[cond.tag()]
+	subtypes := cond.Subtypes()
+	for tag := range typeFeatures {
+		if subtypes&(1<<uint(tag)) != 0 {
+			suites |= typeFeatures[tag]
+		}
+	}
+
+	return suites
+}
+
+// Returns the subtypes of a compound condition of the given tag over the
+// children: their types and subtypes, less its own type.
+func subtypesOf(tag int, children []Condition) TypeSet {
+	var subtypes TypeSet
+	for _, child := range children {
+		subtypes |= 1<<uint(child.tag()) | child.Subtypes()
+	}
+
+	return subtypes &^ (1 << uint(tag))
+}
+
+// Checks the subtypes of a compound condition of the given tag.
+func checkSubtypes(tag int, subtypes TypeSet) error {
+	if subtypes&^specTypes != 0 {
+		return errors.New("subtypes must be types of the crypto-conditions spec")
+	}
+
+	if subtypes&(1<<uint(tag)) != 0 {
+		return errors.New("subtypes of a " + typeNames[tag] + " condition can't include it")
+	}
+
+	return nil
+}
+
+// Returns the SHA-256 digest of the DER encoding of the fingerprint contents.
+func digest(contents interface{}) [32]byte {
+	return sha256.Sum256(marshal(contents))
+}
+
+// Adds up the costs of the threshold most expensive conditions, to which the
+// spec adds subconditionCost per condition.
+func thresholdCost(threshold int, conds []Condition) uint64 {
+	costs := make([]uint64, len(conds))
+	for i, cond := range conds {
+		costs[i] = cond.cost()
+	}
+	sort.Slice(costs, func(i, j int) bool { return costs[i] > costs[j] })
+
+	var cost uint64
+	for i := 0; i < threshold && i < len(costs); i++ {
+		cost = encoding.AddCost(cost, costs[i])
+	}
+
+	if uint64(len(conds)) > math.MaxUint64/subconditionCost {
+		return math.MaxUint64
+	}
+	return encoding.AddCost(cost, subconditionCost*uint64(len(conds)))
+}
+
+// Serializes a fulfillment of any of the spec's types, its DER binary format
+// base64url encoded.
+func serialize(ful Fulfillment) string {
+	b, err := ful.SerializeBinary()
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Serializes a condition of any of the spec's types to the named-information
+// URI format.
+func uri(cond Condition) string {
+	u := encoding.URI{
+		Type:        typeNames[cond.tag()],
+		Fingerprint: cond.fingerprint(),
+		Cost:        cond.cost(),
+		Subtypes:    cond.Subtypes().Names(),
+	}
+
+	return u.String()
+}
+
+// Parses the named-information URI of a condition of the type of the given
+// tag, returning its fingerprint, cost and subtypes.
+func parseURI(s string, tag int) ([32]byte, uint64, TypeSet, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return [32]byte{}, 0, 0, err
+	}
+
+	if u.Type != typeNames[tag] {
+		return [32]byte{}, 0, 0, errors.New("not a " + typeNames[tag] + " condition")
+	}
+
+	subtypes, err := typeSetOf(u.Subtypes)
+	if err != nil {
+		return [32]byte{}, 0, 0, err
+	}
+
+	if err := checkSubtypes(tag, subtypes); err != nil {
+		return [32]byte{}, 0, 0, err
+	}
+
+	return u.Fingerprint, u.Cost, subtypes, nil
+}
+
+// ParseURI parses a condition of any of the spec's types out of the
+// named-information URI format, dispatching on its fpt parameter.
+func ParseURI(s string) (Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var cond Condition
+	switch u.Type {
+	case encoding.PreimageSha256Name:
+		cond, err = ParsePreimageURI(s)
+	case encoding.PrefixSha256Name:
+		cond, err = ParsePrefixURI(s)
+	case encoding.ThresholdSha256Name:
+		cond, err = ParseThresholdURI(s)
+	case encoding.RsaSha256Name:
+		cond, err = ParseRsaURI(s)
+	case encoding.Ed25519Sha256Name:
+		cond, err = ParseEd25519URI(s)
+	default:
+		return nil, errors.New("not a condition of the crypto-conditions spec")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cond, nil
+}
+
+// Validate checks that a fulfillment satisfies a condition, both in the DER
+// binary format of the spec.
+func Validate(fulfillment []byte, condition []byte, message []byte) error {
+	ful, cond, err := parseBoth(fulfillment, condition)
+	if err != nil {
+		return err
+	}
+
+	return validate(ful, cond, message, nil)
+}
+
+// ValidateBatch checks like Validate, but verifies the Ed25519 signatures of
+// the whole fulfillment tree together with b once everything else is
+// checked. b.Invalid then tells which signatures failed.
+func ValidateBatch(fulfillment []byte, condition []byte, message []byte, b *batch.Batch) error {
+	ful, cond, err := parseBoth(fulfillment, condition)
+	if err != nil {
+		return err
+	}
+
+	if err := validate(ful, cond, message, b); err != nil {
+		return err
+	}
+
+	return b.Verify()
+}
+
+// Parses a fulfillment and a condition of the same type out of the DER
+// binary format.
+func parseBoth(fulfillment []byte, condition []byte) (Fulfillment, Condition, error) {
+	ful, err := ParseFulfillmentBinary(fulfillment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cond, err := ParseConditionBinary(condition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ful.condition().tag() != cond.tag() {
+		return nil, nil, validation.ErrTypeMismatch
+	}
+
+	return ful, cond, nil
+}
+
+// ConditionOf derives the condition of a fulfillment of any of the spec's
+// types.
+func ConditionOf(ful Fulfillment) Condition {
+	return ful.condition()
+}
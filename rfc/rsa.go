@@ -0,0 +1,202 @@
+package Rfc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"math/bits"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Public exponent of every RSA key, and length of the RSA-PSS salt, that of
+// a SHA-256 digest, as in the spec
+const (
+	rsaPublicExponent = 65537
+	rsaSaltLength     = 32
+)
+
+// RsaFulfillment holds an RSA public key modulus and an RSA-PSS signature of
+// the message with SHA-256, as long as the modulus.
+type RsaFulfillment struct {
+	Modulus   []byte
+	Signature []byte
+}
+
+type derRsaFulfillment struct {
+	Modulus   []byte `asn1:"tag:0"`
+	Signature []byte `asn1:"tag:1"`
+}
+
+// RsaSha256FingerprintContents in the spec
+type derRsaFingerprint struct {
+	Modulus []byte `asn1:"tag:0"`
+}
+
+// RsaCondition commits to an RSA public key modulus.
+type RsaCondition struct {
+	Fingerprint [32]byte
+	Cost        uint64
+}
+
+// Serializes to the DER binary format, base64url encoded.
+func (ful *RsaFulfillment) Serialize() string {
+	return serialize(ful)
+}
+
+// Serializes to the DER binary format.
+func (ful *RsaFulfillment) SerializeBinary() ([]byte, error) {
+	return choice(rsaTag, derRsaFulfillment{Modulus: ful.Modulus, Signature: ful.Signature}), nil
+}
+
+// Parses RsaFulfillment out of the DER binary format, and checks its modulus
+// and signature lengths. The signature can only be checked against a
+// message, when validating.
+func ParseRsaFulfillmentBinary(b []byte) (*RsaFulfillment, error) {
+	var der derRsaFulfillment
+	if err := encoding.GetChoice(b, rsaTag, &der); err != nil {
+		return nil, err
+	}
+
+	if err := checkModulus(der.Modulus); err != nil {
+		return nil, err
+	}
+
+	if len(der.Signature) != len(der.Modulus) {
+		return nil, errors.New("signature must be as long as the modulus")
+	}
+
+	return &RsaFulfillment{Modulus: der.Modulus, Signature: der.Signature}, nil
+}
+
+// Signs the message with an RSA private key, setting the Modulus to that of
+// the key.
+func (ful *RsaFulfillment) Sign(privkey *rsa.PrivateKey, message []byte) error {
+	if privkey.E != rsaPublicExponent {
+		return errors.New("public exponent must be 65537")
+	}
+
+	modulus := privkey.N.Bytes()
+	if err := checkModulus(modulus); err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(message)
+	signature, err := rsa.SignPSS(rand.Reader, privkey, crypto.SHA256, hash[:], &rsa.PSSOptions{
+		SaltLength: rsaSaltLength,
+		Hash:       crypto.SHA256,
+	})
+	if err != nil {
+		return err
+	}
+
+	ful.Modulus = modulus
+	ful.Signature = signature
+	return nil
+}
+
+// Checks that a modulus is a big-endian number of 1024 to 4096 bits without
+// leading zeros. The spec allows moduli down to 1017 bits, but crypto/rsa
+// refuses those under 1024 bits, which could then never be validated.
+func checkModulus(modulus []byte) error {
+	if len(modulus) < 128 || len(modulus) > 512 || modulus[0] == 0 ||
+		8*(len(modulus)-1)+bits.Len8(modulus[0]) < 1024 {
+		return errors.New("modulus must be between 1024 and 4096 bits")
+	}
+
+	return nil
+}
+
+// Turns an in-memory RsaFulfillment to an in-memory RsaCondition. The cost
+// is the square of the length of the modulus.
+func (ful *RsaFulfillment) Condition() RsaCondition {
+	length := uint64(len(ful.Modulus))
+
+	return RsaCondition{
+		Fingerprint: digest(derRsaFingerprint{Modulus: ful.Modulus}),
+		Cost:        length * length,
+	}
+}
+
+func (ful *RsaFulfillment) condition() Condition {
+	cond := ful.Condition()
+	return &cond
+}
+
+// The signature must be a valid RSA-PSS signature of the message.
+func (ful *RsaFulfillment) verify(message []byte, b *batch.Batch) error {
+	if checkModulus(ful.Modulus) != nil || len(ful.Signature) != len(ful.Modulus) {
+		return validation.ErrSignatureInvalid
+	}
+
+	pubkey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(ful.Modulus),
+		E: rsaPublicExponent,
+	}
+
+	hash := sha256.Sum256(message)
+	err := rsa.VerifyPSS(pubkey, crypto.SHA256, hash[:], ful.Signature, &rsa.PSSOptions{
+		SaltLength: rsaSaltLength,
+		Hash:       crypto.SHA256,
+	})
+	if err != nil {
+		return validation.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Checks that an in-memory RsaFulfillment satisfies the RsaCondition: the
+// signature must be valid for the message.
+func (ful *RsaFulfillment) Validate(cond *RsaCondition, message []byte) error {
+	return validate(ful, cond, message, nil)
+}
+
+func (cond *RsaCondition) tag() int              { return rsaTag }
+func (cond *RsaCondition) fingerprint() [32]byte { return cond.Fingerprint }
+func (cond *RsaCondition) cost() uint64          { return cond.Cost }
+
+// An RsaCondition has no subconditions, hence no subtypes.
+func (cond *RsaCondition) Subtypes() TypeSet {
+	return 0
+}
+
+// Serializes to the named-information URI format.
+func (cond *RsaCondition) Serialize() string {
+	return cond.URI()
+}
+
+// Serializes to the named-information URI format.
+func (cond *RsaCondition) URI() string {
+	return uri(cond)
+}
+
+// Serializes to the DER binary format.
+func (cond *RsaCondition) SerializeBinary() ([]byte, error) {
+	return makeCondition(cond), nil
+}
+
+// Parses RsaCondition out of the DER binary format.
+func ParseRsaConditionBinary(b []byte) (*RsaCondition, error) {
+	fingerprint, cost, _, err := getCondition(b, rsaTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RsaCondition{Fingerprint: fingerprint, Cost: cost}, nil
+}
+
+// Parses RsaCondition out of the named-information URI format.
+func ParseRsaURI(s string) (*RsaCondition, error) {
+	fingerprint, cost, _, err := parseURI(s, rsaTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RsaCondition{Fingerprint: fingerprint, Cost: cost}, nil
+}
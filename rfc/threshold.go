@@ -0,0 +1,205 @@
+package Rfc
+
+import (
+	"encoding/asn1"
+	"math/big"
+
+	"crypto-conditions/batch"
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// ThresholdFulfillment fulfills a threshold condition with as many
+// SubFulfillments as its threshold, all of which must be valid, and the
+// SubConditions left unfulfilled.
+type ThresholdFulfillment struct {
+	SubFulfillments []Fulfillment
+	SubConditions   []Condition
+}
+
+// The children are DER CHOICEs, so that they can be of any of the spec's
+// types. encoding/asn1 orders the elements of a SET OF as DER does.
+type derThresholdFulfillment struct {
+	SubFulfillments []asn1.RawValue `asn1:"set,tag:0"`
+	SubConditions   []asn1.RawValue `asn1:"set,tag:1"`
+}
+
+// ThresholdSha256FingerprintContents in the spec
+type derThresholdFingerprint struct {
+	Threshold     *big.Int        `asn1:"tag:0"`
+	SubConditions []asn1.RawValue `asn1:"set,tag:1"`
+}
+
+// ThresholdCondition commits to the threshold and to the conditions of the
+// subfulfillments and subconditions.
+type ThresholdCondition struct {
+	Fingerprint [32]byte
+	Cost        uint64
+	subtypes    TypeSet
+}
+
+// Serializes to the DER binary format, base64url encoded.
+func (ful *ThresholdFulfillment) Serialize() string {
+	return serialize(ful)
+}
+
+// Serializes to the DER binary format.
+func (ful *ThresholdFulfillment) SerializeBinary() ([]byte, error) {
+	der := derThresholdFulfillment{
+		SubFulfillments: []asn1.RawValue{},
+		SubConditions:   []asn1.RawValue{},
+	}
+
+	for _, sub := range ful.SubFulfillments {
+		b, err := sub.SerializeBinary()
+		if err != nil {
+			return nil, err
+		}
+		der.SubFulfillments = append(der.SubFulfillments, asn1.RawValue{FullBytes: b})
+	}
+
+	for _, sub := range ful.SubConditions {
+		der.SubConditions = append(der.SubConditions, asn1.RawValue{FullBytes: makeCondition(sub)})
+	}
+
+	return choice(thresholdTag, der), nil
+}
+
+// Parses ThresholdFulfillment out of the DER binary format.
+func ParseThresholdFulfillmentBinary(b []byte) (*ThresholdFulfillment, error) {
+	var der derThresholdFulfillment
+	if err := encoding.GetChoice(b, thresholdTag, &der); err != nil {
+		return nil, err
+	}
+
+	ful := &ThresholdFulfillment{}
+
+	for _, raw := range der.SubFulfillments {
+		sub, err := ParseFulfillmentBinary(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		ful.SubFulfillments = append(ful.SubFulfillments, sub)
+	}
+
+	for _, raw := range der.SubConditions {
+		sub, err := ParseConditionBinary(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		ful.SubConditions = append(ful.SubConditions, sub)
+	}
+
+	return ful, nil
+}
+
+// Returns the conditions of the SubFulfillments, then the SubConditions.
+func (ful *ThresholdFulfillment) conditions() []Condition {
+	conds := make([]Condition, 0, len(ful.SubFulfillments)+len(ful.SubConditions))
+	for _, sub := range ful.SubFulfillments {
+		conds = append(conds, sub.condition())
+	}
+
+	return append(conds, ful.SubConditions...)
+}
+
+// Turns an in-memory ThresholdFulfillment to an in-memory ThresholdCondition,
+// whose threshold is the number of SubFulfillments. The cost is the sum of
+// the costs of the threshold most expensive subconditions, plus 1024 per
+// subcondition.
+func (ful *ThresholdFulfillment) Condition() ThresholdCondition {
+	conds := ful.conditions()
+	threshold := len(ful.SubFulfillments)
+
+	der := derThresholdFingerprint{
+		Threshold:     big.NewInt(int64(threshold)),
+		SubConditions: []asn1.RawValue{},
+	}
+	for _, cond := range conds {
+		der.SubConditions = append(der.SubConditions, asn1.RawValue{FullBytes: makeCondition(cond)})
+	}
+
+	return ThresholdCondition{
+		Fingerprint: digest(der),
+		Cost:        thresholdCost(threshold, conds),
+		subtypes:    subtypesOf(thresholdTag, conds),
+	}
+}
+
+func (ful *ThresholdFulfillment) condition() Condition {
+	cond := ful.Condition()
+	return &cond
+}
+
+// The spec's thresholds are at least 1, and every SubFulfillment must hold.
+func (ful *ThresholdFulfillment) verify(message []byte, b *batch.Batch) error {
+	if len(ful.SubFulfillments) == 0 {
+		return validation.ErrThresholdNotReached
+	}
+
+	for _, sub := range ful.SubFulfillments {
+		if err := sub.verify(message, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks that an in-memory ThresholdFulfillment satisfies the
+// ThresholdCondition: every SubFulfillment must be valid for the message.
+func (ful *ThresholdFulfillment) Validate(cond *ThresholdCondition, message []byte) error {
+	return validate(ful, cond, message, nil)
+}
+
+// Checks as Validate does, but adds the Ed25519 signatures to b instead of
+// verifying them. The ThresholdFulfillment is only valid once b.Verify
+// succeeds too.
+func (ful *ThresholdFulfillment) ValidateBatch(cond *ThresholdCondition, message []byte, b *batch.Batch) error {
+	return validate(ful, cond, message, b)
+}
+
+func (cond *ThresholdCondition) tag() int              { return thresholdTag }
+func (cond *ThresholdCondition) fingerprint() [32]byte { return cond.Fingerprint }
+func (cond *ThresholdCondition) cost() uint64          { return cond.Cost }
+
+// Returns the types of the conditions below the ThresholdCondition, less its
+// own.
+func (cond *ThresholdCondition) Subtypes() TypeSet {
+	return cond.subtypes
+}
+
+// Serializes to the named-information URI format.
+func (cond *ThresholdCondition) Serialize() string {
+	return cond.URI()
+}
+
+// Serializes to the named-information URI format.
+func (cond *ThresholdCondition) URI() string {
+	return uri(cond)
+}
+
+// Serializes to the DER binary format.
+func (cond *ThresholdCondition) SerializeBinary() ([]byte, error) {
+	return makeCondition(cond), nil
+}
+
+// Parses ThresholdCondition out of the DER binary format.
+func ParseThresholdConditionBinary(b []byte) (*ThresholdCondition, error) {
+	fingerprint, cost, subtypes, err := getCondition(b, thresholdTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThresholdCondition{Fingerprint: fingerprint, Cost: cost, subtypes: subtypes}, nil
+}
+
+// Parses ThresholdCondition out of the named-information URI format.
+func ParseThresholdURI(s string) (*ThresholdCondition, error) {
+	fingerprint, cost, subtypes, err := parseURI(s, thresholdTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThresholdCondition{Fingerprint: fingerprint, Cost: cost, subtypes: subtypes}, nil
+}
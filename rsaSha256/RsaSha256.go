@@ -0,0 +1,369 @@
+// Generates and parses RSA-Sha256 Crypto Conditions
+package RsaSha256
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Moduli must be between 1024 and 4096 bits long. The crypto-conditions spec
+// allows moduli down to 1017 bits, but crypto/rsa refuses those under 1024
+// bits, which could then never be validated.
+const (
+	MinModulusLength = 128
+	MaxModulusLength = 512
+)
+
+// Public exponent of every RSA key, as in the crypto-conditions spec
+const PublicExponent = 65537
+
+// Length of the RSA-PSS salt, that of a SHA-256 digest
+const saltLength = 32
+
+// Fulfillment holds an RSA public key modulus and an RSA-PSS signature of the
+// message with SHA-256. The signature is as long as the modulus.
+type Fulfillment struct {
+	Modulus   []byte
+	Signature []byte
+}
+
+// Serializes to the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) Serialize() string {
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
+
+// Appends the Crypto Conditions Fulfillment string format to dst, without
+// allocating if dst has room for SerializedLength more bytes.
+func (ful *Fulfillment) AppendSerialize(dst []byte) []byte {
+	a := encoding.NewBase64Appender(append(dst, "cf:1:16:"...))
+	a.AppendVarbyte(ful.Modulus)
+	a.AppendVarbyte(ful.Signature)
+	return a.Finish()
+}
+
+// Returns the length of the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) SerializedLength() int {
+	payload := encoding.VarbyteLength(uint64(len(ful.Modulus))) +
+		encoding.VarbyteLength(uint64(len(ful.Signature)))
+
+	return len("cf:1:16:") + int(encoding.Base64Length(payload))
+}
+
+// Signs the message with an RSA private key, setting the Modulus to that of the key.
+func (ful *Fulfillment) Sign(privkey *rsa.PrivateKey, message []byte) error {
+	if privkey.E != PublicExponent {
+		return errors.New("public exponent must be 65537")
+	}
+
+	modulus := privkey.N.Bytes()
+	if err := checkModulus(modulus); err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(message)
+	signature, err := rsa.SignPSS(rand.Reader, privkey, crypto.SHA256, hash[:], &rsa.PSSOptions{
+		SaltLength: saltLength,
+		Hash:       crypto.SHA256,
+	})
+	if err != nil {
+		return err
+	}
+
+	ful.Modulus = modulus
+	ful.Signature = signature
+	return nil
+}
+
+// Checks that a modulus is a big-endian number of 1024 to 4096 bits without
+// leading zeros.
+func checkModulus(modulus []byte) error {
+	if len(modulus) < MinModulusLength || len(modulus) > MaxModulusLength || modulus[0] == 0 ||
+		8*(len(modulus)-1)+bits.Len8(modulus[0]) < 1024 {
+		return errors.New("modulus must be between 1024 and 4096 bits")
+	}
+
+	return nil
+}
+
+// Parses Fulfillment out of the Crypto Conditions string format, and checks
+// its modulus and signature lengths. The signature can only be checked against
+// a message, when validating.
+func ParseFulfillment(s string) (*Fulfillment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cf" {
+		return nil, errors.New("fulfillments must start with \"cf\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "16" {
+		return nil, errors.New("not an RsaSha256 condition")
+	}
+
+	b, err := base64.URLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.New("parsing error")
+	}
+
+	modulus, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("parsing error")
+	}
+
+	ful := &Fulfillment{
+		Modulus:   modulus,
+		Signature: signature,
+	}
+
+	if err := ful.check(); err != nil {
+		return nil, err
+	}
+
+	return ful, nil
+}
+
+// Checks the modulus, and that the signature is as long as it.
+func (ful *Fulfillment) check() error {
+	if err := checkModulus(ful.Modulus); err != nil {
+		return err
+	}
+
+	if len(ful.Signature) != len(ful.Modulus) {
+		return errors.New("signature must be as long as the modulus")
+	}
+
+	return nil
+}
+
+// Checks the RSA-PSS signature of the message.
+func (ful *Fulfillment) verify(message []byte) bool {
+	pubkey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(ful.Modulus),
+		E: PublicExponent,
+	}
+
+	hash := sha256.Sum256(message)
+	err := rsa.VerifyPSS(pubkey, crypto.SHA256, hash[:], ful.Signature, &rsa.PSSOptions{
+		SaltLength: saltLength,
+		Hash:       crypto.SHA256,
+	})
+
+	return err == nil
+}
+
+// Returns the length of fulfillments whose modulus has the given length.
+// Signatures being as long as the modulus, it doesn't depend on them.
+func fulfillmentLength(modulusLength uint64) uint64 {
+	payload := 2 * encoding.VarbyteLength(modulusLength)
+	return uint64(len("cf:1:16:")) + encoding.Base64Length(payload)
+}
+
+// Returns the length of the longest valid modulus whose fulfillment is no
+// longer than the given length, or 0 if there is none.
+func maxModulusLength(maxFulfillmentLength uint64) uint64 {
+	for n := uint64(MaxModulusLength); n >= MinModulusLength; n-- {
+		if fulfillmentLength(n) <= maxFulfillmentLength {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// Turns an in-memory Fulfillment to an in-memory Condition. The fingerprint
+// commits to the Modulus, and the Cost is the square of its length in bytes,
+// as in the crypto-conditions spec.
+func (ful *Fulfillment) Condition() Condition {
+	hash := sha256.Sum256(bytes.Join([][]byte{
+		encoding.MakeVarbyte(ful.Modulus),
+	}, []byte{}))
+
+	n := uint64(len(ful.Modulus))
+
+	return Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: fulfillmentLength(n),
+		Cost:                 n * n,
+	}
+}
+
+// Conditions parsed from the Crypto Conditions string format only know the
+// longest modulus that fits their MaxFulfillmentLength, and get the Cost of
+// it. Conditions parsed from the named-information URI format have no
+// MaxFulfillmentLength, which is then set to the largest uint64.
+type Condition struct {
+	Hash                 [32]byte
+	MaxFulfillmentLength uint64
+	Cost                 uint64
+}
+
+// Serializes to the Crypto Conditions string format.
+func (cond *Condition) Serialize() string {
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	return encoding.AppendCondition(dst, "16", cond.Hash[:], cond.MaxFulfillmentLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return encoding.ConditionLength("16", cond.MaxFulfillmentLength)
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "16" {
+		return nil, errors.New("not an RsaSha256 condition")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max fulfillment length")
+	}
+
+	n := maxModulusLength(length)
+
+	cond := &Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: length,
+		Cost:                 n * n,
+	}
+
+	return cond, nil
+}
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:        encoding.LegacyRsaSha256Name,
+		Fingerprint: cond.Hash,
+		Cost:        cond.Cost,
+	}
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.LegacyRsaSha256Name {
+		return nil, errors.New("not an RsaSha256 condition")
+	}
+
+	cond := &Condition{
+		Hash:                 u.Fingerprint,
+		MaxFulfillmentLength: math.MaxUint64,
+		Cost:                 u.Cost,
+	}
+
+	return cond, nil
+}
+
+func FulfillmentToCondition(s string) (string, error) {
+	ful, err := ParseFulfillment(s)
+	if err != nil {
+		return "", err
+	}
+
+	cond := ful.Condition()
+
+	condString := cond.Serialize()
+	return condString, nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition: the modulus
+// must hash to the Condition's fingerprint and be between 1024 and 4096 bits,
+// the fulfillment must fit the Condition's MaxFulfillmentLength and Cost, and
+// the signature must be a valid RSA-PSS signature of the message.
+func (ful *Fulfillment) Validate(cond *Condition, message []byte) error {
+	derived := ful.Condition()
+	if derived.Hash != cond.Hash {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if err := ful.check(); err != nil {
+		return err
+	}
+
+	if uint64(ful.SerializedLength()) > cond.MaxFulfillmentLength {
+		return validation.ErrFulfillmentTooLong
+	}
+
+	if derived.Cost > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	if !ful.verify(message) {
+		return validation.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
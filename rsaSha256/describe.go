@@ -0,0 +1,24 @@
+package RsaSha256
+
+import (
+	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+)
+
+// Describes the Fulfillment and the fingerprint of its Condition.
+func (ful *Fulfillment) Describe() *explain.Node {
+	n := explain.Fulfillment(encoding.LegacyRsaSha256Name)
+	n.Bytes("modulus", ful.Modulus)
+	n.Bytes("signature", ful.Signature)
+
+	cond := ful.Condition()
+	return n.Bytes("fingerprint", cond.Hash[:])
+}
+
+// Describes the Condition.
+func (cond *Condition) Describe() *explain.Node {
+	return explain.Condition(encoding.LegacyRsaSha256Name).
+		Bytes("fingerprint", cond.Hash[:]).
+		Limit("max fulfillment length", cond.MaxFulfillmentLength).
+		Limit("cost", cond.Cost)
+}
@@ -0,0 +1,87 @@
+package RsaSha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+)
+
+type jsonFulfillment struct {
+	Type      string             `json:"type"`
+	Modulus   encoding.JSONBytes `json:"modulus"`
+	Signature encoding.JSONBytes `json:"signature"`
+}
+
+// Marshals to JSON as {"type", "modulus", "signature"}.
+func (ful *Fulfillment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFulfillment{
+		Type:      encoding.LegacyRsaSha256Name,
+		Modulus:   ful.Modulus,
+		Signature: ful.Signature,
+	})
+}
+
+// Unmarshals from JSON, and checks its modulus and signature lengths.
+func (ful *Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyRsaSha256Name {
+		return errors.New("not an RsaSha256 condition")
+	}
+
+	f := Fulfillment{
+		Modulus:   j.Modulus,
+		Signature: j.Signature,
+	}
+	if err := f.check(); err != nil {
+		return err
+	}
+
+	*ful = f
+	return nil
+}
+
+type jsonCondition struct {
+	Type                 string             `json:"type"`
+	Fingerprint          encoding.JSONBytes `json:"fingerprint"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength"`
+	Cost                 uint64             `json:"cost"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxFulfillmentLength", "cost"}.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCondition{
+		Type:                 encoding.LegacyRsaSha256Name,
+		Fingerprint:          cond.Hash[:],
+		MaxFulfillmentLength: cond.MaxFulfillmentLength,
+		Cost:                 cond.Cost,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyRsaSha256Name {
+		return errors.New("not an RsaSha256 condition")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+	*cond = Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+		Cost:                 j.Cost,
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package Sha256
+
+import (
+	"errors"
+	"math/big"
+
+	"crypto-conditions/encoding"
+)
+
+// Tag of Sha256 conditions and fulfillments in the DER CHOICE
+const derTag = 0
+
+type derFulfillment struct {
+	Preimage []byte `asn1:"tag:0"`
+}
+
+type derCondition struct {
+	Fingerprint          []byte   `asn1:"tag:0"`
+	Cost                 *big.Int `asn1:"tag:1"`
+	MaxFulfillmentLength *big.Int `asn1:"tag:2"`
+}
+
+// Shape of derFulfillment
+var fulfillmentSchema = encoding.Schema{
+	{Name: "preimage", Tag: 0, Kind: encoding.KindBytes},
+}
+
+// Shape of derCondition
+var conditionSchema = encoding.Schema{
+	{Name: "fingerprint", Tag: 0, Kind: encoding.KindBytes},
+	{Name: "cost", Tag: 1, Kind: encoding.KindUint},
+	{Name: "maxFulfillmentLength", Tag: 2, Kind: encoding.KindUint},
+}
+
+// Serializes to the DER binary format. Discards the MaxFulfillmentLength.
+func (ful *Fulfillment) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(derTag, derFulfillment{
+		Preimage: ful.Preimage,
+	})
+}
+
+// Parses Fulfillment out of the DER binary format.
+func ParseFulfillmentBinary(b []byte) (*Fulfillment, error) {
+	var der derFulfillment
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	ful := &Fulfillment{
+		Preimage: der.Preimage,
+	}
+
+	return ful, nil
+}
+
+// Serializes to the DER binary format.
+func (cond *Condition) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(derTag, derCondition{
+		Fingerprint:          cond.Hash[:],
+		Cost:                 encoding.MakeInteger(cond.Cost),
+		MaxFulfillmentLength: encoding.MakeInteger(cond.MaxFulfillmentLength),
+	})
+}
+
+// Parses Condition out of the DER binary format, and checks it for validity.
+func ParseConditionBinary(b []byte) (*Condition, error) {
+	var der derCondition
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	cond := &Condition{}
+
+	if len(der.Fingerprint) != len(cond.Hash) {
+		return nil, errors.New("fingerprint must be 32 bytes")
+	}
+	copy(cond.Hash[:], der.Fingerprint)
+
+	cost, err := encoding.GetInteger(der.Cost)
+	if err != nil {
+		return nil, err
+	}
+	cond.Cost = cost
+
+	length, err := encoding.GetInteger(der.MaxFulfillmentLength)
+	if err != nil {
+		return nil, err
+	}
+	cond.MaxFulfillmentLength = length
+
+	return cond, nil
+}
@@ -0,0 +1,84 @@
+package Sha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+)
+
+type jsonFulfillment struct {
+	Type                 string             `json:"type"`
+	Preimage             encoding.JSONBytes `json:"preimage"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength,omitempty"`
+}
+
+// Marshals to JSON as {"type", "preimage"}, with the MaxFulfillmentLength if
+// set.
+func (ful *Fulfillment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFulfillment{
+		Type:                 encoding.LegacyPreimageSha256Name,
+		Preimage:             ful.Preimage,
+		MaxFulfillmentLength: ful.MaxFulfillmentLength,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (ful *Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyPreimageSha256Name {
+		return errors.New("not an Sha256 condition")
+	}
+
+	*ful = Fulfillment{
+		Preimage:             j.Preimage,
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+	}
+
+	return nil
+}
+
+type jsonCondition struct {
+	Type                 string             `json:"type"`
+	Fingerprint          encoding.JSONBytes `json:"fingerprint"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength"`
+	Cost                 uint64             `json:"cost"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxFulfillmentLength", "cost"}.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCondition{
+		Type:                 encoding.LegacyPreimageSha256Name,
+		Fingerprint:          cond.Hash[:],
+		MaxFulfillmentLength: cond.MaxFulfillmentLength,
+		Cost:                 cond.Cost,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyPreimageSha256Name {
+		return errors.New("not an Sha256 condition")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+	*cond = Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+		Cost:                 j.Cost,
+	}
+
+	return nil
+}
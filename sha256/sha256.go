@@ -6,10 +6,12 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"math"
 	"strconv"
 	"strings"
 
 	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
 )
 
 type Fulfillment struct {
@@ -19,7 +21,19 @@ type Fulfillment struct {
 
 // Serializes to the Crypto Conditions string format. Discards the MaxFulfillmentLength.
 func (ful *Fulfillment) Serialize() string {
-	return "cf:1:1:" + base64.URLEncoding.EncodeToString(ful.Preimage)
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (ful *Fulfillment) AppendSerialize(dst []byte) []byte {
+	dst = append(dst, "cf:1:1:"...)
+	return base64.URLEncoding.AppendEncode(dst, ful.Preimage)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (ful *Fulfillment) SerializedLength() int {
+	return len("cf:1:1:") + int(encoding.Base64Length(uint64(len(ful.Preimage))))
 }
 
 // Parses Fulfillment out of the Crypto Conditions string format, and checks it for validity.
@@ -60,7 +74,7 @@ func (ful *Fulfillment) Condition() Condition {
 	var length uint64
 
 	if ful.MaxFulfillmentLength == 0 {
-		length = uint64(len(ful.Serialize()))
+		length = uint64(ful.SerializedLength())
 	} else {
 		length = ful.MaxFulfillmentLength
 	}
@@ -72,17 +86,116 @@ func (ful *Fulfillment) Condition() Condition {
 	return Condition{
 		Hash:                 hash,
 		MaxFulfillmentLength: length,
+		Cost:                 maxPreimageLength(length),
 	}
 }
 
+// The Cost of a Sha256 condition is the length of the longest preimage that
+// fits its MaxFulfillmentLength, which is all conditions parsed from the
+// Crypto Conditions string format know, so that a condition has the same Cost
+// whether derived or parsed. Conditions parsed from the named-information URI
+// format have no MaxFulfillmentLength, which is then set to the largest
+// uint64.
 type Condition struct {
 	Hash                 [32]byte
 	MaxFulfillmentLength uint64
+	Cost                 uint64
+}
+
+// Returns the length of the longest preimage whose fulfillment is no longer than
+// the given length.
+func maxPreimageLength(maxFulfillmentLength uint64) uint64 {
+	prefix := uint64(len("cf:1:1:"))
+	if maxFulfillmentLength < prefix {
+		return 0
+	}
+
+	return (maxFulfillmentLength - prefix) / 4 * 3
 }
 
 // Serializes to the Crypto Conditions string format.
 func (cond *Condition) Serialize() string {
-	return "cc:1:1:" + base64.URLEncoding.EncodeToString(cond.Hash[:]) + ":" + strconv.FormatUint(cond.MaxFulfillmentLength, 10)
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	return encoding.AppendCondition(dst, "1", cond.Hash[:], cond.MaxFulfillmentLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return encoding.ConditionLength("1", cond.MaxFulfillmentLength)
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "1" {
+		return nil, errors.New("not an Sha256 condition")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max fulfillment length")
+	}
+
+	cond := &Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: length,
+		Cost:                 maxPreimageLength(length),
+	}
+
+	return cond, nil
+}
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:        encoding.LegacyPreimageSha256Name,
+		Fingerprint: cond.Hash,
+		Cost:        cond.Cost,
+	}
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.LegacyPreimageSha256Name {
+		return nil, errors.New("not an Sha256 condition")
+	}
+
+	cond := &Condition{
+		Hash:                 u.Fingerprint,
+		MaxFulfillmentLength: math.MaxUint64,
+		Cost:                 u.Cost,
+	}
+
+	return cond, nil
 }
 
 func FulfillmentToCondition(s string) (string, error) {
@@ -96,3 +209,39 @@ func FulfillmentToCondition(s string) (string, error) {
 	condString := cond.Serialize()
 	return condString, nil
 }
+
+// Checks that an in-memory Fulfillment satisfies the Condition: the preimage must
+// hash to the Condition's fingerprint and neither its length nor the serialized
+// Fulfillment's may exceed the Condition's Cost and MaxFulfillmentLength. The
+// message is not used by Sha256 conditions.
+func (ful *Fulfillment) Validate(cond *Condition, message []byte) error {
+	derived := ful.Condition()
+	if derived.Hash != cond.Hash {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if uint64(ful.SerializedLength()) > cond.MaxFulfillmentLength {
+		return validation.ErrFulfillmentTooLong
+	}
+
+	if uint64(len(ful.Preimage)) > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	return nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
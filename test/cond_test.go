@@ -1,14 +1,49 @@
 package test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"crypto-conditions"
+	"crypto-conditions/batch"
+	"crypto-conditions/codec"
+	"crypto-conditions/ecdsaP256Sha256"
 	"crypto-conditions/ed25519sha256"
 	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+	"crypto-conditions/features"
+	"crypto-conditions/htlc"
+	"crypto-conditions/prefixSha256"
+	"crypto-conditions/registry"
+	"crypto-conditions/rfc"
+	"crypto-conditions/rsaSha256"
 	"crypto-conditions/sha256"
+	"crypto-conditions/thresholdSha256"
+	"crypto-conditions/timeoutSha256"
+	"crypto-conditions/validation"
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/ed25519"
 	"log"
 )
 
@@ -16,6 +51,14 @@ var pubkey1 = [32]byte{197, 198, 13, 156, 213, 181, 160, 15, 105, 7, 66, 222, 66
 
 var privkey1 = [64]byte{244, 9, 180, 60, 13, 13, 60, 215, 158, 30, 236, 128, 111, 107, 44, 54, 75, 151, 209, 13, 20, 19, 58, 42, 162, 147, 207, 0, 189, 188, 4, 136, 197, 198, 13, 156, 213, 181, 160, 15, 105, 7, 66, 222, 66, 15, 212, 8, 172, 55, 20, 47, 34, 182, 117, 106, 213, 203, 6, 172, 119, 66, 87, 170}
 
+var pubkey2 = [32]byte{236, 129, 33, 67, 119, 101, 27, 246, 101, 161, 109, 184, 246, 50, 2, 214, 184, 162, 40, 197, 194, 196, 212, 210, 163, 136, 39, 229, 123, 204, 82, 25}
+
+var privkey2 = [64]byte{97, 111, 164, 221, 195, 25, 249, 6, 17, 161, 159, 191, 252, 118, 241, 114, 92, 113, 7, 100, 234, 111, 160, 131, 230, 22, 181, 67, 197, 183, 9, 99, 236, 129, 33, 67, 119, 101, 27, 246, 101, 161, 109, 184, 246, 50, 2, 214, 184, 162, 40, 197, 194, 196, 212, 210, 163, 136, 39, 229, 123, 204, 82, 25}
+
+var pubkey3 = [32]byte{118, 97, 30, 186, 23, 231, 51, 77, 244, 88, 148, 216, 9, 177, 104, 120, 183, 209, 212, 48, 44, 133, 220, 62, 24, 92, 165, 7, 153, 68, 194, 83}
+
+var privkey3 = [64]byte{117, 54, 222, 53, 77, 11, 219, 41, 154, 161, 185, 104, 208, 248, 30, 59, 132, 230, 116, 108, 150, 60, 215, 9, 221, 101, 210, 53, 150, 159, 129, 174, 118, 97, 30, 186, 23, 231, 51, 77, 244, 88, 148, 216, 9, 177, 104, 120, 183, 209, 212, 48, 44, 133, 220, 62, 24, 92, 165, 7, 153, 68, 194, 83}
+
 func TestEncoding(t *testing.T) {
 
 	b1 := encoding.MakeVarbyte([]byte{2, 2, 2})
@@ -47,6 +90,106 @@ func TestEncoding(t *testing.T) {
 	fmt.Println(deseri)
 }
 
+func TestStream(t *testing.T) {
+	items := [][]byte{{1, 1, 1, 1, 1}, {2, 2, 2}, {3, 3, 3, 3}}
+
+	var buf bytes.Buffer
+	w := encoding.NewWriter(&buf)
+	w.WriteUvarint(300)
+	w.WriteVarbyte([]byte{2, 2, 2})
+	if err := w.WriteVarray(items); err != nil {
+		t.Fatal(err)
+	}
+
+	want := bytes.Join([][]byte{
+		encoding.MakeUvarint(300),
+		encoding.MakeVarbyte([]byte{2, 2, 2}),
+		encoding.MakeVarbyte(encoding.MakeVarray(items)),
+	}, []byte{})
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatal("written", buf.Bytes(), "want", want)
+	}
+
+	// Read a byte at a time, as from a network connection
+	r := encoding.NewReader(iotest.OneByteReader(bytes.NewReader(want)), 100)
+	n, err := r.ReadUvarint()
+	if err != nil || n != 300 {
+		t.Fatal(n, err)
+	}
+	vb, err := r.ReadVarbyte()
+	if err != nil || !bytes.Equal(vb, []byte{2, 2, 2}) {
+		t.Fatal(vb, err)
+	}
+	arr, err := r.ReadVarray()
+	if err != nil || !reflect.DeepEqual(arr, items) {
+		t.Fatal(arr, err)
+	}
+	if r.Remaining() != 100-uint64(len(want)) {
+		t.Fatal("read", 100-r.Remaining(), "bytes")
+	}
+	if _, err := r.ReadUvarint(); err != io.EOF {
+		t.Fatal("expected EOF", err)
+	}
+
+	// Length prefixes can't make the Reader read or allocate past its limit
+	huge := encoding.MakeUvarint(1 << 40)
+	r = encoding.NewReader(bytes.NewReader(huge), 100)
+	if _, err := r.ReadVarbyte(); err != encoding.ErrTooLong {
+		t.Fatal("expected ErrTooLong", err)
+	}
+	r = encoding.NewReader(bytes.NewReader(want), 3)
+	r.ReadUvarint()
+	if _, err := r.ReadVarbyte(); err != encoding.ErrTooLong {
+		t.Fatal("expected ErrTooLong", err)
+	}
+	r = encoding.NewReader(bytes.NewReader([]byte{3, 2, 2}), 100)
+	if _, err := r.ReadVarbyte(); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF", err)
+	}
+
+	// The first error sticks
+	w = encoding.NewWriter(failingWriter{})
+	w.WriteUvarint(1)
+	if err := w.WriteVarbyte([]byte{1}); err != errWriteFailed || w.Err() != errWriteFailed {
+		t.Fatal("expected the write error", err)
+	}
+
+	// Threshold fulfillments read from a stream, leaving what follows
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte((&Sha256.Fulfillment{Preimage: []byte("secret")}).Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{},
+	}
+
+	buf.Reset()
+	if err := thrFul.WritePayload(encoding.NewWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("next")
+
+	src := bufio.NewReader(&buf)
+	parsed, err := ThresholdSha256.ReadFulfillment(encoding.NewReader(src, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Serialize() != thrFul.Serialize() {
+		t.Fatal("threshold fulfillment read incorrectly", parsed.Serialize())
+	}
+	if rest, _ := io.ReadAll(src); string(rest) != "next" {
+		t.Fatalf("threshold fulfillment read past its payload, left %q", rest)
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
 func TestSha256Fulfillment(t *testing.T) {
 	ful := &Sha256.Fulfillment{
 		Preimage: []byte{42},
@@ -97,14 +240,14 @@ func TestSha256Fulfillment(t *testing.T) {
 
 func TestEd25519Sha256Fulfillment(t *testing.T) {
 	ful := &Ed25519Sha256.Fulfillment{
-		PublicKey:               pubkey1,
+		PublicKey:               pubkey1[:],
 		MessageId:               []byte{2, 2, 2, 2, 2},
 		FixedMessage:            []byte{42},
 		DynamicMessage:          []byte{90},
 		MaxDynamicMessageLength: 99999,
 	}
 
-	ful.Sign(privkey1)
+	ful.Sign(privkey1[:])
 
 	serialized := ful.Serialize()
 
@@ -137,7 +280,7 @@ func TestEd25519Sha256Fulfillment(t *testing.T) {
 	cond1String := cond1.Serialize()
 
 	cond2 := Ed25519Sha256.Condition{
-		PublicKey:               pubkey1,
+		PublicKey:               pubkey1[:],
 		MessageId:               []byte{2, 2, 2, 2, 2},
 		FixedMessage:            []byte{42},
 		MaxDynamicMessageLength: 99999,
@@ -151,61 +294,2928 @@ func TestEd25519Sha256Fulfillment(t *testing.T) {
 	}
 }
 
-//
-//func TestThresholdSha256Fulfillment(t *testing.T) {
-//	shaFul := &Sha256.Fulfillment{
-//		Preimage: []byte{42},
-//	}
-//	shaFulString := shaFul.Serialize()
-//	shaCond := shaFul.Condition()
-//	shaCondString := shaCond.Serialize()
-//
-//	edFul := &Ed25519Sha256.Fulfillment{
-//		PublicKey:               pubkey1,
-//		MessageId:               []byte{2, 2, 2, 2, 2},
-//		FixedMessage:            []byte{42},
-//		DynamicMessage:          []byte{90},
-//		MaxDynamicMessageLength: 99999,
-//	}
-//	edFul.Sign(privkey1)
-//	edFulString := edFul.Serialize()
-//	edCond := edFul.Condition()
-//	edCondString := edCond.Serialize()
-//
-//	thrFul := ThresholdSha256.Fulfillment{
-//		Threshold: 80,
-//		SubConditions: ThresholdSha256.WeightedStrings{
-//			ThresholdSha256.WeightedString{
-//				Weight: 60,
-//				String: shaCondString,
-//			},
-//			ThresholdSha256.WeightedString{
-//				Weight: 20,
-//				String: edCondString,
-//			},
-//		},
-//		SubFulfillments: ThresholdSha256.WeightedStrings{
-//			ThresholdSha256.WeightedString{
-//				Weight: 60,
-//				String: shaFulString,
-//			},
-//			ThresholdSha256.WeightedString{
-//				Weight: 20,
-//				String: edFulString,
-//			},
-//		},
-//	}
-//
-//	thrCond, err := thrFul.Condition()
-//	if err != nil {
-//		t.Fatal(err)
-//	}
-//
-//	thrCondString := thrCond.Serialize()
-//	fmt.Println(thrCondString)
-//}
+func TestParseFulfillment(t *testing.T) {
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte{42},
+	}
 
-// Extra keys
-// &[197 198 13 156 213 181 160 15 105 7 66 222 66 15 212 8 172 55 20 47 34 182 117 106 213 203 6 172 119 66 87 170] &[244 9 180 60 13 13 60 215 158 30 236 128 111 107 44 54 75 151 209 13 20 19 58 42 162 147 207 0 189 188 4 136 197 198 13 156 213 181 160 15 105 7 66 222 66 15 212 8 172 55 20 47 34 182 117 106 213 203 6 172 119 66 87 170]
-// &[236 129 33 67 119 101 27 246 101 161 109 184 246 50 2 214 184 162 40 197 194 196 212 210 163 136 39 229 123 204 82 25] &[97 111 164 221 195 25 249 6 17 161 159 191 252 118 241 114 92 113 7 100 234 111 160 131 230 22 181 67 197 183 9 99 236 129 33 67 119 101 27 246 101 161 109 184 246 50 2 214 184 162 40 197 194 196 212 210 163 136 39 229 123 204 82 25]
-// &[118 97 30 186 23 231 51 77 244 88 148 216 9 177 104 120 183 209 212 48 44 133 220 62 24 92 165 7 153 68 194 83] &[117 54 222 53 77 11 219 41 154 161 185 104 208 248 30 59 132 230 116 108 150 60 215 9 221 101 210 53 150 159 129 174 118 97 30 186 23 231 51 77 244 88 148 216 9 177 104 120 183 209 212 48 44 133 220 62 24 92 165 7 153 68 194 83]
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		DynamicMessage:          []byte{90},
+		MaxDynamicMessageLength: 99999,
+	}
+	edFul.Sign(privkey1[:])
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 1,
+				String: []byte(shaFul.Serialize()),
+			},
+			ThresholdSha256.WeightedString{
+				Weight: 1,
+				String: []byte(edFul.Serialize()),
+			},
+		},
+	}
+
+	for _, ful := range []CryptoConditions.Fulfillment{shaFul, edFul, thrFul} {
+		serialized := ful.Serialize()
+
+		parsed, err := CryptoConditions.ParseFulfillment(serialized)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reflect.TypeOf(parsed) != reflect.TypeOf(ful) {
+			t.Fatal("parsed fulfillment has the wrong type", reflect.TypeOf(parsed))
+		}
+
+		if parsed.Serialize() != serialized {
+			t.Fatal("serialization doesn't round-trip", parsed.Serialize())
+		}
+	}
+
+	condString, err := CryptoConditions.FulfillmentToCondition(shaFul.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condString != "cc:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:11" {
+		t.Fatal("derived condition incorrect", condString)
+	}
+
+	for _, s := range []string{"cf:1:2:AA==", "cc:1:1:Kg==", "cf:2:1:Kg==", "cf:1:1"} {
+		ful, err := CryptoConditions.ParseFulfillment(s)
+		if err == nil || ful != nil {
+			t.Fatal("invalid fulfillment accepted", s)
+		}
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	edCond := &Ed25519Sha256.Condition{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		MaxDynamicMessageLength: 99999,
+	}
+
+	for _, s := range []string{
+		"cc:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:11",
+		"cc:1:2:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:11",
+		"cc:1:4:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:96",
+		edCond.Serialize(),
+	} {
+		parsed, err := CryptoConditions.ParseCondition(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.Serialize() != s {
+			t.Fatal("serialization doesn't round-trip", parsed.Serialize())
+		}
+	}
+
+	parsed, err := Ed25519Sha256.ParseCondition(edCond.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Fingerprint() != edCond.Fingerprint() || parsed.MaxDynamicMessageLength != 99999 {
+		t.Fatal("parsed condition doesn't match", parsed)
+	}
+
+	for _, s := range []string{
+		"cf:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:11",
+		"cc:2:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:11",
+		"cc:1:3:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:11",
+		"cc:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0:11",
+		"cc:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EH:11",
+		"cc:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=:-1",
+		"cc:1:1:EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0=",
+	} {
+		cond, err := CryptoConditions.ParseCondition(s)
+		if err == nil || cond != nil {
+			t.Fatal("invalid condition accepted", s)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte{42},
+	}
+	shaCond := shaFul.Condition()
+
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		DynamicMessage:          []byte{90},
+		MaxDynamicMessageLength: 99999,
+	}
+	edFul.Sign(privkey1[:])
+	edCond := edFul.Condition()
+
+	if err := CryptoConditions.Validate(shaFul.Serialize(), shaCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CryptoConditions.Validate(edFul.Serialize(), edCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CryptoConditions.Validate(shaFul.Serialize(), edCond.Serialize(), nil); err != validation.ErrTypeMismatch {
+		t.Fatal("expected type mismatch", err)
+	}
+
+	otherCond := (&Sha256.Fulfillment{Preimage: []byte{43}}).Condition()
+	if err := Sha256.Validate(shaFul.Serialize(), otherCond.Serialize(), nil); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+
+	shortCond := shaCond
+	shortCond.MaxFulfillmentLength = 10
+	if err := Sha256.Validate(shaFul.Serialize(), shortCond.Serialize(), nil); err != validation.ErrFulfillmentTooLong {
+		t.Fatal("expected fulfillment too long", err)
+	}
+
+	shortEdCond := edCond
+	shortEdCond.MaxDynamicMessageLength = 0
+	if err := edFul.Validate(&shortEdCond, nil); err != validation.ErrMessageTooLong {
+		t.Fatal("expected message too long", err)
+	}
+
+	forged := *edFul
+	forged.DynamicMessage = []byte{91}
+	if err := forged.Validate(&edCond, nil); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 1,
+				String: []byte(shaFul.Serialize()),
+			},
+			ThresholdSha256.WeightedString{
+				Weight: 1,
+				String: []byte(edFul.Serialize()),
+			},
+		},
+	}
+	thrCond := thrFul.Condition()
+
+	if err := CryptoConditions.Validate(thrFul.Serialize(), thrCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	thrFul.Threshold = 3
+	if err := thrFul.Validate(&thrCond, nil); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+
+	thrCond = thrFul.Condition()
+	if err := thrFul.Validate(&thrCond, nil); err != validation.ErrThresholdNotReached {
+		t.Fatal("expected threshold not reached", err)
+	}
+}
+
+func TestThresholdSha256Condition(t *testing.T) {
+	shaFulString := []byte((&Sha256.Fulfillment{Preimage: []byte{42}}).Serialize())
+
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		DynamicMessage:          []byte{90},
+		MaxDynamicMessageLength: 99999,
+	}
+	edFul.Sign(privkey1[:])
+	edFulString := []byte(edFul.Serialize())
+
+	thrFul1 := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: shaFulString},
+			ThresholdSha256.WeightedString{Weight: 1, String: edFulString},
+		},
+	}
+
+	thrFul2 := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: edFulString},
+			ThresholdSha256.WeightedString{Weight: 1, String: shaFulString},
+		},
+	}
+
+	cond1 := thrFul1.Condition()
+	cond2 := thrFul2.Condition()
+
+	if cond1.Serialize() != cond2.Serialize() {
+		t.Fatal("condition depends on subfulfillment order", cond1.Serialize(), cond2.Serialize())
+	}
+
+	if len(cond1.Fingerprint) != 32 {
+		t.Fatal("fingerprint missing", cond1.Fingerprint)
+	}
+
+	if !reflect.DeepEqual(cond1.FeatureBitmask, []byte{0x2b}) {
+		t.Fatal("feature bitmask incorrect", cond1.FeatureBitmask)
+	}
+
+	if cond1.MaxFulfillmentLength < uint64(len(thrFul1.Serialize())) {
+		t.Fatal("max fulfillment length too small", cond1.MaxFulfillmentLength)
+	}
+
+	// Nested thresholds
+	nested := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(thrFul1.Serialize())},
+		},
+	}
+	nestedCond := nested.Condition()
+
+	if err := CryptoConditions.Validate(nested.Serialize(), nestedCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThresholdSha256Fulfillment(t *testing.T) {
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte{42},
+	}
+	shaFulString := shaFul.Serialize()
+	shaCond := shaFul.Condition()
+	shaCondString := shaCond.Serialize()
+
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		DynamicMessage:          []byte{90},
+		MaxDynamicMessageLength: 99999,
+	}
+	edFul.Sign(privkey1[:])
+	edFulString := edFul.Serialize()
+	edCond := edFul.Condition()
+	edCondString := edCond.Serialize()
+
+	fullFul := ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 60,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 60,
+				String: []byte(shaFulString),
+			},
+			ThresholdSha256.WeightedString{
+				Weight: 20,
+				String: []byte(edFulString),
+			},
+		},
+	}
+
+	thrFul := ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 60,
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 20,
+				String: []byte(edCondString),
+			},
+		},
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 60,
+				String: []byte(shaFulString),
+			},
+		},
+	}
+
+	fullCond := fullFul.Condition()
+	thrCond := thrFul.Condition()
+
+	if !bytes.Equal(thrCond.Fingerprint, fullCond.Fingerprint) {
+		t.Fatal("fingerprint depends on which subconditions are fulfilled", thrCond.Serialize(), fullCond.Serialize())
+	}
+
+	// The fulfilled Ed25519 subcondition bounds its fixed message, which its
+	// condition string doesn't
+	if fullCond.MaxFulfillmentLength == math.MaxUint64 {
+		t.Fatal("threshold over an Ed25519 fulfillment unbounded")
+	}
+	if err := ThresholdSha256.Validate(fullFul.Serialize(), fullCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	thrFulString := thrFul.Serialize()
+	parsed, err := ThresholdSha256.ParseFulfillment(thrFulString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*parsed, thrFul) {
+		t.Fatal("parsed fulfillment doesn't match", parsed)
+	}
+
+	if err := ThresholdSha256.Validate(thrFulString, thrCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the fulfilled weight counts
+	edOnly := ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 60,
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 60,
+				String: []byte(shaCondString),
+			},
+		},
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{
+				Weight: 20,
+				String: []byte(edFulString),
+			},
+		},
+	}
+
+	if err := ThresholdSha256.Validate(edOnly.Serialize(), thrCond.Serialize(), nil); err != validation.ErrThresholdNotReached {
+		t.Fatal("expected threshold not reached", err)
+	}
+
+	// Truncated payloads are rejected rather than panicking
+	for i := len("cf:1:4:"); i < len(thrFulString); i += 4 {
+		if _, err := ThresholdSha256.ParseFulfillment(thrFulString[:i]); err == nil {
+			t.Fatal("truncated fulfillment accepted", thrFulString[:i])
+		}
+	}
+
+	// Items longer than 127 bytes take more than one byte of length prefix
+	longPreimages := &ThresholdSha256.ThresholdSha256Fulfillment{Threshold: 3}
+	for i := 0; i < 3; i++ {
+		preimage := &Sha256.Fulfillment{Preimage: bytes.Repeat([]byte{byte(i)}, 100)}
+		longPreimages.SubFulfillments = append(longPreimages.SubFulfillments, ThresholdSha256.WeightedString{
+			Weight: 1,
+			String: []byte(preimage.Serialize()),
+		})
+	}
+	longPreimagesCond := longPreimages.Condition()
+	if err := ThresholdSha256.Validate(longPreimages.Serialize(), longPreimagesCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if uint64(longPreimages.SerializedLength()) > longPreimagesCond.MaxFulfillmentLength {
+		t.Fatal("max fulfillment length too short", longPreimagesCond.MaxFulfillmentLength)
+	}
+
+	// An Ed25519 condition parsed from the string format bounds neither its
+	// message id nor its fixed message
+	longEd := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		FixedMessage:            bytes.Repeat([]byte{42}, 200),
+		MaxDynamicMessageLength: 5,
+	}
+	longEd.Sign(privkey1[:])
+	longEdCond := longEd.Condition()
+	longThrCond := (&ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:     1,
+		SubConditions: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(longEdCond.Serialize())}},
+	}).Condition()
+	longThr := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(longEd.Serialize())}},
+	}
+	if err := ThresholdSha256.Validate(longThr.Serialize(), longThrCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A preimage condition with an explicit MaxFulfillmentLength is fulfilled
+	// by its plain subfulfillment, as the fingerprint leaves the limit out
+	limited := &Sha256.Fulfillment{Preimage: []byte{42}, MaxFulfillmentLength: 100}
+	limitedCond := limited.Condition()
+	limitedThrCond := (&ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:     1,
+		SubConditions: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(limitedCond.Serialize())}},
+	}).Condition()
+	limitedThr := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(limited.Serialize())}},
+	}
+	if err := ThresholdSha256.Validate(limitedThr.Serialize(), limitedThrCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildFulfillment(t *testing.T) {
+	edFulStrings := []string{}
+	edCondStrings := []string{}
+	for i, key := range [][]byte{privkey1[:], privkey2[:], privkey3[:]} {
+		edFul := &Ed25519Sha256.Fulfillment{
+			PublicKey:               key[32:],
+			MessageId:               []byte{2, 2, 2, 2, 2},
+			FixedMessage:            []byte{42},
+			DynamicMessage:          make([]byte, 10*(3-i)),
+			MaxDynamicMessageLength: 99999,
+		}
+		edFul.Sign(key)
+		edCond := edFul.Condition()
+		edFulStrings = append(edFulStrings, edFul.Serialize())
+		edCondStrings = append(edCondStrings, edCond.Serialize())
+	}
+
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte{42},
+	}
+	shaCond := shaFul.Condition()
+
+	all := ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edCondStrings[0])},
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edCondStrings[1])},
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edCondStrings[2])},
+			ThresholdSha256.WeightedString{Weight: 0, String: []byte(shaCond.Serialize())},
+		},
+	}
+	cond := all.Condition()
+
+	// The two shortest signatures are kept, as is the preimage, which is
+	// shorter than its condition.
+	ful, err := ThresholdSha256.BuildFulfillment(2, ThresholdSha256.WeightedStrings{
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edFulStrings[0])},
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edFulStrings[1])},
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edFulStrings[2])},
+		ThresholdSha256.WeightedString{Weight: 0, String: []byte(shaFul.Serialize())},
+	}, ThresholdSha256.WeightedStrings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ThresholdSha256.WeightedStrings{
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edFulStrings[1])},
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edFulStrings[2])},
+		ThresholdSha256.WeightedString{Weight: 0, String: []byte(shaFul.Serialize())},
+	}
+	if !reflect.DeepEqual(ful.SubFulfillments, expected) {
+		t.Fatal("wrong subfulfillments chosen", ful.SubFulfillments)
+	}
+
+	if err := ThresholdSha256.Validate(ful.Serialize(), cond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Conditions are passed through and don't count
+	ful, err = ThresholdSha256.BuildFulfillment(2, ThresholdSha256.WeightedStrings{
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edFulStrings[0])},
+	}, ThresholdSha256.WeightedStrings{
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edCondStrings[1])},
+		ThresholdSha256.WeightedString{Weight: 1, String: []byte(edCondStrings[2])},
+	})
+	if err != validation.ErrThresholdNotReached || ful != nil {
+		t.Fatal("expected threshold not reached", err)
+	}
+
+	// Large weights with a common divisor are normalised
+	ful, err = ThresholdSha256.BuildFulfillment(3000000000, ThresholdSha256.WeightedStrings{
+		ThresholdSha256.WeightedString{Weight: 1500000000, String: []byte(edFulStrings[0])},
+		ThresholdSha256.WeightedString{Weight: 1500000000, String: []byte(edFulStrings[1])},
+		ThresholdSha256.WeightedString{Weight: 4000000000, String: []byte(edFulStrings[2])},
+	}, ThresholdSha256.WeightedStrings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ful.SubFulfillments) != 1 || string(ful.SubFulfillments[0].String) != edFulStrings[2] {
+		t.Fatal("wrong subfulfillments chosen", ful.SubFulfillments)
+	}
+
+	// Weights adding up to too many different sums are rejected
+	many := ThresholdSha256.WeightedStrings{}
+	for i := uint(0); i < 20; i++ {
+		preimage := &Sha256.Fulfillment{Preimage: []byte{byte(i)}}
+		many = append(many, ThresholdSha256.WeightedString{Weight: 1 << i, String: []byte(preimage.Serialize())})
+	}
+	if _, err := ThresholdSha256.BuildFulfillment(1<<20-1, many, ThresholdSha256.WeightedStrings{}); err != ThresholdSha256.ErrTooManyWeights {
+		t.Fatal("expected too many weights", err)
+	}
+}
+
+func TestBinaryEncoding(t *testing.T) {
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte{42},
+	}
+
+	// Same layout as PREIMAGE-SHA-256 in the crypto-conditions spec
+	b, err := shaFul.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b, []byte{0xa0, 0x03, 0x80, 0x01, 0x2a}) {
+		t.Fatal("serialization incorrect", b)
+	}
+
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		DynamicMessage:          []byte{90},
+		MaxDynamicMessageLength: 99999,
+	}
+	edFul.Sign(privkey1[:])
+	edCond := edFul.Condition()
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(shaFul.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 2, String: []byte(edCond.Serialize())},
+		},
+	}
+
+	for _, ful := range []CryptoConditions.Fulfillment{shaFul, edFul, thrFul} {
+		b, err := ful.SerializeBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := CryptoConditions.ParseFulfillmentBinary(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.Serialize() != ful.Serialize() {
+			t.Fatal("binary serialization doesn't round-trip", parsed.Serialize())
+		}
+
+		cond, err := CryptoConditions.ConditionOf(ful)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = cond.SerializeBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsedCond, err := CryptoConditions.ParseConditionBinary(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsedCond.Serialize() != cond.Serialize() {
+			t.Fatal("binary serialization doesn't round-trip", parsedCond.Serialize())
+		}
+
+		if _, err := CryptoConditions.ParseFulfillmentBinary(b); err == nil {
+			t.Fatal("condition parsed as fulfillment")
+		}
+
+		if _, err := CryptoConditions.ParseConditionBinary(b[:len(b)-1]); err == nil {
+			t.Fatal("truncated condition accepted")
+		}
+	}
+
+	forged := *edFul
+	forged.DynamicMessage = []byte{91}
+	b, err = forged.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Ed25519Sha256.ParseFulfillmentBinary(b); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+}
+
+func TestConditionURI(t *testing.T) {
+	shaCond := (&Sha256.Fulfillment{Preimage: []byte{42}}).Condition()
+
+	uri := shaCond.URI()
+	if uri != "ni:///sha-256;EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0?fpt=legacy-preimage-sha-256&cost=3" {
+		t.Fatal("serialization incorrect", uri)
+	}
+
+	// The same condition parsed from the string format has the same URI
+	parsedSha, err := Sha256.ParseCondition(shaCond.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedSha.URI() != uri {
+		t.Fatal("parsed condition URI differs", parsedSha.URI())
+	}
+
+	edCond := &Ed25519Sha256.Condition{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte{2, 2, 2, 2, 2},
+		FixedMessage:            []byte{42},
+		MaxDynamicMessageLength: 99999,
+		Cost:                    Ed25519Sha256.FixedCost,
+	}
+
+	thrCond := (&ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(shaCond.Serialize())},
+		},
+	}).Condition()
+
+	for _, cond := range []CryptoConditions.Condition{&shaCond, edCond, &thrCond} {
+		parsed, err := CryptoConditions.ParseConditionURI(cond.URI())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.URI() != cond.URI() {
+			t.Fatal("URI doesn't round-trip", parsed.URI())
+		}
+	}
+
+	fp := "EqD2XLJXOMMlHy3fq3Ep-4DeD38F4-EFzKwvK3EHbp0"
+
+	if _, err := CryptoConditions.ParseConditionURI("ni:///sha-256;" + fp + "?fpt=legacy-threshold-sha-256&cost=96&subtypes=legacy-preimage-sha-256%2Clegacy-ed25519-sha-256"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"ni:///sha-512;" + fp + "?fpt=legacy-preimage-sha-256&cost=11",
+		"ni:///sha-256;" + fp + "=?fpt=legacy-preimage-sha-256&cost=11",
+		"ni:///sha-256;" + fp[:40] + "?fpt=legacy-preimage-sha-256&cost=11",
+		"ni:///sha-256;" + fp,
+		"ni:///sha-256;" + fp + "?fpt=legacy-preimage-sha-256",
+		"ni:///sha-256;" + fp + "?fpt=legacy-preimage-sha-256&cost=011",
+		"ni:///sha-256;" + fp + "?fpt=legacy-preimage-sha-256&cost=-1",
+		"ni:///sha-256;" + fp + "?fpt=legacy-preimage-sha-256&cost=11&cost=11",
+		"ni:///sha-256;" + fp + "?fpt=legacy-preimage-sha-256&cost=11&foo=bar",
+		"ni:///sha-256;" + fp + "?fpt=sha-256&cost=11",
+		"ni:///sha-256;" + fp + "?fpt=legacy-preimage-sha-256&cost=11&subtypes=legacy-ed25519-sha-256",
+		"ni:///sha-256;" + fp + "?fpt=legacy-threshold-sha-256&cost=96&subtypes=foo",
+		"ni:///sha-256;" + fp + "?fpt=legacy-threshold-sha-256&cost=96&subtypes=legacy-ed25519-sha-256,legacy-ed25519-sha-256",
+	} {
+		if _, err := CryptoConditions.ParseConditionURI(s); err == nil {
+			t.Fatal("invalid URI accepted", s)
+		}
+	}
+
+	if _, err := Sha256.ParseURI(edCond.URI()); err == nil {
+		t.Fatal("condition of another type accepted")
+	}
+}
+
+func TestCost(t *testing.T) {
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte("hello"),
+	}
+	// The longest preimage that fits the length of "cf:1:1:aGVsbG8="
+	shaCond := shaFul.Condition()
+	if shaCond.Cost != 6 {
+		t.Fatal("preimage cost incorrect", shaCond.Cost)
+	}
+
+	edConds := []string{}
+	for _, key := range [][]byte{privkey1[:], privkey2[:], privkey3[:]} {
+		edFul := &Ed25519Sha256.Fulfillment{
+			PublicKey:               key[32:],
+			MaxDynamicMessageLength: 16,
+		}
+		edFul.Sign(key)
+		edCond := edFul.Condition()
+		if edCond.Cost != Ed25519Sha256.FixedCost {
+			t.Fatal("Ed25519 cost incorrect", edCond.Cost)
+		}
+		edConds = append(edConds, edCond.Serialize())
+	}
+
+	// 2 of 3 signatures, plus the preimage which has no weight
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 0, String: []byte(shaFul.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edConds[0])},
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edConds[1])},
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edConds[2])},
+		},
+	}
+	thrCond := thrFul.Condition()
+	if thrCond.Cost != 2*Ed25519Sha256.FixedCost+4*1024 {
+		t.Fatal("threshold cost incorrect", thrCond.Cost)
+	}
+
+	// Heavy subconditions don't lower the cost of a minimal fulfillment made
+	// of light ones
+	thrFul.SubConditions[0].Weight = 2
+	if cost := thrFul.Condition().Cost; cost != 2*Ed25519Sha256.FixedCost+4*1024 {
+		t.Fatal("threshold cost incorrect", cost)
+	}
+
+	// The URI carries the cost and is checked against it
+	parsed, err := Sha256.ParseURI(shaCond.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shaFul.Validate(parsed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed.Cost = 4
+	if err := shaFul.Validate(parsed, nil); err != validation.ErrCostExceeded {
+		t.Fatal("expected cost exceeded", err)
+	}
+
+	// Conditions parsed from strings get the cost their length limit allows,
+	// as derived ones do
+	parsed, err = Sha256.ParseCondition(shaCond.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Cost != shaCond.Cost {
+		t.Fatal("parsed cost differs", parsed.Cost)
+	}
+}
+
+func TestPrefixSha256Fulfillment(t *testing.T) {
+	// ECDSA signatures of the message with the prefix prepended
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(message string) *EcdsaP256Sha256.Fulfillment {
+		ecFul := &EcdsaP256Sha256.Fulfillment{}
+		if err := ecFul.Sign(ecKey, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		return ecFul
+	}
+	ecFul := sign("prefixmessage")
+
+	ful := &PrefixSha256.Fulfillment{
+		Prefix:           []byte("prefix"),
+		MaxMessageLength: 16,
+		Subfulfillment:   []byte(ecFul.Serialize()),
+	}
+
+	parsed, err := PrefixSha256.ParseFulfillment(ful.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, ful) {
+		t.Fatal("fulfillment did not round trip", parsed)
+	}
+
+	// The cost of the subcondition is read from its condition string
+	ecCond := ecFul.Condition()
+	subCond, err := EcdsaP256Sha256.ParseCondition(ecCond.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cond := ful.Condition()
+	if cond.Cost != subCond.Cost+6+16+1024 {
+		t.Fatal("prefix cost incorrect", cond.Cost)
+	}
+	if uint64(len(ful.Serialize())) > cond.MaxFulfillmentLength {
+		t.Fatal("max fulfillment length too small", cond.MaxFulfillmentLength)
+	}
+
+	condString, err := CryptoConditions.FulfillmentToCondition(ful.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condString != cond.Serialize() {
+		t.Fatal("generic condition incorrect", condString)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), condString, []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), condString, make([]byte, 17)); err != validation.ErrMessageTooLong {
+		t.Fatal("expected message too long", err)
+	}
+
+	// The prefix is committed to
+	other := *ful
+	other.Prefix = []byte("other")
+	if err := other.Validate(&cond, nil); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+
+	// The prefix is prepended to the message before it is passed on, so the
+	// inner message length limit must leave room for it
+	inner := *ful
+	inner.Subfulfillment = []byte(sign("prefixoutermessage").Serialize())
+	outer := &PrefixSha256.Fulfillment{
+		Prefix:           []byte("outer"),
+		MaxMessageLength: 16,
+		Subfulfillment:   []byte(inner.Serialize()),
+	}
+	outerCond := outer.Condition()
+	if err := outer.Validate(&outerCond, []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	if err := outer.Validate(&outerCond, make([]byte, 12)); err != validation.ErrMessageTooLong {
+		t.Fatal("expected message too long", err)
+	}
+
+	// Binary and URI encodings round trip through the generic parsers
+	b, err := outer.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := CryptoConditions.ParseFulfillmentBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Serialize() != outer.Serialize() {
+		t.Fatal("binary fulfillment did not round trip", decoded.Serialize())
+	}
+
+	b, err = outerCond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedCond, err := CryptoConditions.ParseConditionBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedCond.Serialize() != outerCond.Serialize() {
+		t.Fatal("binary condition did not round trip", decodedCond.Serialize())
+	}
+
+	uriCond, err := CryptoConditions.ParseConditionURI(outerCond.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uriCond.URI() != outerCond.URI() {
+		t.Fatal("URI did not round trip", uriCond.URI())
+	}
+
+	// The prefix binds subfulfillments that sign the message
+	if err := ful.Validate(&cond, []byte("other")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// and rejects those that ignore it
+	shaFul := &Sha256.Fulfillment{Preimage: []byte("hello")}
+	edFul := &Ed25519Sha256.Fulfillment{PublicKey: pubkey1[:], FixedMessage: []byte("hello")}
+	edFul.Sign(privkey1[:])
+	timeoutFul := &TimeoutSha256.Fulfillment{Expiry: time.Now().Add(time.Hour), Before: true}
+
+	for _, sub := range []CryptoConditions.Fulfillment{shaFul, edFul, timeoutFul} {
+		unbound := &PrefixSha256.Fulfillment{Prefix: []byte("prefix"), MaxMessageLength: 16, Subfulfillment: []byte(sub.Serialize())}
+		unboundCond := unbound.Condition()
+		if err := unbound.Validate(&unboundCond, []byte("message")); err != validation.ErrMessageIgnored {
+			t.Fatal("expected message ignored", sub.Serialize(), err)
+		}
+	}
+}
+
+func TestRsaSha256Fulfillment(t *testing.T) {
+	privkey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("message")
+	ful := &RsaSha256.Fulfillment{}
+	if err := ful.Sign(privkey, message); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := RsaSha256.ParseFulfillment(ful.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, ful) {
+		t.Fatal("fulfillment did not round trip", parsed)
+	}
+
+	cond := ful.Condition()
+	if cond.Cost != 256*256 {
+		t.Fatal("RSA cost incorrect", cond.Cost)
+	}
+	if uint64(len(ful.Serialize())) != cond.MaxFulfillmentLength {
+		t.Fatal("max fulfillment length incorrect", cond.MaxFulfillmentLength)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), cond.Serialize(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), cond.Serialize(), []byte("other")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Conditions parsed from strings get the cost of the longest modulus
+	// that fits
+	parsedCond, err := RsaSha256.ParseCondition(cond.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedCond.Cost < cond.Cost {
+		t.Fatal("cost bound too small", parsedCond.Cost)
+	}
+
+	// Moduli out of range and mismatched signature lengths are rejected
+	for _, f := range []*RsaSha256.Fulfillment{
+		{Modulus: ful.Modulus[:127], Signature: ful.Signature[:127]},
+		{Modulus: append([]byte{0}, ful.Modulus[1:]...), Signature: ful.Signature},
+		// 1020 bits, which crypto/rsa refuses
+		{Modulus: append([]byte{0x0f}, ful.Modulus[1:128]...), Signature: ful.Signature[:128]},
+		{Modulus: make([]byte, 513), Signature: make([]byte, 513)},
+		{Modulus: ful.Modulus, Signature: ful.Signature[1:]},
+	} {
+		if _, err := RsaSha256.ParseFulfillment(f.Serialize()); err == nil {
+			t.Fatal("invalid fulfillment accepted", f.Serialize())
+		}
+	}
+
+	// The signature covers the message the parent passes on
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:           []byte("prefix"),
+		MaxMessageLength: 16,
+	}
+	prefixed := &RsaSha256.Fulfillment{}
+	if err := prefixed.Sign(privkey, []byte("prefixmessage")); err != nil {
+		t.Fatal(err)
+	}
+	prefixFul.Subfulfillment = []byte(prefixed.Serialize())
+	prefixCond := prefixFul.Condition()
+	if err := prefixFul.Validate(&prefixCond, message); err != nil {
+		t.Fatal(err)
+	}
+	prefixFul.Subfulfillment = []byte(ful.Serialize())
+	prefixCond = prefixFul.Condition()
+	if err := prefixFul.Validate(&prefixCond, message); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(ful.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{},
+	}
+	thrCond := thrFul.Condition()
+	if err := thrFul.Validate(&thrCond, message); err != nil {
+		t.Fatal(err)
+	}
+	if err := thrFul.Validate(&thrCond, []byte("other")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Binary and URI encodings round trip through the generic parsers
+	b, err := thrFul.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := CryptoConditions.ParseFulfillmentBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Serialize() != thrFul.Serialize() {
+		t.Fatal("binary fulfillment did not round trip", decoded.Serialize())
+	}
+
+	b, err = cond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedCond, err := CryptoConditions.ParseConditionBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedCond.Serialize() != cond.Serialize() {
+		t.Fatal("binary condition did not round trip", decodedCond.Serialize())
+	}
+
+	uriCond, err := CryptoConditions.ParseConditionURI(cond.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uriCond.URI() != cond.URI() {
+		t.Fatal("URI did not round trip", uriCond.URI())
+	}
+}
+
+func TestEcdsaP256Sha256Fulfillment(t *testing.T) {
+	privkey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("message")
+	ful := &EcdsaP256Sha256.Fulfillment{}
+	if err := ful.Sign(privkey, message); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := EcdsaP256Sha256.ParseFulfillment(ful.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, ful) {
+		t.Fatal("fulfillment did not round trip", parsed)
+	}
+
+	cond := ful.Condition()
+	if uint64(len(ful.Serialize())) != cond.MaxFulfillmentLength {
+		t.Fatal("max fulfillment length incorrect", cond.MaxFulfillmentLength)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), cond.Serialize(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), cond.Serialize(), []byte("other")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Keys that are not points of the curve never verify
+	offCurve := &EcdsaP256Sha256.Fulfillment{
+		PublicKey: append([]byte{2}, make([]byte, 32)...),
+		Signature: ful.Signature,
+	}
+	offCurveCond := offCurve.Condition()
+	if err := offCurve.Validate(&offCurveCond, message); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	for _, f := range []*EcdsaP256Sha256.Fulfillment{
+		{PublicKey: ful.PublicKey[1:], Signature: ful.Signature},
+		{PublicKey: ful.PublicKey, Signature: ful.Signature[1:]},
+	} {
+		if _, err := EcdsaP256Sha256.ParseFulfillment(f.Serialize()); err == nil {
+			t.Fatal("invalid fulfillment accepted", f.Serialize())
+		}
+	}
+
+	// Signature OR preimage
+	shaFul := &Sha256.Fulfillment{
+		Preimage: []byte("hello"),
+	}
+	shaCond := shaFul.Condition()
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(ful.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(shaCond.Serialize())},
+		},
+	}
+	thrCond := thrFul.Condition()
+	if features.Bitmask(thrCond.FeatureBitmask[0])&features.EcdsaP256 == 0 {
+		t.Fatal("feature bitmask incorrect", thrCond.FeatureBitmask)
+	}
+	if err := thrFul.Validate(&thrCond, message); err != nil {
+		t.Fatal(err)
+	}
+	if err := thrFul.Validate(&thrCond, []byte("other")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Binary and URI encodings round trip through the generic parsers
+	b, err := thrFul.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := CryptoConditions.ParseFulfillmentBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Serialize() != thrFul.Serialize() {
+		t.Fatal("binary fulfillment did not round trip", decoded.Serialize())
+	}
+
+	b, err = cond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedCond, err := CryptoConditions.ParseConditionBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedCond.Serialize() != cond.Serialize() {
+		t.Fatal("binary condition did not round trip", decodedCond.Serialize())
+	}
+
+	uriCond, err := CryptoConditions.ParseConditionURI(cond.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uriCond.URI() != cond.URI() {
+		t.Fatal("URI did not round trip", uriCond.URI())
+	}
+}
+
+func TestTimeoutSha256Fulfillment(t *testing.T) {
+	expiry := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := expiry.Add(-time.Hour)
+
+	after := &TimeoutSha256.Fulfillment{Expiry: expiry}
+	before := &TimeoutSha256.Fulfillment{Expiry: expiry, Before: true}
+
+	for _, ful := range []*TimeoutSha256.Fulfillment{after, before} {
+		parsed, err := TimeoutSha256.ParseFulfillment(ful.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Serialize() != ful.Serialize() || !parsed.Expiry.Equal(ful.Expiry) || parsed.Before != ful.Before {
+			t.Fatal("fulfillment did not round trip", parsed)
+		}
+	}
+
+	afterCond := after.Condition()
+	beforeCond := before.Condition()
+	if afterCond.Hash == beforeCond.Hash {
+		t.Fatal("fingerprint doesn't commit to the mode")
+	}
+
+	if err := CryptoConditions.ValidateAt(after.Serialize(), afterCond.Serialize(), nil, now); err != validation.ErrNotYetValid {
+		t.Fatal("expected not yet valid", err)
+	}
+	if err := CryptoConditions.ValidateAt(before.Serialize(), beforeCond.Serialize(), nil, now); err != nil {
+		t.Fatal(err)
+	}
+
+	now = expiry
+	if err := after.ValidateAt(&afterCond, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := before.ValidateAt(&beforeCond, nil, now); err != validation.ErrExpired {
+		t.Fatal("expected expired", err)
+	}
+
+	if err := after.ValidateAt(&afterCond, nil, expiry.Add(-time.Second)); err != validation.ErrNotYetValid {
+		t.Fatal("expected not yet valid", err)
+	}
+
+	// Validations at different times don't interfere
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			at := expiry.Add(-time.Second)
+			if i%2 == 1 {
+				at = expiry
+			}
+			errs[i] = CryptoConditions.ValidateAt(after.Serialize(), afterCond.Serialize(), nil, at)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if (i%2 == 1) != (err == nil) {
+			t.Fatal("validation used another goroutine's time", i, err)
+		}
+	}
+
+	// Only canonical UTC timestamps are accepted
+	for _, s := range []string{
+		"2017-03-01T12:00:00+01:00",
+		"2017-03-01T12:00:00.000Z",
+		"2017-03-01",
+	} {
+		f := "cf:1:64:" + base64.URLEncoding.EncodeToString(append(encoding.MakeVarbyte([]byte(s)), 0))
+		if _, err := TimeoutSha256.ParseFulfillment(f); err == nil {
+			t.Fatal("invalid expiry accepted", s)
+		}
+	}
+
+	// Signature OR after the expiry, as a refund path
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MaxDynamicMessageLength: 16,
+	}
+	edFul.Sign(privkey1[:])
+	edCond := edFul.Condition()
+
+	refund := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(after.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			ThresholdSha256.WeightedString{Weight: 1, String: []byte(edCond.Serialize())},
+		},
+	}
+	refundCond := refund.Condition()
+	if err := refund.ValidateAt(&refundCond, nil, now); err != nil {
+		t.Fatal(err)
+	}
+
+	now = expiry.Add(-time.Second)
+	if err := refund.ValidateAt(&refundCond, nil, now); err != validation.ErrNotYetValid {
+		t.Fatal("expected not yet valid", err)
+	}
+
+	// Binary and URI encodings round trip through the generic parsers
+	b, err := refund.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := CryptoConditions.ParseFulfillmentBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Serialize() != refund.Serialize() {
+		t.Fatal("binary fulfillment did not round trip", decoded.Serialize())
+	}
+
+	b, err = afterCond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedCond, err := CryptoConditions.ParseConditionBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedCond.Serialize() != afterCond.Serialize() {
+		t.Fatal("binary condition did not round trip", decodedCond.Serialize())
+	}
+
+	uriCond, err := CryptoConditions.ParseConditionURI(afterCond.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uriCond.URI() != afterCond.URI() {
+		t.Fatal("URI did not round trip", uriCond.URI())
+	}
+}
+
+func TestHTLC(t *testing.T) {
+	preimage := []byte("secret")
+	preimageFul := &Sha256.Fulfillment{Preimage: preimage}
+
+	deadline := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := deadline.Add(-time.Hour)
+
+	h := &htlc.HTLC{
+		Hash:         preimageFul.Condition(),
+		RecipientKey: pubkey1[:],
+		SenderKey:    pubkey2[:],
+		Deadline:     deadline,
+		ID:           []byte("swap 1"),
+	}
+	cond := h.Condition()
+	condString := cond.Serialize()
+
+	claimSig := ed25519.Sign(privkey1[:], h.ClaimMessage())
+	refundSig := ed25519.Sign(privkey2[:], h.RefundMessage())
+
+	claim, err := h.Claim(preimage, claimSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.ValidateAt(claim.Serialize(), condString, nil, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Claim([]byte("wrong"), claimSig); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+	if _, err := h.Claim(preimage, refundSig); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	if _, err := h.Refund(refundSig, now); err != validation.ErrNotYetValid {
+		t.Fatal("expected not yet valid", err)
+	}
+
+	// A Hash with a MaxFulfillmentLength of its own
+	limited := *h
+	limited.Hash = (&Sha256.Fulfillment{Preimage: preimage, MaxFulfillmentLength: 100}).Condition()
+	limitedCond := limited.Condition()
+	limitedClaim, err := limited.Claim(preimage, ed25519.Sign(privkey1[:], limited.ClaimMessage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.ValidateAt(limitedClaim.Serialize(), limitedCond.Serialize(), nil, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// From the deadline on, only the refund path is valid
+	now = deadline
+	if err := CryptoConditions.ValidateAt(claim.Serialize(), condString, nil, now); err != validation.ErrExpired {
+		t.Fatal("expected expired", err)
+	}
+
+	refund, err := h.Refund(refundSig, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.ValidateAt(refund.Serialize(), condString, nil, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Refund(claimSig, now); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// The condition commits to the deadline
+	other := *h
+	other.Deadline = deadline.Add(time.Second)
+	otherCond := other.Condition()
+	if err := CryptoConditions.ValidateAt(refund.Serialize(), otherCond.Serialize(), nil, now); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+	if _, err := other.Refund(refundSig, other.Deadline); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Signatures for one HTLC are no good for another over the same Hash,
+	// keys and Deadline
+	other = *h
+	other.ID = []byte("swap 2")
+	otherCond = other.Condition()
+	now = deadline.Add(-time.Hour)
+	if err := CryptoConditions.ValidateAt(claim.Serialize(), otherCond.Serialize(), nil, now); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+	if _, err := other.Claim(preimage, claimSig); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+	if _, err := other.Refund(refundSig, deadline); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+	otherClaim, err := other.Claim(preimage, ed25519.Sign(privkey1[:], other.ClaimMessage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.ValidateAt(otherClaim.Serialize(), otherCond.Serialize(), nil, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.ValidateAt(otherClaim.Serialize(), condString, nil, now); err != validation.ErrFingerprintMismatch {
+		t.Fatal("expected fingerprint mismatch", err)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		FixedMessage:            []byte("hello"),
+		MaxDynamicMessageLength: 5,
+	}
+	edFul.Sign(privkey1[:])
+
+	// Prefixes take Ed25519Sha256 fulfillments under a threshold only, as
+	// they ignore the message
+	edThrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(edFul.Serialize())}},
+	}
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:           []byte{},
+		MaxMessageLength: 0,
+		Subfulfillment:   []byte(edThrFul.Serialize()),
+	}
+	if prefixFul.Features() != features.Sha256|features.Prefix|features.Threshold|features.Ed25519 {
+		t.Fatal("prefix feature suites incorrect", prefixFul.Features())
+	}
+
+	timeoutFul := &TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	timeoutCond := timeoutFul.Condition()
+
+	// The suites of fulfilled subconditions are read down the tree, those of
+	// unfulfilled ones from their type
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(prefixFul.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(timeoutCond.Serialize())},
+		},
+	}
+	thrCond := thrFul.Condition()
+	want := features.Sha256 | features.Threshold | features.Prefix | features.Ed25519 | features.Timeout
+	if !reflect.DeepEqual(thrCond.FeatureBitmask, []byte{byte(want)}) {
+		t.Fatal("threshold feature suites incorrect", thrCond.FeatureBitmask)
+	}
+	if want.String() != "SHA-256, PREFIX, THRESHOLD, ED25519, TIMEOUT" {
+		t.Fatal("feature suite names incorrect", want.String())
+	}
+
+	v := &CryptoConditions.Verifier{Supported: features.All}
+	if err := v.Validate(thrFul.Serialize(), thrCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A node without timeouts can't verify the threshold, even though the
+	// timeout is not fulfilled
+	v.Supported = features.All &^ features.Timeout
+	if err := v.Validate(thrFul.Serialize(), thrCond.Serialize(), nil); err != validation.ErrUnsupportedFeature {
+		t.Fatal("expected unsupported feature", err)
+	}
+
+	edCond := edFul.Condition()
+	if err := v.Validate(edFul.Serialize(), edCond.Serialize(), nil); err != nil {
+		t.Fatal(err)
+	}
+	v.Supported = features.Sha256
+	if err := v.Validate(edFul.Serialize(), edCond.Serialize(), nil); err != validation.ErrUnsupportedFeature {
+		t.Fatal("expected unsupported feature", err)
+	}
+
+	// Unsupported suites are rejected before signatures are verified
+	forged := *edFul
+	forged.Signature = make([]byte, 64)
+	if err := v.Validate(forged.Serialize(), edCond.Serialize(), nil); err != validation.ErrUnsupportedFeature {
+		t.Fatal("expected unsupported feature", err)
+	}
+	v.Supported = features.All
+	if err := v.Validate(forged.Serialize(), edCond.Serialize(), nil); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// The bits of the crypto-conditions spec
+	for suite, bit := range map[features.Bitmask]byte{
+		features.Sha256:    0x01,
+		features.Preimage:  0x02,
+		features.Prefix:    0x04,
+		features.Threshold: 0x08,
+		features.RsaPss:    0x10,
+		features.Ed25519:   0x20,
+	} {
+		if byte(suite) != bit {
+			t.Fatal("feature suite", suite, "has bit", byte(suite))
+		}
+	}
+	shaFul := &Sha256.Fulfillment{Preimage: []byte("secret")}
+	if suites, _ := registry.Features(shaFul); suites != features.Sha256|features.Preimage {
+		t.Fatal("preimage feature suites incorrect", suites)
+	}
+}
+
+func TestSubtypes(t *testing.T) {
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		FixedMessage:            []byte("hello"),
+		MaxDynamicMessageLength: 5,
+	}
+	edFul.Sign(privkey1[:])
+
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:         []byte{},
+		Subfulfillment: []byte(edFul.Serialize()),
+	}
+	prefixCond := prefixFul.Condition()
+	if !reflect.DeepEqual(prefixCond.Subtypes().Names(), []string{encoding.LegacyEd25519Sha256Name}) {
+		t.Fatal("prefix subtypes incorrect", prefixCond.Subtypes().Names())
+	}
+
+	timeoutFul := &TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	timeoutCond := timeoutFul.Condition()
+
+	inner := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(prefixFul.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(timeoutCond.Serialize())},
+		},
+	}
+
+	// The subtypes of subconditions are carried up, the threshold's own type
+	// left out
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(inner.Serialize())},
+			{Weight: 1, String: []byte((&Sha256.Fulfillment{Preimage: []byte{42}}).Serialize())},
+		},
+	}
+	thrCond := thrFul.Condition()
+	want := []string{
+		encoding.LegacyPreimageSha256Name,
+		encoding.LegacyPrefixSha256Name,
+		encoding.LegacyEd25519Sha256Name,
+		encoding.TimeoutSha256Name,
+	}
+	if !reflect.DeepEqual(thrCond.Subtypes().Names(), want) {
+		t.Fatal("threshold subtypes incorrect", thrCond.Subtypes().Names())
+	}
+
+	// Subtypes are carried by the URI and binary formats
+	uri := thrCond.URI()
+	if !strings.HasSuffix(uri, "&subtypes=legacy-preimage-sha-256,legacy-prefix-sha-256,legacy-ed25519-sha-256,timeout-sha-256") {
+		t.Fatal("subtypes missing from URI", uri)
+	}
+	fromURI, err := ThresholdSha256.ParseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromURI.Subtypes() != thrCond.Subtypes() {
+		t.Fatal("subtypes did not round trip", fromURI.Subtypes().Names())
+	}
+
+	b, err := thrCond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBinary, err := ThresholdSha256.ParseConditionBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromBinary.Subtypes() != thrCond.Subtypes() {
+		t.Fatal("subtypes did not round trip", fromBinary.Subtypes().Names())
+	}
+
+	b, err = prefixCond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefixFromBinary, err := PrefixSha256.ParseConditionBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefixFromBinary.Subtypes() != prefixCond.Subtypes() {
+		t.Fatal("subtypes did not round trip", prefixFromBinary.Subtypes().Names())
+	}
+
+	// The string format has no room for subtypes
+	fromString, err := ThresholdSha256.ParseCondition(thrCond.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromString.Subtypes() != 0 {
+		t.Fatal("subtypes read from string", fromString.Subtypes().Names())
+	}
+
+	fp := base64.RawURLEncoding.EncodeToString(thrCond.Fingerprint)
+	if _, err := ThresholdSha256.ParseURI("ni:///sha-256;" + fp + "?fpt=legacy-threshold-sha-256&cost=96&subtypes=legacy-threshold-sha-256"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		FixedMessage:            []byte("hello"),
+		MaxDynamicMessageLength: 5,
+	}
+	edFul.Sign(privkey1[:])
+
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:         []byte{1, 2},
+		Subfulfillment: []byte(edFul.Serialize()),
+	}
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 3, String: []byte(prefixFul.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte("cc:1:1:garbage:1")},
+		},
+	}
+	thrCond := thrFul.Condition()
+
+	n, err := CryptoConditions.Explain(thrFul.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := n.Text()
+	for _, line := range []string{
+		"fulfillment legacy-threshold-sha-256\n",
+		"  threshold: 1\n",
+		"  fingerprint: " + fmt.Sprintf("%x", thrCond.Fingerprint) + "\n",
+		"  fulfillment legacy-prefix-sha-256\n    weight: 3\n    prefix: 0102\n",
+		"    fulfillment legacy-ed25519-sha-256\n      public key: " + fmt.Sprintf("%x", pubkey1) + "\n",
+		"      fixed message: " + fmt.Sprintf("%x", "hello") + "\n",
+		"  invalid\n    weight: 1\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("explanation lacks %q:\n%s", line, text)
+		}
+	}
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree struct {
+		Kind     string
+		Type     string
+		Fields   map[string]string
+		Children []struct {
+			Kind   string
+			Fields map[string]string
+		}
+	}
+	if err := json.Unmarshal(b, &tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Kind != explain.KindFulfillment || tree.Type != encoding.LegacyThresholdSha256Name || tree.Fields["threshold"] != "1" {
+		t.Fatal("JSON explanation incorrect", string(b))
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Fields["weight"] != "3" || tree.Children[1].Kind != explain.KindInvalid {
+		t.Fatal("JSON explanation children incorrect", string(b))
+	}
+
+	// Conditions, including those parsed from URIs
+	n, err = CryptoConditions.Explain(thrCond.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(n.Text(), "  max fulfillment length: unknown\n  cost: ") ||
+		!strings.Contains(n.Text(), "  subtypes: legacy-prefix-sha-256, legacy-ed25519-sha-256\n") {
+		t.Fatal("condition explanation incorrect", n.Text())
+	}
+
+	// Invalid signatures, down the tree too, are described rather than
+	// failing to parse
+	if !strings.Contains(text, "      signature valid: true\n") {
+		t.Fatal("explanation lacks signature validity", text)
+	}
+	forged := *edFul
+	forged.Signature = make([]byte, 64)
+	forgedPrefix := &PrefixSha256.Fulfillment{Subfulfillment: []byte(forged.Serialize())}
+	for _, s := range []string{forged.Serialize(), forgedPrefix.Serialize()} {
+		n, err = CryptoConditions.Explain(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(n.Text(), "  signature valid: false\n") {
+			t.Fatal("explanation lacks invalid signature", n.Text())
+		}
+	}
+
+	// Types that don't describe themselves
+	attestation := &attestationFulfillment{Statement: []byte("hello")}
+	n = explain.Of(attestation)
+	if n.Kind != explain.KindFulfillment || n.Type != attestationName {
+		t.Fatal("explanation of an undescribed type incorrect", n.Text())
+	}
+
+	if _, err := CryptoConditions.Explain("cf:1:1:!"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// An in-house condition type, fulfilled by a message equal to its Statement,
+// registered to check that the generic parsers and compound conditions handle
+// types defined outside the repository.
+func TestJSON(t *testing.T) {
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		MessageId:               []byte("id"),
+		FixedMessage:            []byte("hello"),
+		MaxDynamicMessageLength: 5,
+	}
+	edFul.Sign(privkey1[:])
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFul := &RsaSha256.Fulfillment{}
+	if err := rsaFul.Sign(rsaKey, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaFul := &EcdsaP256Sha256.Fulfillment{}
+	if err := ecdsaFul.Sign(ecdsaKey, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:           []byte{1, 2},
+		MaxMessageLength: 7,
+		Subfulfillment:   []byte(edFul.Serialize()),
+	}
+
+	timeoutCond := (&TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}).Condition()
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(prefixFul.Serialize())},
+			{Weight: 1, String: []byte((&Sha256.Fulfillment{Preimage: []byte("secret")}).Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			{Weight: 2, String: []byte(timeoutCond.Serialize())},
+		},
+	}
+
+	for _, ful := range []CryptoConditions.Fulfillment{
+		&Sha256.Fulfillment{Preimage: []byte("secret")},
+		&Sha256.Fulfillment{},
+		edFul,
+		rsaFul,
+		ecdsaFul,
+		&TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), Before: true},
+		prefixFul,
+		thrFul,
+	} {
+		b, err := json.Marshal(ful)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := CryptoConditions.UnmarshalFulfillmentJSON(b)
+		if err != nil {
+			t.Fatal(err, string(b))
+		}
+		if parsed.Serialize() != ful.Serialize() {
+			t.Fatal("fulfillment JSON doesn't round-trip", string(b))
+		}
+
+		cond, err := CryptoConditions.ConditionOf(ful)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = json.Marshal(cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsedCond, err := CryptoConditions.UnmarshalConditionJSON(b)
+		if err != nil {
+			t.Fatal(err, string(b))
+		}
+		if parsedCond.Serialize() != cond.Serialize() || parsedCond.URI() != cond.URI() {
+			t.Fatal("condition JSON doesn't round-trip", string(b))
+		}
+	}
+
+	// Compound fulfillments marshal children with bad signatures, which only
+	// fail to validate
+	forged := *edFul
+	forged.Signature = make([]byte, 64)
+	forgedPrefix := &PrefixSha256.Fulfillment{MaxMessageLength: 5, Subfulfillment: []byte(forged.Serialize())}
+	forgedThr := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(forged.Serialize())}},
+	}
+	for _, ful := range []CryptoConditions.Fulfillment{forgedPrefix, forgedThr} {
+		if _, err := json.Marshal(ful); err != nil {
+			t.Fatal("fulfillment with a bad signature doesn't marshal:", err)
+		}
+		if _, err := ful.SerializeBinary(); err != nil {
+			t.Fatal("fulfillment with a bad signature doesn't serialize:", err)
+		}
+	}
+
+	// The schema
+	b, err := json.Marshal(&Sha256.Fulfillment{Preimage: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"type":"legacy-preimage-sha-256","preimage":"c2VjcmV0"}` {
+		t.Fatal("preimage fulfillment JSON incorrect", string(b))
+	}
+
+	thrCond := thrFul.Condition()
+	b, err = json.Marshal(&thrCond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(b, &tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree["type"] != encoding.LegacyThresholdSha256Name || tree["featureBitmask"] != float64(thrCond.FeatureBitmask[0]) ||
+		!reflect.DeepEqual(tree["subtypes"], []interface{}{"legacy-preimage-sha-256", "legacy-prefix-sha-256", "legacy-ed25519-sha-256", "timeout-sha-256"}) {
+		t.Fatal("threshold condition JSON incorrect", string(b))
+	}
+
+	// Ed25519 conditions built in memory keep their public key, which must
+	// match the fingerprint
+	edCond := edFul.Condition()
+	b, err = json.Marshal(&edCond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsedEdCond Ed25519Sha256.Condition
+	if err := json.Unmarshal(b, &parsedEdCond); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsedEdCond.PublicKey, pubkey1[:]) || parsedEdCond.Fingerprint() != edCond.Fingerprint() {
+		t.Fatal("Ed25519 condition JSON doesn't keep the public key", string(b))
+	}
+	tampered := strings.Replace(string(b), `"publicKey":"`, `"publicKey":"A`, 1)
+	if err := json.Unmarshal([]byte(tampered), &parsedEdCond); err == nil {
+		t.Fatal("Ed25519 condition with a mismatched public key unmarshaled")
+	}
+
+	// Wrong and unknown types
+	var sha256Ful Sha256.Fulfillment
+	if err := json.Unmarshal([]byte(`{"type":"legacy-ed25519-sha-256","preimage":""}`), &sha256Ful); err == nil {
+		t.Fatal("fulfillment of the wrong type unmarshaled")
+	}
+	if _, err := CryptoConditions.UnmarshalConditionJSON([]byte(`{"type":"unknown-sha-256"}`)); err == nil {
+		t.Fatal("condition of an unknown type unmarshaled")
+	}
+	if _, err := CryptoConditions.UnmarshalFulfillmentJSON([]byte(`{"type":"legacy-prefix-sha-256","prefix":"","maxMessageLength":0,"subfulfillment":{"type":"legacy-preimage-sha-256","preimage":"!"}}`)); err == nil {
+		t.Fatal("prefix fulfillment with an invalid subfulfillment unmarshaled")
+	}
+}
+
+// Fulfillments of every type, for the serialization tests and benchmarks
+func serializationFixtures(tb testing.TB) map[string]CryptoConditions.Fulfillment {
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		FixedMessage:            []byte("hello"),
+		MaxDynamicMessageLength: 5,
+		DynamicMessage:          []byte("world"),
+	}
+	edFul.Sign(privkey1[:])
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	rsaFul := &RsaSha256.Fulfillment{}
+	if err := rsaFul.Sign(rsaKey, []byte("hello")); err != nil {
+		tb.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ecdsaFul := &EcdsaP256Sha256.Fulfillment{}
+	if err := ecdsaFul.Sign(ecdsaKey, []byte("hello")); err != nil {
+		tb.Fatal(err)
+	}
+
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:         []byte{1, 2},
+		Subfulfillment: []byte(edFul.Serialize()),
+	}
+
+	timeoutFul := &TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), Before: true}
+	timeoutCond := timeoutFul.Condition()
+
+	return map[string]CryptoConditions.Fulfillment{
+		"legacy-preimage-sha-256": &Sha256.Fulfillment{Preimage: []byte("secret")},
+		"legacy-ed25519-sha-256":  edFul,
+		"legacy-rsa-sha-256":      rsaFul,
+		"ecdsa-p256-sha-256":      ecdsaFul,
+		"timeout-sha-256":         timeoutFul,
+		"legacy-prefix-sha-256":   prefixFul,
+		"legacy-threshold-sha-256": &ThresholdSha256.ThresholdSha256Fulfillment{
+			Threshold: 2,
+			SubFulfillments: ThresholdSha256.WeightedStrings{
+				{Weight: 1, String: []byte(prefixFul.Serialize())},
+				{Weight: 1, String: []byte(edFul.Serialize())},
+			},
+			SubConditions: ThresholdSha256.WeightedStrings{
+				{Weight: 2, String: []byte(timeoutCond.Serialize())},
+			},
+		},
+	}
+}
+
+func TestAppendSerialize(t *testing.T) {
+	check := func(name string, v interface{ Serialize() string }) {
+		a, ok := v.(registry.Appender)
+		if !ok {
+			t.Fatal(name, "doesn't implement Appender")
+		}
+
+		want := v.Serialize()
+		if a.SerializedLength() != len(want) {
+			t.Fatal(name, "serialized length", a.SerializedLength(), "want", len(want))
+		}
+
+		got := a.AppendSerialize([]byte("prefix"))
+		if string(got) != "prefix"+want {
+			t.Fatal(name, "appended", string(got), "want", want)
+		}
+		if got := registry.AppendSerialize(nil, v); string(got) != want {
+			t.Fatal(name, "appended", string(got), "want", want)
+		}
+
+		// A reused buffer with room enough takes no allocation
+		buf := make([]byte, 0, 2*a.SerializedLength()+256)
+		allocs := testing.AllocsPerRun(10, func() {
+			buf = a.AppendSerialize(buf[:0])
+		})
+		if allocs != 0 {
+			t.Fatal(name, "allocated", allocs, "times")
+		}
+
+		// Nothing is written past the appended bytes
+		spare := bytes.Repeat([]byte{0xaa}, cap(buf))
+		copy(buf[:cap(buf)], spare)
+		buf = a.AppendSerialize(buf[:0])
+		if !bytes.Equal(buf[len(buf):cap(buf)], spare[len(buf):]) {
+			t.Fatal(name, "wrote past the appended bytes")
+		}
+	}
+
+	for name, ful := range serializationFixtures(t) {
+		check(name, ful)
+
+		cond, err := CryptoConditions.ConditionOf(ful)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(name, cond)
+	}
+
+	// Every padding of the base64 encoding
+	for n := 0; n < 5; n++ {
+		check("preimage", &Sha256.Fulfillment{Preimage: bytes.Repeat([]byte{0xff}, n)})
+	}
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	for name, ful := range serializationFixtures(b) {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ful.Serialize()
+			}
+		})
+	}
+}
+
+func BenchmarkAppendSerialize(b *testing.B) {
+	for name, ful := range serializationFixtures(b) {
+		a := ful.(registry.Appender)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			buf := make([]byte, 0, a.SerializedLength())
+			for i := 0; i < b.N; i++ {
+				buf = a.AppendSerialize(buf[:0])
+			}
+		})
+	}
+}
+
+func BenchmarkConditionSerialize(b *testing.B) {
+	for name, ful := range serializationFixtures(b) {
+		cond, err := CryptoConditions.ConditionOf(ful)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cond.Serialize()
+			}
+		})
+	}
+}
+
+func BenchmarkConditionAppendSerialize(b *testing.B) {
+	for name, ful := range serializationFixtures(b) {
+		cond, err := CryptoConditions.ConditionOf(ful)
+		if err != nil {
+			b.Fatal(err)
+		}
+		a := cond.(registry.Appender)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			buf := make([]byte, 0, 2*a.SerializedLength()+256)
+			for i := 0; i < b.N; i++ {
+				buf = a.AppendSerialize(buf[:0])
+			}
+		})
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	edFul := &Ed25519Sha256.Fulfillment{
+		PublicKey:               pubkey1[:],
+		FixedMessage:            []byte("hello"),
+		MaxDynamicMessageLength: 5,
+		DynamicMessage:          []byte("world"),
+	}
+	edFul.Sign(privkey1[:])
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFul := &RsaSha256.Fulfillment{}
+	if err := rsaFul.Sign(rsaKey, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaFul := &EcdsaP256Sha256.Fulfillment{}
+	if err := ecdsaFul.Sign(ecdsaKey, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:         []byte{1, 2},
+		Subfulfillment: []byte(edFul.Serialize()),
+	}
+
+	timeoutCond := (&TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}).Condition()
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(prefixFul.Serialize())},
+			{Weight: 1, String: []byte((&Sha256.Fulfillment{Preimage: []byte("secret")}).Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{
+			{Weight: 2, String: []byte(timeoutCond.Serialize())},
+		},
+	}
+
+	fulfillments := []CryptoConditions.Fulfillment{
+		&Sha256.Fulfillment{Preimage: []byte("secret")},
+		&Sha256.Fulfillment{},
+		edFul,
+		rsaFul,
+		ecdsaFul,
+		&TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), Before: true},
+		&TimeoutSha256.Fulfillment{Expiry: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		prefixFul,
+		thrFul,
+	}
+
+	check := func(c codec.Codec, ful CryptoConditions.Fulfillment) {
+		b, err := c.EncodeFulfillment(ful)
+		if err != nil {
+			t.Fatal(c.Name(), err)
+		}
+
+		parsed, err := c.DecodeFulfillment(b)
+		if err != nil {
+			t.Fatal(c.Name(), err, b)
+		}
+		if parsed.Serialize() != ful.Serialize() {
+			t.Fatal(c.Name(), "fulfillment doesn't round-trip", ful.Serialize())
+		}
+
+		cond, err := CryptoConditions.ConditionOf(ful)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = c.EncodeCondition(cond)
+		if err != nil {
+			t.Fatal(c.Name(), err)
+		}
+
+		parsedCond, err := c.DecodeCondition(b)
+		if err != nil {
+			t.Fatal(c.Name(), err, b)
+		}
+
+		// Conditions only carry what their format has room for, but always
+		// the same fingerprint
+		if c == codec.String {
+			if parsedCond.Serialize() != cond.Serialize() {
+				t.Fatal(c.Name(), "condition doesn't round-trip", cond.Serialize())
+			}
+		} else if parsedCond.URI() != cond.URI() {
+			t.Fatal(c.Name(), "condition doesn't round-trip", cond.URI())
+		}
+	}
+
+	for _, c := range codec.Codecs() {
+		if codec.ByName(c.Name()) != c {
+			t.Fatal("codec not found by name", c.Name())
+		}
+
+		for _, ful := range fulfillments {
+			check(c, ful)
+		}
+	}
+
+	// Types registered outside this repository, with a schema
+	attestation := &attestationFulfillment{Statement: []byte("hello")}
+	check(codec.Protobuf, attestation)
+	check(codec.CBOR, attestation)
+
+	// The formats
+	preimage := &Sha256.Fulfillment{Preimage: []byte("secret")}
+	b, err := codec.Protobuf.EncodeFulfillment(preimage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, append([]byte{0x0a, 0x08, 0x0a, 0x06}, "secret"...)) {
+		t.Fatalf("preimage fulfillment protobuf incorrect: %x", b)
+	}
+
+	b, err = codec.CBOR.EncodeFulfillment(preimage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, append([]byte{0x82, 0x00, 0x46}, "secret"...)) {
+		t.Fatalf("preimage fulfillment CBOR incorrect: %x", b)
+	}
+
+	for _, test := range []struct {
+		codec codec.Codec
+		b     []byte
+	}{
+		// Unknown type
+		{codec.Protobuf, []byte{0xa2, 0x06, 0x00}},
+		// No type
+		{codec.Protobuf, []byte{}},
+		// Truncated
+		{codec.Protobuf, []byte{0x0a, 0x08, 0x0a, 0x06}},
+		// Not in the shortest form
+		{codec.CBOR, append([]byte{0x82, 0x18, 0x00, 0x46}, "secret"...)},
+		// Wrong number of fields
+		{codec.CBOR, []byte{0x81, 0x00}},
+		// Trailing data
+		{codec.CBOR, append([]byte{0x82, 0x00, 0x46}, "secret!"...)},
+	} {
+		if _, err := test.codec.DecodeFulfillment(test.b); err == nil {
+			t.Fatalf("%s fulfillment %x decoded", test.codec.Name(), test.b)
+		}
+	}
+
+	// Checked as in the DER binary format
+	short := append([]byte{0x84, 0x00, 0x58, 0x1f}, make([]byte, 31)...)
+	if _, err := codec.CBOR.DecodeCondition(append(short, 0x00, 0x00)); err == nil {
+		t.Fatal("condition with a short fingerprint decoded")
+	}
+
+	// The spec's types aren't registered, and their DER tags are those of
+	// other types
+	spec := &Rfc.PreimageFulfillment{Preimage: []byte("secret")}
+	specCondition := Rfc.ConditionOf(spec)
+	for _, c := range codec.Codecs() {
+		if _, err := c.EncodeFulfillment(spec); err == nil {
+			t.Fatal(c.Name(), "encoded a fulfillment of the spec")
+		}
+		if _, err := c.EncodeCondition(specCondition); err == nil {
+			t.Fatal(c.Name(), "encoded a condition of the spec")
+		}
+	}
+}
+
+type attestationFulfillment struct {
+	Statement []byte
+}
+
+type attestationCondition struct {
+	Hash                 [32]byte
+	MaxFulfillmentLength uint64
+}
+
+const (
+	attestationID   = "128"
+	attestationName = "attestation-sha-256"
+	attestationTag  = 7
+	attestationCost = 1024
+)
+
+type derAttestation struct {
+	Data []byte `asn1:"tag:0"`
+}
+
+var attestationSchema = encoding.Schema{
+	{Name: "data", Tag: 0, Kind: encoding.KindBytes},
+}
+
+func (ful *attestationFulfillment) Serialize() string {
+	return "cf:1:" + attestationID + ":" + base64.URLEncoding.EncodeToString(ful.Statement)
+}
+
+func (ful *attestationFulfillment) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(attestationTag, derAttestation{Data: ful.Statement})
+}
+
+func (ful *attestationFulfillment) condition() *attestationCondition {
+	return &attestationCondition{
+		Hash:                 sha256.Sum256(ful.Statement),
+		MaxFulfillmentLength: uint64(len(ful.Serialize())),
+	}
+}
+
+func (cond *attestationCondition) Serialize() string {
+	return "cc:1:" + attestationID + ":" + base64.URLEncoding.EncodeToString(cond.Hash[:]) + ":" + strconv.FormatUint(cond.MaxFulfillmentLength, 10)
+}
+
+func (cond *attestationCondition) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(attestationTag, derAttestation{Data: cond.Hash[:]})
+}
+
+func (cond *attestationCondition) URI() string {
+	u := encoding.URI{Type: attestationName, Fingerprint: cond.Hash, Cost: attestationCost}
+	return u.String()
+}
+
+func parseAttestationFulfillment(s string) (registry.Fulfillment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 || parts[0] != "cf" || parts[2] != attestationID {
+		return nil, errors.New("not an attestation")
+	}
+
+	statement, err := base64.URLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &attestationFulfillment{Statement: statement}, nil
+}
+
+func parseAttestationCondition(s string) (registry.Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 || parts[0] != "cc" || parts[2] != attestationID {
+		return nil, errors.New("not an attestation")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attestationCondition{Hash: hash, MaxFulfillmentLength: length}, nil
+}
+
+func init() {
+	registry.Register(&registry.Type{
+		ID:             attestationID,
+		Name:           attestationName,
+		DERTag:         attestationTag,
+		FeatureBitmask: features.Sha256,
+
+		Fulfillment: &attestationFulfillment{},
+		Condition:   &attestationCondition{},
+
+		ParseFulfillment: parseAttestationFulfillment,
+		ParseCondition:   parseAttestationCondition,
+		ParseFulfillmentBinary: func(b []byte) (registry.Fulfillment, error) {
+			var der derAttestation
+			if err := encoding.GetChoice(b, attestationTag, &der); err != nil {
+				return nil, err
+			}
+			return &attestationFulfillment{Statement: der.Data}, nil
+		},
+		ParseConditionBinary: func(b []byte) (registry.Condition, error) {
+			var der derAttestation
+			if err := encoding.GetChoice(b, attestationTag, &der); err != nil {
+				return nil, err
+			}
+			cond := &attestationCondition{MaxFulfillmentLength: math.MaxUint64}
+			copy(cond.Hash[:], der.Data)
+			return cond, nil
+		},
+		ParseURI: func(s string) (registry.Condition, error) {
+			u, err := encoding.ParseURI(s)
+			if err != nil {
+				return nil, err
+			}
+			return &attestationCondition{Hash: u.Fingerprint, MaxFulfillmentLength: math.MaxUint64}, nil
+		},
+
+		ConditionOf: func(ful registry.Fulfillment) registry.Condition {
+			return ful.(*attestationFulfillment).condition()
+		},
+		Validate: validateAttestation,
+		// Attestations of attestationWait wait for ctx to be done, to test
+		// cancellation while validating
+		ValidateContext: func(ctx context.Context, ful registry.Fulfillment, cond registry.Condition, message []byte, now time.Time, pool *registry.Pool) error {
+			if !bytes.Equal(ful.(*attestationFulfillment).Statement, attestationWait) {
+				return validateAttestation(ful, cond, message)
+			}
+			select {
+			case attestationWaiting <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Limits: func(cond registry.Condition) (uint64, uint64) {
+			return cond.(*attestationCondition).MaxFulfillmentLength, attestationCost
+		},
+
+		FulfillmentSchema: attestationSchema,
+		ConditionSchema:   attestationSchema,
+	})
+}
+
+var (
+	attestationWait    = []byte("wait")
+	attestationWaiting = make(chan struct{}, 1)
+)
+
+func validateAttestation(ful registry.Fulfillment, cond registry.Condition, message []byte) error {
+	f := ful.(*attestationFulfillment)
+	if f.condition().Hash != cond.(*attestationCondition).Hash {
+		return validation.ErrFingerprintMismatch
+	}
+	if !bytes.Equal(f.Statement, message) {
+		return validation.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	ful := &attestationFulfillment{Statement: []byte("prefix:hello")}
+	cond := ful.condition()
+
+	// The generic parsers dispatch to the registered type
+	parsed, err := CryptoConditions.ParseFulfillment(ful.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, ful) {
+		t.Fatal("fulfillment did not round trip", parsed)
+	}
+
+	b, err := ful.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CryptoConditions.ParseFulfillmentBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CryptoConditions.ParseConditionURI(cond.URI()); err != nil {
+		t.Fatal(err)
+	}
+
+	condString, err := CryptoConditions.FulfillmentToCondition(ful.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condString != cond.Serialize() {
+		t.Fatal("condition incorrect", condString)
+	}
+
+	if err := CryptoConditions.Validate(ful.Serialize(), condString, []byte("prefix:hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.Validate(ful.Serialize(), condString, []byte("hello")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	shaFul := &Sha256.Fulfillment{Preimage: []byte("hello")}
+	shaCond := shaFul.Condition()
+	if err := CryptoConditions.Validate(ful.Serialize(), shaCond.Serialize(), nil); err != validation.ErrTypeMismatch {
+		t.Fatal("expected type mismatch", err)
+	}
+
+	// The registered type can be a subcondition of the compound types, the
+	// prefix being prepended to the message it is validated against
+	prefixFul := &PrefixSha256.Fulfillment{
+		Prefix:           []byte("prefix:"),
+		MaxMessageLength: 16,
+		Subfulfillment:   []byte(ful.Serialize()),
+	}
+	prefixCond := prefixFul.Condition()
+	if err := prefixFul.Validate(&prefixCond, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// which also lets a prefix be a subcondition of a threshold
+	thresholdFul := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(prefixFul.Serialize())},
+			{Weight: 1, String: []byte(shaFul.Serialize())},
+		},
+		SubConditions: ThresholdSha256.WeightedStrings{},
+	}
+	thresholdCond := thresholdFul.Condition()
+	if err := CryptoConditions.Validate(thresholdFul.Serialize(), thresholdCond.Serialize(), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CryptoConditions.Validate(thresholdFul.Serialize(), thresholdCond.Serialize(), []byte("bye")); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for i, typ := range registry.Types() {
+		if i > 0 && registry.Types()[i-1].DERTag >= typ.DERTag {
+			t.Fatal("types not in order of their DER tags")
+		}
+	}
+	if registry.ByID(attestationID).Name != attestationName {
+		t.Fatal("type not found by its ID")
+	}
+}
+
+// Extra keys
+// &[197 198 13 156 213 181 160 15 105 7 66 222 66 15 212 8 172 55 20 47 34 182 117 106 213 203 6 172 119 66 87 170] &[244 9 180 60 13 13 60 215 158 30 236 128 111 107 44 54 75 151 209 13 20 19 58 42 162 147 207 0 189 188 4 136 197 198 13 156 213 181 160 15 105 7 66 222 66 15 212 8 172 55 20 47 34 182 117 106 213 203 6 172 119 66 87 170]
+// &[236 129 33 67 119 101 27 246 101 161 109 184 246 50 2 214 184 162 40 197 194 196 212 210 163 136 39 229 123 204 82 25] &[97 111 164 221 195 25 249 6 17 161 159 191 252 118 241 114 92 113 7 100 234 111 160 131 230 22 181 67 197 183 9 99 236 129 33 67 119 101 27 246 101 161 109 184 246 50 2 214 184 162 40 197 194 196 212 210 163 136 39 229 123 204 82 25]
+// &[118 97 30 186 23 231 51 77 244 88 148 216 9 177 104 120 183 209 212 48 44 133 220 62 24 92 165 7 153 68 194 83] &[117 54 222 53 77 11 219 41 154 161 185 104 208 248 30 59 132 230 116 108 150 60 215 9 221 101 210 53 150 159 129 174 118 97 30 186 23 231 51 77 244 88 148 216 9 177 104 120 183 209 212 48 44 133 220 62 24 92 165 7 153 68 194 83]
+
+func TestBatch(t *testing.T) {
+	// Ten validators, one of which is nested under a threshold and a prefix
+	subs := ThresholdSha256.WeightedStrings{}
+	for i := 0; i < 10; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ful := &Ed25519Sha256.Fulfillment{PublicKey: pub, FixedMessage: []byte{byte(i)}}
+		ful.Sign(priv)
+
+		s := ful.Serialize()
+		if i == 9 {
+			s = (&ThresholdSha256.ThresholdSha256Fulfillment{
+				Threshold:       1,
+				SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(s)}},
+			}).Serialize()
+			s = (&PrefixSha256.Fulfillment{Prefix: []byte{9}, Subfulfillment: []byte(s)}).Serialize()
+		}
+		subs = append(subs, ThresholdSha256.WeightedString{Weight: 1, String: []byte(s)})
+	}
+
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{Threshold: 10, SubFulfillments: subs}
+	thrCond := thrFul.Condition()
+	ful := thrFul.Serialize()
+	cond := thrCond.Serialize()
+
+	b := &batch.Batch{}
+	if err := CryptoConditions.ValidateBatch(ful, cond, nil, b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 10 || len(b.Invalid()) != 0 {
+		t.Fatal("batched", b.Len(), "signatures", b.Invalid())
+	}
+
+	// A forged signature fails alike either way, and the batch tells which
+	forged, err := Ed25519Sha256.ParseFulfillment(string(subs[3].String))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Signature = append([]byte{}, forged.Signature...)
+	forged.Signature[0] ^= 1
+	subs[3].String = []byte(forged.Serialize())
+	ful = thrFul.Serialize()
+
+	if forgedCond := thrFul.Condition(); forgedCond.Serialize() != cond {
+		t.Fatal("condition depends on the signatures")
+	}
+	if err := CryptoConditions.Validate(ful, cond, nil); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+	b = &batch.Batch{}
+	if err := CryptoConditions.ValidateBatch(ful, cond, nil, b); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+	if !reflect.DeepEqual(b.Invalid(), []int{3}) || !bytes.Equal(b.Entries()[3].PublicKey, forged.PublicKey) {
+		t.Fatal("invalid signatures", b.Invalid())
+	}
+
+	v := &CryptoConditions.Verifier{Supported: features.All, Batch: true}
+	if err := v.Validate(ful, cond, nil); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Checks other than the signatures still come first
+	shaCond := (&Sha256.Fulfillment{Preimage: []byte("other")}).Condition()
+	if err := CryptoConditions.ValidateBatch(ful, shaCond.Serialize(), nil, &batch.Batch{}); err != validation.ErrTypeMismatch {
+		t.Fatal("expected type mismatch", err)
+	}
+
+	// Malformed public keys are invalid, not a panic
+	b = &batch.Batch{}
+	b.Add([]byte{1, 2, 3}, []byte("hello"), make([]byte, 64))
+	if err := b.Verify(); err != validation.ErrSignatureInvalid || !reflect.DeepEqual(b.Invalid(), []int{0}) {
+		t.Fatal("expected invalid signature", err)
+	}
+	if err := (&batch.Batch{}).Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Large batches are split in chunks, any of which finds a forgery
+	b = &batch.Batch{}
+	for i := 0; i < 100; i++ {
+		message := []byte{byte(i)}
+		sig := ed25519.Sign(privkey1[:], message)
+		if i == 57 {
+			sig[0] ^= 1
+		}
+		b.Add(pubkey1[:], message, sig)
+	}
+	if err := b.Verify(); err != validation.ErrSignatureInvalid || !reflect.DeepEqual(b.Invalid(), []int{57}) {
+		t.Fatal("expected invalid signature", err, b.Invalid())
+	}
+	b.Entries()[57].Signature[0] ^= 1
+	if err := b.Verify(); err != nil || len(b.Invalid()) != 0 {
+		t.Fatal(err, b.Invalid())
+	}
+
+	// A scalar that isn't reduced is reduced, as ed25519.Verify does
+	message := []byte("hello")
+	sig := ed25519.Sign(privkey1[:], message)
+	order := []byte{
+		0xed, 0xd3, 0xf5, 0x5c, 0x1a, 0x63, 0x12, 0x58, 0xd6, 0x9c, 0xf7, 0xa2, 0xde, 0xf9, 0xde, 0x14,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+	}
+	var carry uint
+	for i := range order {
+		sum := uint(sig[32+i]) + uint(order[i]) + carry
+		sig[32+i], carry = byte(sum), sum>>8
+	}
+	if !ed25519.Verify(pubkey1[:], message, sig) {
+		t.Fatal("unreduced scalar rejected by ed25519.Verify")
+	}
+	b = &batch.Batch{}
+	b.Add(pubkey1[:], message, sig)
+	if err := b.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The equations are multiplied by the cofactor, so they accept an R off
+	// by a small-order point, which ed25519.Verify rejects. The signature is
+	// decided the same whether its chunk holds or not.
+	digest := sha512.Sum512(privkey1[:32])
+	secret := edwards25519.NewScalar().SetBytesWithClamping(digest[:32])
+	nonce := edwards25519.NewScalar().SetUniformBytes(bytes.Repeat([]byte{7}, 64))
+	torsion, err := new(edwards25519.Point).SetBytes(append([]byte{0xec}, append(bytes.Repeat([]byte{0xff}, 30), 0x7f)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	R := new(edwards25519.Point).Add(new(edwards25519.Point).ScalarBaseMult(nonce), torsion)
+	h := sha512.New()
+	h.Write(R.Bytes())
+	h.Write(pubkey1[:])
+	h.Write(message)
+	k := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	sig = append(R.Bytes(), edwards25519.NewScalar().MultiplyAdd(k, secret, nonce).Bytes()...)
+	if ed25519.Verify(pubkey1[:], message, sig) {
+		t.Fatal("small-order R accepted by ed25519.Verify")
+	}
+	b = &batch.Batch{}
+	b.Add(pubkey1[:], message, sig)
+	if err := b.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	bad := ed25519.Sign(privkey1[:], message)
+	bad[0] ^= 1
+	b.Add(pubkey1[:], message, bad)
+	if err := b.Verify(); err != validation.ErrSignatureInvalid || !reflect.DeepEqual(b.Invalid(), []int{1}) {
+		t.Fatal("expected invalid signature", err, b.Invalid())
+	}
+
+	// Its s off by one fails both ways too
+	sig[32]++
+	b = &batch.Batch{}
+	b.Add(pubkey1[:], message, sig)
+	if err := b.Verify(); err != validation.ErrSignatureInvalid || !reflect.DeepEqual(b.Invalid(), []int{0}) {
+		t.Fatal("expected invalid signature", err, b.Invalid())
+	}
+	b.Add(pubkey1[:], message, ed25519.Sign(privkey1[:], message))
+	if err := b.Verify(); err != validation.ErrSignatureInvalid || !reflect.DeepEqual(b.Invalid(), []int{0}) {
+		t.Fatal("expected invalid signature", err, b.Invalid())
+	}
+}
+
+func TestValidateContext(t *testing.T) {
+	signed := func(i int) []byte {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ful := &Ed25519Sha256.Fulfillment{PublicKey: pub, FixedMessage: []byte{byte(i)}}
+		ful.Sign(priv)
+		return []byte(ful.Serialize())
+	}
+
+	// A nested threshold under a prefix, among twenty validators
+	nested := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: signed(0)}, {Weight: 1, String: signed(1)}},
+	}
+	prefixed := &PrefixSha256.Fulfillment{Prefix: []byte{1}, Subfulfillment: []byte(nested.Serialize())}
+
+	subs := ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(prefixed.Serialize())}}
+	for i := 0; i < 20; i++ {
+		subs = append(subs, ThresholdSha256.WeightedString{Weight: 1, String: signed(i)})
+	}
+	thrFul := &ThresholdSha256.ThresholdSha256Fulfillment{Threshold: 21, SubFulfillments: subs}
+	thrCond := thrFul.Condition()
+	ful := thrFul.Serialize()
+	cond := thrCond.Serialize()
+
+	ctx := context.Background()
+	for _, workers := range []int{0, 1, 4, 64} {
+		if err := CryptoConditions.ValidateContext(ctx, ful, cond, nil, workers); err != nil {
+			t.Fatal(workers, "workers:", err)
+		}
+	}
+
+	// An invalid subfulfillment at any depth invalidates the whole
+	forged, err := Ed25519Sha256.ParseFulfillment(string(nested.SubFulfillments[1].String))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Signature = append([]byte{}, forged.Signature...)
+	forged.Signature[0] ^= 1
+	nested.SubFulfillments[1].String = []byte(forged.Serialize())
+	prefixed.Subfulfillment = []byte(nested.Serialize())
+	subs[0].String = []byte(prefixed.Serialize())
+	if err := CryptoConditions.ValidateContext(ctx, thrFul.Serialize(), cond, nil, 4); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+	if err := CryptoConditions.Validate(thrFul.Serialize(), cond, nil); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Weights that can't reach the threshold fail before any verification
+	shaCond := (&Sha256.Fulfillment{Preimage: []byte{1}}).Condition()
+	partial := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold:       3,
+		SubFulfillments: ThresholdSha256.WeightedStrings{{Weight: 1, String: signed(0)}, {Weight: 1, String: signed(1)}},
+		SubConditions:   ThresholdSha256.WeightedStrings{{Weight: 1, String: []byte(shaCond.Serialize())}},
+	}
+	partialCond := partial.Condition()
+	if err := CryptoConditions.ValidateContext(ctx, partial.Serialize(), partialCond.Serialize(), nil, 4); err != validation.ErrThresholdNotReached {
+		t.Fatal("expected threshold not reached", err)
+	}
+
+	// Validation stops once the threshold is reached, so a subfulfillment
+	// beyond it isn't validated, and needn't be valid
+	preimage := &Sha256.Fulfillment{Preimage: []byte{1}}
+	waiting := &attestationFulfillment{Statement: attestationWait}
+	reached := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 1,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(preimage.Serialize())},
+			{Weight: 1, String: []byte(waiting.Serialize())},
+		},
+	}
+	reachedCond := reached.Condition()
+	for _, workers := range []int{1, 4} {
+		if err := CryptoConditions.ValidateContext(ctx, reached.Serialize(), reachedCond.Serialize(), nil, workers); err != nil {
+			t.Fatal(workers, "workers:", err)
+		}
+	}
+	if err := CryptoConditions.Validate(reached.Serialize(), reachedCond.Serialize(), nil); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// Cancellation while validating returns promptly
+	waitingAll := &ThresholdSha256.ThresholdSha256Fulfillment{
+		Threshold: 2,
+		SubFulfillments: ThresholdSha256.WeightedStrings{
+			{Weight: 1, String: []byte(waiting.Serialize())},
+			{Weight: 1, String: []byte(waiting.Serialize())},
+		},
+	}
+	waitingCond := waitingAll.Condition()
+	select {
+	case <-attestationWaiting:
+	default:
+	}
+	running, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- CryptoConditions.ValidateContext(running, waitingAll.Serialize(), waitingCond.Serialize(), nil, 4)
+	}()
+	<-attestationWaiting
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatal("expected cancellation", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation didn't return once canceled")
+	}
+
+	// Cancellation
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := CryptoConditions.ValidateContext(canceled, ful, cond, nil, 4); err != context.Canceled {
+		t.Fatal("expected cancellation", err)
+	}
+	expired, cancel := context.WithTimeout(ctx, -time.Second)
+	defer cancel()
+	if err := CryptoConditions.ValidateContext(expired, ful, cond, nil, 4); err != context.DeadlineExceeded {
+		t.Fatal("expected deadline exceeded", err)
+	}
+}
+
+func TestRfc(t *testing.T) {
+	fromHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// RFC 8032 test 1, signing the empty message
+	edKey := fromHex("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+	edSig := fromHex("e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b")
+
+	// Test vectors of the crypto-conditions spec
+	for _, test := range []struct {
+		ful         Rfc.Fulfillment
+		fulfillment string
+		condition   string
+		uri         string
+	}{
+		{
+			ful:         &Rfc.PreimageFulfillment{Preimage: []byte{}},
+			fulfillment: "A0028000",
+			condition:   "A0258020E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855810100",
+			uri:         "ni:///sha-256;47DEQpj8HBSa-_TImW-5JCeuQeRkm5NMpJWZG3hSuFU?fpt=preimage-sha-256&cost=0",
+		},
+		{
+			ful:         &Rfc.PrefixFulfillment{Prefix: []byte{}, Subfulfillment: &Rfc.PreimageFulfillment{Preimage: []byte{}}},
+			fulfillment: "A10B8000810100A204A0028000",
+			condition:   "A12A8020BB1AC5260C0141B7E54B26EC2330637C5597BF811951AC09E744AD20FF77E2878102040082020780",
+			uri:         "ni:///sha-256;uxrFJgwBQbflSybsIzBjfFWXv4EZUawJ50StIP934oc?fpt=prefix-sha-256&cost=1024&subtypes=preimage-sha-256",
+		},
+		{
+			ful:         &Rfc.ThresholdFulfillment{SubFulfillments: []Rfc.Fulfillment{&Rfc.PreimageFulfillment{Preimage: []byte{}}}},
+			fulfillment: "A208A004A0028000A100",
+			condition:   "A22A8020B4B84136DF48A71D73F4985C04C6767A778ECB65BA7023B4506823BEEE7631B98102040082020780",
+			uri:         "ni:///sha-256;tLhBNt9Ipx1z9JhcBMZ2eneOy2W6cCO0UGgjvu52Mbk?fpt=threshold-sha-256&cost=1024&subtypes=preimage-sha-256",
+		},
+		{
+			ful:         &Rfc.Ed25519Fulfillment{PublicKey: edKey, Signature: edSig},
+			fulfillment: "A4648020" + strings.ToUpper(hex.EncodeToString(edKey)) + "8140" + strings.ToUpper(hex.EncodeToString(edSig)),
+			condition:   "A4278020799239ABA8FC4FF7EABFBC4C44E69E8BDFED993324E12ED64792ABE289CF1D5F8103020000",
+			uri:         "ni:///sha-256;eZI5q6j8T_fqv7xMROaei9_tmTMk4S7WR5Kr4onPHV8?fpt=ed25519-sha-256&cost=131072",
+		},
+	} {
+		b, err := test.ful.SerializeBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.ToUpper(hex.EncodeToString(b)) != test.fulfillment {
+			t.Fatalf("fulfillment incorrect: %X", b)
+		}
+
+		parsed, err := Rfc.ParseFulfillmentBinary(fromHex(test.fulfillment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed, test.ful) {
+			t.Fatal("fulfillment did not round trip", test.fulfillment)
+		}
+
+		cond := Rfc.ConditionOf(parsed)
+		b, err = cond.SerializeBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.ToUpper(hex.EncodeToString(b)) != test.condition {
+			t.Fatalf("condition incorrect: %X", b)
+		}
+		if cond.URI() != test.uri || cond.Serialize() != test.uri {
+			t.Fatal("condition URI incorrect", cond.URI())
+		}
+
+		fromURI, err := Rfc.ParseURI(test.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fromURI, cond) {
+			t.Fatal("condition did not round trip through its URI", test.uri)
+		}
+
+		if err := Rfc.Validate(fromHex(test.fulfillment), fromHex(test.condition), []byte{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ed25519 signs the message itself, prefixed by a prefix fulfillment
+	edFul := &Rfc.Ed25519Fulfillment{PublicKey: edKey, Signature: edSig}
+	edCond := edFul.Condition()
+	if err := edFul.Validate(&edCond, []byte("x")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	signed := &Rfc.Ed25519Fulfillment{}
+	signed.Sign(privkey1[:], []byte("prefix:hello"))
+	prefixFul := &Rfc.PrefixFulfillment{Prefix: []byte("prefix:"), MaxMessageLength: 5, Subfulfillment: signed}
+	prefixCond := prefixFul.Condition()
+	if err := prefixFul.Validate(&prefixCond, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := prefixFul.Validate(&prefixCond, []byte("hello!")); err != validation.ErrMessageTooLong {
+		t.Fatal("expected message too long", err)
+	}
+
+	// A threshold of a signature and an RSA signature, over an unfulfilled
+	// preimage and prefix
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFul := &Rfc.RsaFulfillment{}
+	if err := rsaFul.Sign(rsaKey, []byte("prefix:hello")); err != nil {
+		t.Fatal(err)
+	}
+	if rsaFul.Condition().Cost != 256*256 {
+		t.Fatal("RSA cost incorrect", rsaFul.Condition().Cost)
+	}
+
+	preimageCond := (&Rfc.PreimageFulfillment{Preimage: []byte("secret")}).Condition()
+	thrFul := &Rfc.ThresholdFulfillment{
+		SubFulfillments: []Rfc.Fulfillment{signed, rsaFul},
+		SubConditions:   []Rfc.Condition{&preimageCond, &prefixCond},
+	}
+	thrCond := thrFul.Condition()
+	if !strings.HasSuffix(thrCond.URI(), "&subtypes=preimage-sha-256,prefix-sha-256,rsa-sha-256,ed25519-sha-256") {
+		t.Fatal("threshold subtypes incorrect", thrCond.URI())
+	}
+	// The two most expensive subconditions, plus 1024 for each
+	if want := prefixCond.Cost + 131072 + 4*1024; thrCond.Cost != want {
+		t.Fatal("threshold cost incorrect", thrCond.Cost, want)
+	}
+	if suites := Rfc.Features(thrFul); suites != features.Sha256|features.Preimage|features.Prefix|features.Threshold|features.RsaPss|features.Ed25519 {
+		t.Fatal("threshold feature suites incorrect", suites)
+	}
+
+	b, err := thrFul.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := thrCond.SerializeBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rfc.Validate(b, c, []byte("prefix:hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rfc.Validate(b, c, []byte("prefix:hellO")); err != validation.ErrSignatureInvalid {
+		t.Fatal("expected invalid signature", err)
+	}
+
+	// The SETs are ordered however the children are
+	reordered := &Rfc.ThresholdFulfillment{
+		SubFulfillments: []Rfc.Fulfillment{rsaFul, signed},
+		SubConditions:   []Rfc.Condition{&prefixCond, &preimageCond},
+	}
+	if reordered.Condition() != thrCond {
+		t.Fatal("threshold condition depends on the order of its children")
+	}
+	if b2, _ := reordered.SerializeBinary(); !bytes.Equal(b2, b) {
+		t.Fatal("threshold fulfillment depends on the order of its children")
+	}
+
+	parsed, err := Rfc.ParseFulfillmentBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batched batch.Batch
+	if err := parsed.(*Rfc.ThresholdFulfillment).ValidateBatch(&thrCond, []byte("prefix:hello"), &batched); err != nil {
+		t.Fatal(err)
+	}
+	if batched.Len() != 1 {
+		t.Fatal("Ed25519 signature not batched", batched.Len())
+	}
+	if err := batched.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The threshold is the number of subfulfillments
+	empty := &Rfc.ThresholdFulfillment{SubConditions: []Rfc.Condition{&preimageCond}}
+	emptyCond := empty.Condition()
+	if err := empty.Validate(&emptyCond, nil); err != validation.ErrThresholdNotReached {
+		t.Fatal("expected threshold not reached", err)
+	}
+
+	for _, b := range []string{
+		// A condition with a maxFulfillmentLength, as the string format's
+		"A0288020E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855810100820100",
+		// A compound condition without its subtypes
+		"A1258020BB1AC5260C0141B7E54B26EC2330637C5597BF811951AC09E744AD20FF77E287810204",
+		// Subtypes listing its own type
+		"A12A8020BB1AC5260C0141B7E54B26EC2330637C5597BF811951AC09E744AD20FF77E2878102040082020640",
+		// Subtypes listing a type outside the spec
+		"A12A8020BB1AC5260C0141B7E54B26EC2330637C5597BF811951AC09E744AD20FF77E2878102040082020080",
+	} {
+		if _, err := Rfc.ParseConditionBinary(fromHex(b)); err == nil {
+			t.Fatal("condition parsed", b)
+		}
+	}
+
+	for _, b := range []string{
+		// Subfulfillments out of DER order
+		"A20EA00AA003800162A003800161A100",
+		// A legacy preimage under the spec's prefix
+		"A10D8000810100A206A8048002" + "6869",
+		// Ed25519 public key too short
+		"A463801F" + strings.Repeat("00", 31) + "8140" + strings.Repeat("00", 64),
+	} {
+		if _, err := Rfc.ParseFulfillmentBinary(fromHex(b)); err == nil {
+			t.Fatal("fulfillment parsed", b)
+		}
+	}
+}
@@ -1,10 +1,20 @@
+// Generates and parses Threshold-Sha256 Crypto Conditions
 package ThresholdSha256
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
 
+	"crypto-conditions/batch"
 	"crypto-conditions/encoding"
+	"crypto-conditions/registry"
+	"crypto-conditions/validation"
 )
 
 type WeightedString struct {
@@ -15,19 +25,36 @@ type WeightedString struct {
 type WeightedStrings []WeightedString
 
 func ParseWeightedStrings(b []byte) (WeightedStrings, error) {
-	bs := encoding.ParseVarray(b)
+	return readWeightedStrings(encoding.NewReader(bytes.NewReader(b), uint64(len(b))))
+}
+
+// Reads WeightedStrings out of a Varray of weight-prefixed Varbytes, until the
+// Reader is done. Anything following the Varbyte in an item is skipped.
+func readWeightedStrings(r *encoding.Reader) (WeightedStrings, error) {
 	ws := WeightedStrings{}
 
-	for _, b := range bs {
-		w, b, err := encoding.GetUvarint(b)
+	for r.Remaining() > 0 {
+		item, err := r.VarbyteReader()
 		if err != nil {
 			return nil, err
 		}
 
-		s, _, err := encoding.GetVarbyte(b)
+		w, err := item.ReadUvarint()
 		if err != nil {
 			return nil, err
 		}
+		if w > math.MaxUint32 {
+			return nil, errors.New("weight out of range")
+		}
+
+		s, err := item.ReadVarbyte()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := item.Skip(); err != nil {
+			return nil, err
+		}
 
 		ws = append(ws, WeightedString{
 			Weight: uint32(w),
@@ -41,6 +68,11 @@ func ParseWeightedStrings(b []byte) (WeightedStrings, error) {
 func (a WeightedStrings) Len() int      { return len(a) }
 func (a WeightedStrings) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a WeightedStrings) Less(i, j int) bool {
+	// Sort by weight if the strings are equal
+	if bytes.Equal(a[i].String, a[j].String) {
+		return a[i].Weight < a[j].Weight
+	}
+
 	// Sort lexicographically if the lengths are equal
 	if len(a[i].String) == len(a[j].String) {
 		return string(a[i].String) < string(a[j].String)
@@ -50,49 +82,139 @@ func (a WeightedStrings) Less(i, j int) bool {
 	return len(a[i].String) < len(a[j].String)
 }
 
-func (wss *WeightedStrings) WriteTo(b []byte) {
-	i := 0
-	for _, ws := range *wss {
-		// write weight
-		i = binary.PutUvarint(b[i:], uint64(ws.Weight))
-		// prefix length
-		i = binary.PutUvarint(b[i:], uint64(len(ws.String)))
-		// write fulfillment or condition
-		b = append(b[i:], ws.String...)
-	}
+// Bytes encodes the WeightedStrings as a Varray of weight-prefixed Varbytes,
+// the inverse of ParseWeightedStrings.
+func (a WeightedStrings) Bytes() []byte {
+	var b bytes.Buffer
+	a.write(encoding.NewWriter(&b))
+	return b.Bytes()
 }
 
-func ParseFulfillment(b []byte) (uint16, []byte, error) {
-	typ, b, err := encoding.GetUvarint(b)
-	if err != nil {
-		return 0, []byte{}, err
+// Length of an item of the Varray of the WeightedString
+func (ws WeightedString) length() uint64 {
+	return encoding.UvarintLength(uint64(ws.Weight)) + encoding.VarbyteLength(uint64(len(ws.String)))
+}
+
+// Length of the Varray of weight-prefixed Varbytes
+func (a WeightedStrings) length() uint64 {
+	var length uint64
+	for _, ws := range a {
+		length += encoding.VarbyteLength(ws.length())
 	}
+	return length
+}
 
-	payload, b, err := encoding.GetVarbyte(b)
-	if err != nil {
-		return 0, []byte{}, err
+// Writes the Varray of weight-prefixed Varbytes, one item at a time.
+func (a WeightedStrings) write(w *encoding.Writer) error {
+	for _, ws := range a {
+		w.WriteUvarint(ws.length())
+		w.WriteUvarint(uint64(ws.Weight))
+		w.WriteVarbyte(ws.String)
 	}
 
-	return uint16(typ), payload, nil
+	return w.Err()
 }
 
+// Writes the Varbyte holding the Varray of weight-prefixed Varbytes.
+func (a WeightedStrings) writeVarbyte(w *encoding.Writer) error {
+	w.WriteUvarint(a.length())
+	return a.write(w)
+}
+
+// Appends the Varbyte holding the Varray of weight-prefixed Varbytes.
+func (a WeightedStrings) appendVarbyte(b *encoding.Base64Appender) {
+	b.AppendUvarint(a.length())
+	for _, ws := range a {
+		b.AppendUvarint(ws.length())
+		b.AppendUvarint(uint64(ws.Weight))
+		b.AppendVarbyte(ws.String)
+	}
+}
+
+// ThresholdSha256Fulfillment is fulfilled once the weights of its valid
+// SubFulfillments add up to Threshold. Each SubFulfillment holds the string
+// form ("cf:...") of a fulfillment of any registered type. Subconditions that
+// are not fulfilled are listed in SubConditions in their string form
+// ("cc:...") instead, so that the fingerprint can be reproduced.
 type ThresholdSha256Fulfillment struct {
 	Threshold       uint32
 	SubFulfillments WeightedStrings
+	SubConditions   WeightedStrings
+}
+
+// Parses Fulfillment out of the Crypto Conditions string format.
+func ParseFulfillment(s string) (*ThresholdSha256Fulfillment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cf" {
+		return nil, errors.New("fulfillments must start with \"cf\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "4" {
+		return nil, errors.New("not a ThresholdSha256 condition")
+	}
+
+	payload, err := base64.URLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.New("parsing error")
+	}
+
+	return ParseThresholdSha256Fulfillment(payload)
 }
 
+// Parses Fulfillment out of the binary payload of the Crypto Conditions
+// string format.
 func ParseThresholdSha256Fulfillment(payload []byte) (*ThresholdSha256Fulfillment, error) {
-	threshold, b, err := encoding.GetUvarint(payload)
+	r := encoding.NewReader(bytes.NewReader(payload), uint64(len(payload)))
+
+	ful, err := ReadFulfillment(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Remaining() != 0 {
+		return nil, errors.New("parsing error")
+	}
+
+	return ful, nil
+}
+
+// Reads Fulfillment out of the binary payload of the Crypto Conditions string
+// format, one subfulfillment or subcondition at a time, so that large
+// thresholds can be read from a stream without buffering the payload.
+// Nothing is read past the payload.
+func ReadFulfillment(r *encoding.Reader) (*ThresholdSha256Fulfillment, error) {
+	threshold, err := r.ReadUvarint()
 	if err != nil {
 		return nil, err
 	}
+	if threshold > math.MaxUint32 {
+		return nil, errors.New("threshold out of range")
+	}
 
-	f, b, err := encoding.GetVarbyte(b)
+	f, err := r.VarbyteReader()
 	if err != nil {
 		return nil, err
 	}
 
-	subFulfillments, err := ParseWeightedStrings(f)
+	subFulfillments, err := readWeightedStrings(f)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.VarbyteReader()
+	if err != nil {
+		return nil, err
+	}
+
+	subConditions, err := readWeightedStrings(c)
 	if err != nil {
 		return nil, err
 	}
@@ -100,84 +222,276 @@ func ParseThresholdSha256Fulfillment(payload []byte) (*ThresholdSha256Fulfillmen
 	ful := &ThresholdSha256Fulfillment{
 		Threshold:       uint32(threshold),
 		SubFulfillments: subFulfillments,
+		SubConditions:   subConditions,
 	}
 
 	return ful, nil
 }
 
-func (ful *ThresholdSha256Fulfillment) Serialize() []byte {
-	b := []byte{}
+// Writes the binary payload of the Crypto Conditions string format, one
+// subfulfillment or subcondition at a time.
+func (ful *ThresholdSha256Fulfillment) WritePayload(w *encoding.Writer) error {
+	w.WriteUvarint(uint64(ful.Threshold))
+	ful.SubFulfillments.writeVarbyte(w)
+	ful.SubConditions.writeVarbyte(w)
 
-	// write threshold
-	i := binary.PutUvarint(b, uint64(ful.Threshold))
+	return w.Err()
+}
 
-	// write subfulfillments
-	ful.SubFulfillments.WriteTo(b[i:])
+// Serializes to the Crypto Conditions Fulfillment string format.
+func (ful *ThresholdSha256Fulfillment) Serialize() string {
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
 
-	return b
+// Appends the Crypto Conditions Fulfillment string format to dst, without
+// allocating if dst has room for SerializedLength more bytes.
+func (ful *ThresholdSha256Fulfillment) AppendSerialize(dst []byte) []byte {
+	a := encoding.NewBase64Appender(append(dst, "cf:1:4:"...))
+	a.AppendUvarint(uint64(ful.Threshold))
+	ful.SubFulfillments.appendVarbyte(&a)
+	ful.SubConditions.appendVarbyte(&a)
+	return a.Finish()
 }
 
-func Validate(fulfillment []byte, message []byte) error {
-	typ, payload, err := ParseFulfillment(fulfillment)
+// Returns the length of the Crypto Conditions Fulfillment string format.
+func (ful *ThresholdSha256Fulfillment) SerializedLength() int {
+	payload := encoding.UvarintLength(uint64(ful.Threshold)) +
+		encoding.VarbyteLength(ful.SubFulfillments.length()) +
+		encoding.VarbyteLength(ful.SubConditions.length())
+
+	return len("cf:1:4:") + int(encoding.Base64Length(payload))
+}
+
+// Checks that a subfulfillment of any registered type, given in the Crypto
+// Conditions string format, is valid on its own at the time now. With a
+// Batch, its Ed25519 signatures are added to it rather than verified.
+// Signatures are verified by its validation rather than while parsing.
+func validateSubfulfillment(fulfillment []byte, message []byte, now time.Time, b *batch.Batch) error {
+	ful, err := registry.ParseFulfillmentUnverified(string(fulfillment))
 	if err != nil {
 		return err
 	}
-	switch typ {
-	case 2:
-		err := ThresholdSha256Validate(payload, message)
-		if err != nil {
-			return err
-		}
-		return nil
-	case 4:
-		err := Ed25519Validate(payload, message)
-		if err != nil {
-			return err
-		}
-		return nil
-	default:
-		return errors.New("Unrecognized fulfillment type")
+
+	cond, err := registry.ConditionOf(ful)
+	if err != nil {
+		return err
 	}
+
+	if b == nil {
+		return registry.ValidateAt(ful, cond, message, now)
+	}
+
+	return registry.ValidateBatch(ful, cond, message, now, b)
 }
 
-func ThresholdSha256Validate(payload []byte, message []byte) error {
-	ful, err := ParseThresholdSha256Fulfillment(payload)
+// Checks that a subfulfillment of any registered type, given in the Crypto
+// Conditions string format, is valid on its own at the time now, passing ctx
+// and pool on to it.
+func validateSubfulfillmentContext(ctx context.Context, fulfillment []byte, message []byte, now time.Time, pool *registry.Pool) error {
+	ful, err := registry.ParseFulfillmentUnverified(string(fulfillment))
 	if err != nil {
 		return err
 	}
 
-	var fulfilled uint32
+	cond, err := registry.ConditionOf(ful)
+	if err != nil {
+		return err
+	}
+
+	return registry.ValidateContext(ctx, ful, cond, message, now, pool)
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition: it must match
+// the Condition's fingerprint, MaxFulfillmentLength and Cost, and the weights of its
+// SubFulfillments, each of which must be valid, must reach the Threshold.
+// SubConditions don't count towards the Threshold. The message is passed on to
+// the SubFulfillments, which are validated at the current time.
+func (ful *ThresholdSha256Fulfillment) Validate(cond *Condition, message []byte) error {
+	return ful.validate(cond, message, time.Now(), nil)
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition as Validate
+// does, but at the time now, which is passed on to the SubFulfillments.
+func (ful *ThresholdSha256Fulfillment) ValidateAt(cond *Condition, message []byte, now time.Time) error {
+	return ful.validate(cond, message, now, nil)
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition as ValidateAt
+// does, but adds the Ed25519 signatures of the SubFulfillments, at any depth,
+// to b instead of verifying them. The Fulfillment is only valid once b.Verify
+// succeeds too.
+func (ful *ThresholdSha256Fulfillment) ValidateBatch(cond *Condition, message []byte, now time.Time, b *batch.Batch) error {
+	return ful.validate(cond, message, now, b)
+}
+
+func (ful *ThresholdSha256Fulfillment) validate(cond *Condition, message []byte, now time.Time, b *batch.Batch) error {
+	if err := ful.check(cond); err != nil {
+		return err
+	}
+
+	var fulfilled uint64
 
 	for _, sf := range ful.SubFulfillments {
-		err := Validate(sf.String, message)
+		err := validateSubfulfillment(sf.String, message, now, b)
 		if err != nil {
 			return err
 		}
-		fulfilled += sf.Weight
+		fulfilled += uint64(sf.Weight)
 	}
 
-	if fulfilled < ful.Threshold {
-		return errors.New("Not enough fulfillments")
+	if fulfilled < uint64(ful.Threshold) {
+		return validation.ErrThresholdNotReached
 	}
 
 	return nil
 }
 
-func (ful *ThresholdSha256Fulfillment) Condition() Condition {
-	subconditions := make(WeightedStrings, len(ful.SubFulfillments))
-	for i, sf := range ful.SubFulfillments {
-		subconditions[i] = WeightedString{
-			Weight: sf.Weight,
-			String: sf.String,
+// Checks that an in-memory Fulfillment satisfies the Condition as ValidateAt
+// does, but validates the SubFulfillments concurrently on the goroutines of
+// pool, and those of compound SubFulfillments likewise. Validation stops as
+// soon as the weights of the valid SubFulfillments reach the Threshold, or
+// those of the ones left can't reach it anymore, in which case the error of
+// the invalid SubFulfillment that decided it is returned. Unlike ValidateAt,
+// it doesn't require the SubFulfillments beyond the Threshold to be valid. It
+// fails before verifying any if their weights can't reach the Threshold, and
+// returns ctx.Err() once ctx is done.
+func (ful *ThresholdSha256Fulfillment) ValidateContext(ctx context.Context, cond *Condition, message []byte, now time.Time, pool *registry.Pool) error {
+	if err := ful.check(cond); err != nil {
+		return err
+	}
+
+	threshold := uint64(ful.Threshold)
+
+	// Weights of the SubFulfillments found valid, and of those not found
+	// invalid
+	var fulfilled, reachable uint64
+	for _, sf := range ful.SubFulfillments {
+		reachable += uint64(sf.Weight)
+	}
+
+	if reachable < threshold {
+		return validation.ErrThresholdNotReached
+	}
+
+	if threshold == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var decided bool
+	var result error
+
+	for _, sf := range ful.SubFulfillments {
+		if ctx.Err() != nil {
+			break
 		}
+
+		sf := sf
+		pool.Go(&wg, func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			err := validateSubfulfillmentContext(ctx, sf.String, message, now, pool)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// Once decided or canceled, the others' results don't matter
+			if decided || ctx.Err() != nil {
+				return
+			}
+
+			if err == nil {
+				fulfilled += uint64(sf.Weight)
+			} else {
+				reachable -= uint64(sf.Weight)
+			}
+
+			// Only a valid SubFulfillment can reach the Threshold, and only
+			// an invalid one can make it unreachable
+			if fulfilled >= threshold || reachable < threshold {
+				decided = true
+				result = err
+				cancel()
+			}
+		})
 	}
 
-	// Still need to sort
+	wg.Wait()
 
-	return Condition{
-		Type:           2,
-		FeatureBitmask: []byte{0x09},
-		// Fingerprint:          sha256.Sum256()[:],
-		MaxFulfillmentLength: 96,
+	if decided {
+		return result
 	}
+
+	return ctx.Err()
+}
+
+// Checks the Fulfillment against the Condition's fingerprint,
+// MaxFulfillmentLength and Cost.
+func (ful *ThresholdSha256Fulfillment) check(cond *Condition) error {
+	derived := ful.Condition()
+	if !bytes.Equal(derived.Fingerprint, cond.Fingerprint) {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if uint64(ful.SerializedLength()) > cond.MaxFulfillmentLength {
+		return validation.ErrFulfillmentTooLong
+	}
+
+	if derived.Cost > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	return nil
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
+
+// Turns an in-memory Fulfillment to an in-memory Condition. The fingerprint
+// commits to the Threshold and the sorted, weighted subconditions, whether
+// fulfilled or not, less their MaxFulfillmentLength, and the
+// MaxFulfillmentLength is that of a fulfillment in which every subcondition is
+// fulfilled at its own maximum length.
+func (ful *ThresholdSha256Fulfillment) Condition() Condition {
+	subconditions := []subcondition{}
+
+	for _, sf := range ful.SubFulfillments {
+		subconditions = append(subconditions, parseSubfulfillment(sf.Weight, sf.String))
+	}
+
+	for _, sc := range ful.SubConditions {
+		subconditions = append(subconditions, parseSubcondition(sc.Weight, sc.String))
+	}
+
+	return makeCondition(ful.Threshold, subconditions)
+}
+
+func FulfillmentToCondition(s string) (string, error) {
+	ful, err := ParseFulfillment(s)
+	if err != nil {
+		return "", err
+	}
+
+	cond := ful.Condition()
+
+	condString := cond.Serialize()
+	return condString, nil
 }
@@ -0,0 +1,147 @@
+package ThresholdSha256
+
+import (
+	"errors"
+	"sort"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Most weights the builder keeps a best selection for at once, so that the
+// work and memory of BuildFulfillment stay bounded whatever the weights.
+const maxSelections = 1 << 16
+
+// ErrTooManyWeights is returned by BuildFulfillment when the fulfillments'
+// weights add up to more than maxSelections different weights below the
+// Threshold, even once normalised.
+var ErrTooManyWeights = errors.New("too many distinct weights to build the smallest fulfillment")
+
+// A set of chosen fulfillments, kept as a linked list so that selections
+// can share their common prefix.
+type selection struct {
+	// Bytes saved or, if negative, added by writing the chosen
+	// fulfillments instead of their conditions
+	cost  int64
+	index int
+	prev  *selection
+}
+
+// Builds the smallest threshold fulfillment out of the available
+// subfulfillments and the conditions of the remaining subconditions. Out of
+// the fulfillments whose weights reach the Threshold, it keeps the subset
+// that serializes to the fewest bytes and lists the others by their
+// conditions. Fulfillments that are shorter than their condition are always
+// kept. Weights are divided by their greatest common divisor with the
+// Threshold first, and ErrTooManyWeights is returned if they still add up to
+// too many different weights to compare the selections reaching each.
+func BuildFulfillment(threshold uint32, fulfillments WeightedStrings, conditions WeightedStrings) (*ThresholdSha256Fulfillment, error) {
+	fulConditions := make([][]byte, len(fulfillments))
+	for i, sf := range fulfillments {
+		cond, err := conditionOf(sf.String)
+		if err != nil {
+			return nil, err
+		}
+		fulConditions[i] = cond
+	}
+
+	// Weights past the threshold count as the threshold, and scaling all of
+	// them and the threshold alike doesn't change which selections reach it
+	weightOf := make([]uint64, len(fulfillments))
+	divisor := uint64(threshold)
+	for i, sf := range fulfillments {
+		weightOf[i] = uint64(sf.Weight)
+		if weightOf[i] > uint64(threshold) {
+			weightOf[i] = uint64(threshold)
+		}
+		divisor = gcd(divisor, weightOf[i])
+	}
+	if divisor == 0 {
+		divisor = 1
+	}
+	target := uint64(threshold) / divisor
+	for i := range weightOf {
+		weightOf[i] /= divisor
+	}
+
+	// Best selection for each weight reached so far, with weights capped at
+	// the threshold
+	best := map[uint64]*selection{0: {index: -1}}
+
+	for i, sf := range fulfillments {
+		cost := int64(encoding.VarbyteLength(uint64(len(sf.String)))) - int64(encoding.VarbyteLength(uint64(len(fulConditions[i]))))
+
+		weights := make([]uint64, 0, len(best))
+		for w := range best {
+			weights = append(weights, w)
+		}
+		// Visit weights in order so that ties are broken the same way every time
+		sort.Slice(weights, func(a, b int) bool { return weights[a] < weights[b] })
+
+		next := make(map[uint64]*selection, len(best))
+		for w, sel := range best {
+			next[w] = sel
+		}
+
+		for _, w := range weights {
+			sel := best[w]
+			reached := w + weightOf[i]
+			if reached > target {
+				reached = target
+			}
+
+			candidate := &selection{
+				cost:  sel.cost + cost,
+				index: i,
+				prev:  sel,
+			}
+			if current, ok := next[reached]; !ok || candidate.cost < current.cost {
+				next[reached] = candidate
+			}
+		}
+
+		if len(next) > maxSelections {
+			return nil, ErrTooManyWeights
+		}
+
+		best = next
+	}
+
+	sel, ok := best[target]
+	if !ok {
+		return nil, validation.ErrThresholdNotReached
+	}
+
+	chosen := make([]bool, len(fulfillments))
+	for ; sel.index >= 0; sel = sel.prev {
+		chosen[sel.index] = true
+	}
+
+	ful := &ThresholdSha256Fulfillment{
+		Threshold:       threshold,
+		SubFulfillments: WeightedStrings{},
+		SubConditions:   WeightedStrings{},
+	}
+
+	for i, sf := range fulfillments {
+		if chosen[i] {
+			ful.SubFulfillments = append(ful.SubFulfillments, sf)
+		} else {
+			ful.SubConditions = append(ful.SubConditions, WeightedString{
+				Weight: sf.Weight,
+				String: fulConditions[i],
+			})
+		}
+	}
+
+	ful.SubConditions = append(ful.SubConditions, conditions...)
+
+	return ful, nil
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
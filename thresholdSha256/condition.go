@@ -0,0 +1,319 @@
+package ThresholdSha256
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/registry"
+)
+
+// Feature suites of threshold conditions themselves, to which those of their
+// subconditions are added
+const featureBitmask = features.Sha256 | features.Threshold
+
+// The Cost of a threshold condition can't be read from the Crypto Conditions
+// string format, so conditions parsed from it have the largest uint64 as their
+// Cost, which stands for an unbounded cost. Conditions parsed from the
+// named-information URI format likewise have no MaxFulfillmentLength. Nor
+// does the string format have room for the Subtypes, which only Conditions
+// derived from a fulfillment or parsed from the other formats know.
+type Condition struct {
+	Type                 uint16
+	FeatureBitmask       []byte
+	Fingerprint          []byte
+	MaxFulfillmentLength uint64
+	Cost                 uint64
+	subtypes             registry.TypeSet
+}
+
+// Returns the types of the subconditions, and of theirs in turn, except
+// ThresholdSha256 itself.
+func (cond *Condition) Subtypes() registry.TypeSet {
+	return cond.subtypes
+}
+
+// Set of ThresholdSha256 itself, which is left out of its Subtypes
+const ownType registry.TypeSet = 1 << derTag
+
+// Cost added for each subcondition of a threshold, as in the crypto-conditions spec
+const subconditionCost = 1024
+
+// Serializes to the Crypto Conditions string format.
+func (cond *Condition) Serialize() string {
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	return encoding.AppendCondition(dst, strconv.FormatUint(uint64(cond.Type), 10), cond.Fingerprint, cond.MaxFulfillmentLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return len("cc:1::") + int(encoding.DecimalLength(uint64(cond.Type))) +
+		int(encoding.Base64Length(uint64(len(cond.Fingerprint)))) + 1 +
+		int(encoding.DecimalLength(cond.MaxFulfillmentLength))
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "4" {
+		return nil, errors.New("not a ThresholdSha256 condition")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max fulfillment length")
+	}
+
+	cond := &Condition{
+		Type:                 4,
+		Fingerprint:          hash[:],
+		MaxFulfillmentLength: length,
+		Cost:                 math.MaxUint64,
+	}
+
+	return cond, nil
+}
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:     encoding.LegacyThresholdSha256Name,
+		Cost:     cond.Cost,
+		Subtypes: cond.subtypes.Names(),
+	}
+	copy(u.Fingerprint[:], cond.Fingerprint)
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for
+// validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.LegacyThresholdSha256Name {
+		return nil, errors.New("not a ThresholdSha256 condition")
+	}
+
+	subtypes, err := registry.TypeSetOf(u.Subtypes)
+	if err != nil {
+		return nil, err
+	}
+	if subtypes&ownType != 0 {
+		return nil, errors.New("subtypes of a ThresholdSha256 condition can't include it")
+	}
+
+	cond := &Condition{
+		Type:                 4,
+		Fingerprint:          u.Fingerprint[:],
+		MaxFulfillmentLength: math.MaxUint64,
+		Cost:                 u.Cost,
+		subtypes:             subtypes,
+	}
+
+	return cond, nil
+}
+
+// A weighted subcondition together with what the parent Condition needs to
+// know about it.
+type subcondition struct {
+	weight               uint32
+	condition            []byte
+	maxFulfillmentLength uint64
+	cost                 uint64
+	featureBitmask       features.Bitmask
+	types                registry.TypeSet
+}
+
+// Derives the condition string of a subfulfillment of any registered type,
+// given in the Crypto Conditions string format.
+func conditionOf(fulfillment []byte) ([]byte, error) {
+	ful, err := registry.ParseFulfillmentUnverified(string(fulfillment))
+	if err != nil {
+		return nil, err
+	}
+
+	cond, err := registry.ConditionOf(ful)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(cond.Serialize()), nil
+}
+
+// Reads what the parent Condition needs to know out of a subfulfillment of any
+// registered type, given in the Crypto Conditions string format. Its feature
+// suites and subtypes are read from the subfulfillment itself, so that they
+// include those of its own subconditions, and so is its MaxFulfillmentLength,
+// as the string format doesn't bound the message id and fixed message of
+// Ed25519Sha256 conditions. Signatures are left unverified, as the Condition
+// doesn't depend on them: validation checks them.
+func parseSubfulfillment(weight uint32, fulfillment []byte) subcondition {
+	ful, err := registry.ParseFulfillmentUnverified(string(fulfillment))
+	if err != nil {
+		// Invalid subfulfillments are committed to as they are, so that the
+		// resulting Condition matches no valid fulfillment.
+		return parseSubcondition(weight, fulfillment)
+	}
+
+	cond, err := registry.ConditionOf(ful)
+	if err != nil {
+		return parseSubcondition(weight, fulfillment)
+	}
+
+	sc := parseSubcondition(weight, []byte(cond.Serialize()))
+	sc.maxFulfillmentLength, _ = registry.TypeOfCondition(cond).Limits(cond)
+	sc.featureBitmask, _ = registry.Features(ful)
+	sc.types |= registry.SubtypesOf(cond)
+
+	return sc
+}
+
+// Reads what the parent Condition needs to know out of a subcondition of any
+// registered type, given in the Crypto Conditions string format. Only the
+// condition string is used, so that fulfilled and unfulfilled subconditions
+// contribute alike. Subconditions that don't parse are still committed to,
+// but can never be fulfilled.
+func parseSubcondition(weight uint32, condition []byte) subcondition {
+	sc := subcondition{
+		weight:    weight,
+		condition: condition,
+	}
+
+	cond, err := registry.ParseCondition(string(condition))
+	if err != nil {
+		return sc
+	}
+
+	t := registry.TypeOfCondition(cond)
+	sc.maxFulfillmentLength, sc.cost = t.Limits(cond)
+	sc.featureBitmask = t.FeatureBitmask
+	sc.types = t.Set() | registry.SubtypesOf(cond)
+
+	return sc
+}
+
+// Returns what the fingerprint commits to of a subcondition: its condition
+// string less the MaxFulfillmentLength. A fulfilled subcondition only derives
+// the length of its own fulfillment, not the limit its condition was made
+// with, so that limit is only checked through the MaxFulfillmentLength of the
+// threshold itself.
+func commitment(condition []byte) []byte {
+	if i := bytes.LastIndexByte(condition, ':'); i >= 0 {
+		return condition[:i]
+	}
+
+	return condition
+}
+
+// Builds the Condition of a threshold over the given subconditions.
+func makeCondition(threshold uint32, subconditions []subcondition) Condition {
+	weighted := make(WeightedStrings, len(subconditions))
+	suites := featureBitmask
+	var subtypes registry.TypeSet
+	var items uint64
+
+	for i, sc := range subconditions {
+		weighted[i] = WeightedString{
+			Weight: sc.weight,
+			String: commitment(sc.condition),
+		}
+
+		suites |= sc.featureBitmask
+		subtypes |= sc.types
+
+		// Each subcondition is written either as a fulfillment or as a
+		// condition, whichever is the longest.
+		length := sc.maxFulfillmentLength
+		if uint64(len(sc.condition)) > length {
+			length = uint64(len(sc.condition))
+		}
+		// Each item is itself a Varbyte holding the weight and the string.
+		items = encoding.AddCost(items, encoding.VarbyteLength(encoding.AddCost(encoding.UvarintLength(uint64(sc.weight)), encoding.VarbyteLength(length))))
+	}
+
+	sort.Sort(weighted)
+
+	hash := sha256.Sum256(bytes.Join([][]byte{
+		encoding.MakeUvarint(uint64(threshold)),
+		encoding.MakeVarbyte(weighted.Bytes()),
+	}, []byte{}))
+
+	// The items are split between the subfulfillment and subcondition lists,
+	// each with its own length prefix.
+	payload := encoding.AddCost(uint64(len(encoding.MakeUvarint(uint64(threshold)))), encoding.VarbyteLength(items))
+	payload = encoding.AddCost(payload, uint64(len(encoding.MakeUvarint(items))))
+
+	return Condition{
+		Type:                 4,
+		FeatureBitmask:       []byte{byte(suites)},
+		Fingerprint:          hash[:],
+		MaxFulfillmentLength: encoding.AddCost(uint64(len("cf:1:4:")), encoding.Base64Length(payload)),
+		Cost:                 thresholdCost(threshold, subconditions),
+		subtypes:             subtypes &^ ownType,
+	}
+}
+
+// Returns the cost of the most expensive set of subconditions a minimal
+// fulfillment can fulfill, plus the subconditionCost for each subcondition. A
+// minimal fulfillment, one that doesn't reach the threshold without any of its
+// subfulfillments, holds no more subfulfillments than it takes of the lightest
+// subconditions to reach the threshold. With weights of 1 that is the
+// threshold itself, as in the crypto-conditions spec.
+func thresholdCost(threshold uint32, subconditions []subcondition) uint64 {
+	weights := []uint32{}
+	costs := []uint64{}
+	for _, sc := range subconditions {
+		// Subconditions without weight are never part of a minimal fulfillment
+		if sc.weight > 0 {
+			weights = append(weights, sc.weight)
+			costs = append(costs, sc.cost)
+		}
+	}
+
+	sort.Slice(weights, func(i, j int) bool { return weights[i] < weights[j] })
+	sort.Slice(costs, func(i, j int) bool { return costs[i] > costs[j] })
+
+	var cost, reached uint64
+	for i := 0; i < len(weights) && reached < uint64(threshold); i++ {
+		reached += uint64(weights[i])
+		cost = encoding.AddCost(cost, costs[i])
+	}
+
+	for range subconditions {
+		cost = encoding.AddCost(cost, subconditionCost)
+	}
+
+	return cost
+}
@@ -0,0 +1,233 @@
+package ThresholdSha256
+
+import (
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"strings"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/registry"
+)
+
+// Tag of ThresholdSha256 conditions and fulfillments in the DER CHOICE
+const derTag = 2
+
+// A subfulfillment or subcondition with its weight. Value holds the DER
+// CHOICE of the child, so that it can be of any type.
+type derWeighted struct {
+	Weight int64 `asn1:"tag:0"`
+	Value  asn1.RawValue
+}
+
+type derFulfillment struct {
+	Threshold       int64         `asn1:"tag:0"`
+	SubFulfillments []derWeighted `asn1:"tag:1"`
+	SubConditions   []derWeighted `asn1:"tag:2"`
+}
+
+// The Subtypes are left out when unknown.
+type derCondition struct {
+	Fingerprint          []byte         `asn1:"tag:0"`
+	Cost                 *big.Int       `asn1:"tag:1"`
+	MaxFulfillmentLength *big.Int       `asn1:"tag:2"`
+	Subtypes             asn1.BitString `asn1:"optional,tag:3"`
+}
+
+// Shape of derWeighted, holding a fulfillment or a condition
+func weightedSchema(kind encoding.Kind) encoding.Schema {
+	return encoding.Schema{
+		{Name: "weight", Tag: 0, Kind: encoding.KindUint},
+		{Name: "value", Tag: encoding.Untagged, Kind: kind},
+	}
+}
+
+// Shape of derFulfillment
+var fulfillmentSchema = encoding.Schema{
+	{Name: "threshold", Tag: 0, Kind: encoding.KindUint},
+	{Name: "subfulfillments", Tag: 1, Kind: encoding.KindSequenceOf, Elem: weightedSchema(encoding.KindFulfillment)},
+	{Name: "subconditions", Tag: 2, Kind: encoding.KindSequenceOf, Elem: weightedSchema(encoding.KindCondition)},
+}
+
+// Shape of derCondition
+var conditionSchema = encoding.Schema{
+	{Name: "fingerprint", Tag: 0, Kind: encoding.KindBytes},
+	{Name: "cost", Tag: 1, Kind: encoding.KindUint},
+	{Name: "maxFulfillmentLength", Tag: 2, Kind: encoding.KindUint},
+	{Name: "subtypes", Tag: 3, Kind: encoding.KindBits, Optional: true},
+}
+
+// Converts a subfulfillment or subcondition of any registered type from the
+// Crypto Conditions string format to the DER binary format.
+func stringToBinary(s []byte) ([]byte, error) {
+	if strings.HasPrefix(string(s), "cc:") {
+		cond, err := registry.ParseCondition(string(s))
+		if err != nil {
+			return nil, err
+		}
+		return cond.SerializeBinary()
+	}
+
+	ful, err := registry.ParseFulfillmentUnverified(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return ful.SerializeBinary()
+}
+
+// Converts a subfulfillment or subcondition of any registered type from the
+// DER binary format to the Crypto Conditions string format.
+func binaryToString(b []byte, isCondition bool) ([]byte, error) {
+	if isCondition {
+		cond, err := registry.ParseConditionBinary(b)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(cond.Serialize()), nil
+	}
+
+	ful, err := registry.ParseFulfillmentBinary(b)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(ful.Serialize()), nil
+}
+
+func weightedToBinary(wss WeightedStrings) ([]derWeighted, error) {
+	der := []derWeighted{}
+	for _, ws := range wss {
+		b, err := stringToBinary(ws.String)
+		if err != nil {
+			return nil, err
+		}
+
+		der = append(der, derWeighted{
+			Weight: int64(ws.Weight),
+			Value:  asn1.RawValue{FullBytes: b},
+		})
+	}
+
+	return der, nil
+}
+
+func weightedFromBinary(der []derWeighted, isCondition bool) (WeightedStrings, error) {
+	wss := WeightedStrings{}
+	for _, dw := range der {
+		if dw.Weight < 0 || dw.Weight > int64(^uint32(0)) {
+			return nil, errors.New("weight out of range")
+		}
+
+		s, err := binaryToString(dw.Value.FullBytes, isCondition)
+		if err != nil {
+			return nil, err
+		}
+
+		wss = append(wss, WeightedString{
+			Weight: uint32(dw.Weight),
+			String: s,
+		})
+	}
+
+	return wss, nil
+}
+
+// Serializes to the DER binary format. Subfulfillments and subconditions are
+// converted to the DER binary format as well, and fail to serialize if they
+// can't be parsed.
+func (ful *ThresholdSha256Fulfillment) SerializeBinary() ([]byte, error) {
+	subFulfillments, err := weightedToBinary(ful.SubFulfillments)
+	if err != nil {
+		return nil, err
+	}
+
+	subConditions, err := weightedToBinary(ful.SubConditions)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoding.MakeChoice(derTag, derFulfillment{
+		Threshold:       int64(ful.Threshold),
+		SubFulfillments: subFulfillments,
+		SubConditions:   subConditions,
+	})
+}
+
+// Parses Fulfillment out of the DER binary format.
+func ParseFulfillmentBinary(b []byte) (*ThresholdSha256Fulfillment, error) {
+	var der derFulfillment
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	if der.Threshold < 0 || der.Threshold > int64(^uint32(0)) {
+		return nil, errors.New("threshold out of range")
+	}
+
+	subFulfillments, err := weightedFromBinary(der.SubFulfillments, false)
+	if err != nil {
+		return nil, err
+	}
+
+	subConditions, err := weightedFromBinary(der.SubConditions, true)
+	if err != nil {
+		return nil, err
+	}
+
+	ful := &ThresholdSha256Fulfillment{
+		Threshold:       uint32(der.Threshold),
+		SubFulfillments: subFulfillments,
+		SubConditions:   subConditions,
+	}
+
+	return ful, nil
+}
+
+// Serializes to the DER binary format.
+func (cond *Condition) SerializeBinary() ([]byte, error) {
+	return encoding.MakeChoice(derTag, derCondition{
+		Fingerprint:          cond.Fingerprint,
+		Cost:                 encoding.MakeInteger(cond.Cost),
+		MaxFulfillmentLength: encoding.MakeInteger(cond.MaxFulfillmentLength),
+		Subtypes:             encoding.MakeBitString(uint32(cond.subtypes)),
+	})
+}
+
+// Parses Condition out of the DER binary format, and checks it for validity.
+func ParseConditionBinary(b []byte) (*Condition, error) {
+	var der derCondition
+	if err := encoding.GetChoice(b, derTag, &der); err != nil {
+		return nil, err
+	}
+
+	if len(der.Fingerprint) != 32 {
+		return nil, errors.New("fingerprint must be 32 bytes")
+	}
+
+	cost, err := encoding.GetInteger(der.Cost)
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := encoding.GetInteger(der.MaxFulfillmentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	subtypes, err := encoding.GetBitString(der.Subtypes)
+	if err != nil {
+		return nil, err
+	}
+	if registry.TypeSet(subtypes)&ownType != 0 {
+		return nil, errors.New("subtypes of a ThresholdSha256 condition can't include it")
+	}
+
+	cond := &Condition{
+		Type:                 4,
+		Fingerprint:          der.Fingerprint,
+		MaxFulfillmentLength: length,
+		Cost:                 cost,
+		subtypes:             registry.TypeSet(subtypes),
+	}
+
+	return cond, nil
+}
@@ -0,0 +1,42 @@
+package ThresholdSha256
+
+import (
+	"strings"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+	"crypto-conditions/features"
+)
+
+// Describes the Fulfillment, the fingerprint of its Condition and the
+// weighted SubFulfillments and SubConditions.
+func (ful *ThresholdSha256Fulfillment) Describe() *explain.Node {
+	cond := ful.Condition()
+	n := explain.Fulfillment(encoding.LegacyThresholdSha256Name).
+		Field("threshold", ful.Threshold).
+		Bytes("fingerprint", cond.Fingerprint)
+
+	for _, sf := range ful.SubFulfillments {
+		n.Child(explain.Weighted(sf.Weight, sf.String))
+	}
+	for _, sc := range ful.SubConditions {
+		n.Child(explain.Weighted(sc.Weight, sc.String))
+	}
+
+	return n
+}
+
+// Describes the Condition. Only Conditions derived from a fulfillment know
+// their feature suites.
+func (cond *Condition) Describe() *explain.Node {
+	n := explain.Condition(encoding.LegacyThresholdSha256Name).
+		Bytes("fingerprint", cond.Fingerprint)
+
+	if len(cond.FeatureBitmask) == 1 {
+		n.Field("feature suites", features.Bitmask(cond.FeatureBitmask[0]))
+	}
+
+	return n.Limit("max fulfillment length", cond.MaxFulfillmentLength).
+		Limit("cost", cond.Cost).
+		Field("subtypes", strings.Join(cond.subtypes.Names(), ", "))
+}
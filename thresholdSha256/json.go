@@ -0,0 +1,176 @@
+package ThresholdSha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/features"
+	"crypto-conditions/registry"
+)
+
+type jsonSubfulfillment struct {
+	Weight      uint32          `json:"weight"`
+	Fulfillment json.RawMessage `json:"fulfillment"`
+}
+
+type jsonSubcondition struct {
+	Weight    uint32          `json:"weight"`
+	Condition json.RawMessage `json:"condition"`
+}
+
+type jsonFulfillment struct {
+	Type            string               `json:"type"`
+	Threshold       uint32               `json:"threshold"`
+	SubFulfillments []jsonSubfulfillment `json:"subfulfillments"`
+	SubConditions   []jsonSubcondition   `json:"subconditions"`
+}
+
+// Marshals to JSON as {"type", "threshold", "subfulfillments",
+// "subconditions"}, each subfulfillment and subcondition as {"weight", and
+// "fulfillment" or "condition"} holding the JSON object of its own type.
+func (ful *ThresholdSha256Fulfillment) MarshalJSON() ([]byte, error) {
+	j := jsonFulfillment{
+		Type:            encoding.LegacyThresholdSha256Name,
+		Threshold:       ful.Threshold,
+		SubFulfillments: []jsonSubfulfillment{},
+		SubConditions:   []jsonSubcondition{},
+	}
+
+	for _, ws := range ful.SubFulfillments {
+		sub, err := registry.ParseFulfillmentUnverified(string(ws.String))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(sub)
+		if err != nil {
+			return nil, err
+		}
+
+		j.SubFulfillments = append(j.SubFulfillments, jsonSubfulfillment{Weight: ws.Weight, Fulfillment: b})
+	}
+
+	for _, ws := range ful.SubConditions {
+		sub, err := registry.ParseCondition(string(ws.String))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(sub)
+		if err != nil {
+			return nil, err
+		}
+
+		j.SubConditions = append(j.SubConditions, jsonSubcondition{Weight: ws.Weight, Condition: b})
+	}
+
+	return json.Marshal(j)
+}
+
+// Unmarshals from JSON, and checks it for validity. The subfulfillments and
+// subconditions can be of any registered type.
+func (ful *ThresholdSha256Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyThresholdSha256Name {
+		return errors.New("not a ThresholdSha256 condition")
+	}
+
+	f := ThresholdSha256Fulfillment{
+		Threshold:       j.Threshold,
+		SubFulfillments: WeightedStrings{},
+		SubConditions:   WeightedStrings{},
+	}
+
+	for _, sf := range j.SubFulfillments {
+		sub, err := registry.UnmarshalFulfillmentJSON(sf.Fulfillment)
+		if err != nil {
+			return err
+		}
+
+		f.SubFulfillments = append(f.SubFulfillments, WeightedString{Weight: sf.Weight, String: []byte(sub.Serialize())})
+	}
+
+	for _, sc := range j.SubConditions {
+		sub, err := registry.UnmarshalConditionJSON(sc.Condition)
+		if err != nil {
+			return err
+		}
+
+		f.SubConditions = append(f.SubConditions, WeightedString{Weight: sc.Weight, String: []byte(sub.Serialize())})
+	}
+
+	*ful = f
+	return nil
+}
+
+// The FeatureBitmask is only present for Conditions derived from a
+// fulfillment.
+type jsonCondition struct {
+	Type                 string             `json:"type"`
+	Fingerprint          encoding.JSONBytes `json:"fingerprint"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength"`
+	Cost                 uint64             `json:"cost"`
+	FeatureBitmask       features.Bitmask   `json:"featureBitmask,omitempty"`
+	Subtypes             []string           `json:"subtypes,omitempty"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxFulfillmentLength", "cost"},
+// with the FeatureBitmask and the names of the Subtypes if known.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	j := jsonCondition{
+		Type:                 encoding.LegacyThresholdSha256Name,
+		Fingerprint:          cond.Fingerprint,
+		MaxFulfillmentLength: cond.MaxFulfillmentLength,
+		Cost:                 cond.Cost,
+		Subtypes:             cond.subtypes.Names(),
+	}
+	if len(cond.FeatureBitmask) > 0 {
+		j.FeatureBitmask = features.Bitmask(cond.FeatureBitmask[0])
+	}
+
+	return json.Marshal(j)
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.LegacyThresholdSha256Name {
+		return errors.New("not a ThresholdSha256 condition")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+
+	subtypes, err := registry.TypeSetOf(j.Subtypes)
+	if err != nil {
+		return err
+	}
+	if subtypes&ownType != 0 {
+		return errors.New("subtypes of a ThresholdSha256 condition can't include it")
+	}
+
+	c := Condition{
+		Type:                 4,
+		Fingerprint:          hash[:],
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+		Cost:                 j.Cost,
+		subtypes:             subtypes,
+	}
+	if j.FeatureBitmask != 0 {
+		c.FeatureBitmask = []byte{byte(j.FeatureBitmask)}
+	}
+
+	*cond = c
+	return nil
+}
@@ -0,0 +1,319 @@
+// Generates and parses Timeout-Sha256 Crypto Conditions
+package TimeoutSha256
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-conditions/encoding"
+	"crypto-conditions/validation"
+)
+
+// Fulfillment is fulfilled once its Expiry has passed or, if Before is set,
+// until its Expiry. The Expiry is serialized as an ISO-8601 timestamp in UTC.
+type Fulfillment struct {
+	Expiry time.Time
+	Before bool
+}
+
+// Cost of every TimeoutSha256 condition. Comparing times costs next to nothing.
+const FixedCost = 0
+
+// Formats the Expiry as an ISO-8601 timestamp in UTC.
+func formatExpiry(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Parses an ISO-8601 timestamp in UTC, as formatted by formatExpiry. Other
+// spellings of the same time are rejected, as they would have other
+// fingerprints.
+func parseExpiry(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || formatExpiry(t) != s {
+		return time.Time{}, errors.New("expiry must be an ISO-8601 timestamp in UTC")
+	}
+
+	return t, nil
+}
+
+func makeMode(before bool) uint64 {
+	if before {
+		return 1
+	}
+	return 0
+}
+
+// Room for an expiry formatted with nanoseconds
+type expiryBuffer [len("2006-01-02T15:04:05.999999999Z")]byte
+
+// Formats the Expiry as formatExpiry does into buf, which it doesn't
+// outgrow for years of four digits.
+func (ful *Fulfillment) appendExpiry(buf *expiryBuffer) []byte {
+	return ful.Expiry.UTC().AppendFormat(buf[:0], time.RFC3339Nano)
+}
+
+// Returns the payload the string format and the fingerprint are made of.
+func (ful *Fulfillment) payload() []byte {
+	var buf expiryBuffer
+	expiry := ful.appendExpiry(&buf)
+
+	payload := encoding.AppendVarbyte(nil, expiry)
+	return encoding.AppendUvarint(payload, makeMode(ful.Before))
+}
+
+// Serializes to the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) Serialize() string {
+	return string(ful.AppendSerialize(make([]byte, 0, ful.SerializedLength())))
+}
+
+// Appends the Crypto Conditions Fulfillment string format to dst, without
+// allocating if dst has room for SerializedLength more bytes.
+func (ful *Fulfillment) AppendSerialize(dst []byte) []byte {
+	var buf expiryBuffer
+	expiry := ful.appendExpiry(&buf)
+
+	a := encoding.NewBase64Appender(append(dst, "cf:1:64:"...))
+	a.AppendVarbyte(expiry)
+	a.AppendUvarint(makeMode(ful.Before))
+	return a.Finish()
+}
+
+// Returns the length of the Crypto Conditions Fulfillment string format.
+func (ful *Fulfillment) SerializedLength() int {
+	var buf expiryBuffer
+	expiry := ful.appendExpiry(&buf)
+
+	payload := encoding.VarbyteLength(uint64(len(expiry))) +
+		encoding.UvarintLength(makeMode(ful.Before))
+
+	return len("cf:1:64:") + int(encoding.Base64Length(payload))
+}
+
+// Parses Fulfillment out of the Crypto Conditions string format, and checks it for validity.
+func ParseFulfillment(s string) (*Fulfillment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cf" {
+		return nil, errors.New("fulfillments must start with \"cf\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "64" {
+		return nil, errors.New("not a TimeoutSha256 condition")
+	}
+
+	b, err := base64.URLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.New("parsing error")
+	}
+
+	e, b, err := encoding.GetVarbyte(b)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry, err := parseExpiry(string(e))
+	if err != nil {
+		return nil, err
+	}
+
+	mode, b, err := encoding.GetUvarint(b)
+	if err != nil {
+		return nil, err
+	}
+	if mode > 1 {
+		return nil, errors.New("unknown timeout mode")
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("parsing error")
+	}
+
+	ful := &Fulfillment{
+		Expiry: expiry,
+		Before: mode == 1,
+	}
+
+	return ful, nil
+}
+
+// Turns an in-memory Fulfillment to an in-memory Condition. The fingerprint
+// commits to the Expiry and to whether the Fulfillment is valid before or
+// after it.
+func (ful *Fulfillment) Condition() Condition {
+	return Condition{
+		Hash:                 sha256.Sum256(ful.payload()),
+		MaxFulfillmentLength: uint64(ful.SerializedLength()),
+		Cost:                 FixedCost,
+	}
+}
+
+// Conditions parsed from the named-information URI format have no
+// MaxFulfillmentLength, which is then set to the largest uint64.
+type Condition struct {
+	Hash                 [32]byte
+	MaxFulfillmentLength uint64
+	Cost                 uint64
+}
+
+// Serializes to the Crypto Conditions string format.
+func (cond *Condition) Serialize() string {
+	return string(cond.AppendSerialize(make([]byte, 0, cond.SerializedLength())))
+}
+
+// Appends the Crypto Conditions string format to dst, without allocating if
+// dst has room for SerializedLength more bytes.
+func (cond *Condition) AppendSerialize(dst []byte) []byte {
+	return encoding.AppendCondition(dst, "64", cond.Hash[:], cond.MaxFulfillmentLength)
+}
+
+// Returns the length of the Crypto Conditions string format.
+func (cond *Condition) SerializedLength() int {
+	return encoding.ConditionLength("64", cond.MaxFulfillmentLength)
+}
+
+// Parses Condition out of the Crypto Conditions string format, and checks it for validity.
+func ParseCondition(s string) (*Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("parsing error")
+	}
+
+	if parts[0] != "cc" {
+		return nil, errors.New("conditions must start with \"cc\"")
+	}
+
+	if parts[1] != "1" {
+		return nil, errors.New("must be protocol version 1")
+	}
+
+	if parts[2] != "64" {
+		return nil, errors.New("not a TimeoutSha256 condition")
+	}
+
+	hash, err := encoding.ParseFingerprint(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid max fulfillment length")
+	}
+
+	cond := &Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: length,
+		Cost:                 FixedCost,
+	}
+
+	return cond, nil
+}
+
+// Serializes to the named-information URI format.
+func (cond *Condition) URI() string {
+	u := encoding.URI{
+		Type:        encoding.TimeoutSha256Name,
+		Fingerprint: cond.Hash,
+		Cost:        cond.Cost,
+	}
+
+	return u.String()
+}
+
+// Parses Condition out of the named-information URI format, and checks it for validity.
+func ParseURI(s string) (*Condition, error) {
+	u, err := encoding.ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Type != encoding.TimeoutSha256Name {
+		return nil, errors.New("not a TimeoutSha256 condition")
+	}
+
+	if u.Cost != FixedCost {
+		return nil, errors.New("invalid cost")
+	}
+
+	cond := &Condition{
+		Hash:                 u.Fingerprint,
+		MaxFulfillmentLength: math.MaxUint64,
+		Cost:                 u.Cost,
+	}
+
+	return cond, nil
+}
+
+func FulfillmentToCondition(s string) (string, error) {
+	ful, err := ParseFulfillment(s)
+	if err != nil {
+		return "", err
+	}
+
+	cond := ful.Condition()
+
+	condString := cond.Serialize()
+	return condString, nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition at the given
+// time: it must match the Condition's fingerprint, MaxFulfillmentLength and
+// Cost, and the time must be at or after the Expiry or, if Before is set,
+// before it. The message is not used by TimeoutSha256 conditions.
+func (ful *Fulfillment) ValidateAt(cond *Condition, message []byte, now time.Time) error {
+	derived := ful.Condition()
+	if derived.Hash != cond.Hash {
+		return validation.ErrFingerprintMismatch
+	}
+
+	if uint64(ful.SerializedLength()) > cond.MaxFulfillmentLength {
+		return validation.ErrFulfillmentTooLong
+	}
+
+	if derived.Cost > cond.Cost {
+		return validation.ErrCostExceeded
+	}
+
+	if ful.Before {
+		if !now.Before(ful.Expiry) {
+			return validation.ErrExpired
+		}
+	} else if now.Before(ful.Expiry) {
+		return validation.ErrNotYetValid
+	}
+
+	return nil
+}
+
+// Checks that an in-memory Fulfillment satisfies the Condition at the current
+// time. Use ValidateAt to validate at another time, such as that of a ledger.
+func (ful *Fulfillment) Validate(cond *Condition, message []byte) error {
+	return ful.ValidateAt(cond, message, time.Now())
+}
+
+// Checks that a fulfillment satisfies a condition, both in the Crypto Conditions string format.
+func Validate(fulfillment string, condition string, message []byte) error {
+	ful, err := ParseFulfillment(fulfillment)
+	if err != nil {
+		return err
+	}
+
+	cond, err := ParseCondition(condition)
+	if err != nil {
+		return err
+	}
+
+	return ful.Validate(cond, message)
+}
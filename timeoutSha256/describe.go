@@ -0,0 +1,24 @@
+package TimeoutSha256
+
+import (
+	"crypto-conditions/encoding"
+	"crypto-conditions/explain"
+)
+
+// Describes the Fulfillment and the fingerprint of its Condition.
+func (ful *Fulfillment) Describe() *explain.Node {
+	n := explain.Fulfillment(encoding.TimeoutSha256Name)
+	n.Field("expiry", formatExpiry(ful.Expiry))
+	n.Field("valid before expiry", ful.Before)
+
+	cond := ful.Condition()
+	return n.Bytes("fingerprint", cond.Hash[:])
+}
+
+// Describes the Condition.
+func (cond *Condition) Describe() *explain.Node {
+	return explain.Condition(encoding.TimeoutSha256Name).
+		Bytes("fingerprint", cond.Hash[:]).
+		Limit("max fulfillment length", cond.MaxFulfillmentLength).
+		Limit("cost", cond.Cost)
+}
@@ -0,0 +1,93 @@
+package TimeoutSha256
+
+import (
+	"encoding/json"
+	"errors"
+
+	"crypto-conditions/encoding"
+)
+
+type jsonFulfillment struct {
+	Type   string `json:"type"`
+	Expiry string `json:"expiry"`
+	Before bool   `json:"before"`
+}
+
+// Marshals to JSON as {"type", "expiry", "before"}, the Expiry as an ISO-8601
+// timestamp in UTC.
+func (ful *Fulfillment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFulfillment{
+		Type:   encoding.TimeoutSha256Name,
+		Expiry: formatExpiry(ful.Expiry),
+		Before: ful.Before,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (ful *Fulfillment) UnmarshalJSON(b []byte) error {
+	var j jsonFulfillment
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.TimeoutSha256Name {
+		return errors.New("not a TimeoutSha256 condition")
+	}
+
+	expiry, err := parseExpiry(j.Expiry)
+	if err != nil {
+		return err
+	}
+
+	*ful = Fulfillment{
+		Expiry: expiry,
+		Before: j.Before,
+	}
+
+	return nil
+}
+
+type jsonCondition struct {
+	Type                 string             `json:"type"`
+	Fingerprint          encoding.JSONBytes `json:"fingerprint"`
+	MaxFulfillmentLength uint64             `json:"maxFulfillmentLength"`
+	Cost                 uint64             `json:"cost"`
+}
+
+// Marshals to JSON as {"type", "fingerprint", "maxFulfillmentLength", "cost"}.
+func (cond *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCondition{
+		Type:                 encoding.TimeoutSha256Name,
+		Fingerprint:          cond.Hash[:],
+		MaxFulfillmentLength: cond.MaxFulfillmentLength,
+		Cost:                 cond.Cost,
+	})
+}
+
+// Unmarshals from JSON, and checks it for validity.
+func (cond *Condition) UnmarshalJSON(b []byte) error {
+	var j jsonCondition
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Type != encoding.TimeoutSha256Name {
+		return errors.New("not a TimeoutSha256 condition")
+	}
+
+	hash, err := j.Fingerprint.Fingerprint()
+	if err != nil {
+		return err
+	}
+
+	if j.Cost != FixedCost {
+		return errors.New("invalid cost")
+	}
+	*cond = Condition{
+		Hash:                 hash,
+		MaxFulfillmentLength: j.MaxFulfillmentLength,
+		Cost:                 j.Cost,
+	}
+
+	return nil
+}
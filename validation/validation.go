@@ -0,0 +1,21 @@
+// Errors returned when a fulfillment does not satisfy a condition
+package validation
+
+import "errors"
+
+// Each error names the check that failed. Callers can compare against these
+// values to tell an invalid signature from, say, a fulfillment for a
+// different condition.
+var (
+	ErrTypeMismatch        = errors.New("fulfillment and condition types differ")
+	ErrFingerprintMismatch = errors.New("fulfillment doesn't match condition fingerprint")
+	ErrFulfillmentTooLong  = errors.New("fulfillment exceeds max fulfillment length")
+	ErrMessageTooLong      = errors.New("dynamic message exceeds max dynamic message length")
+	ErrCostExceeded        = errors.New("fulfillment exceeds condition cost")
+	ErrSignatureInvalid    = errors.New("signature not valid")
+	ErrThresholdNotReached = errors.New("not enough fulfillments")
+	ErrNotYetValid         = errors.New("fulfillment not valid before its expiry")
+	ErrExpired             = errors.New("fulfillment expired")
+	ErrUnsupportedFeature  = errors.New("condition needs unsupported feature suites")
+	ErrMessageIgnored      = errors.New("subfulfillment doesn't depend on the message")
+)